@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/Dudobird/dudo-server/core"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var fsckRepair bool
+
+func init() {
+	rootCmd.AddCommand(fsckCmd)
+	fsckCmd.Flags().BoolVar(&fsckRepair, "repair", false, "fix the problems found")
+}
+
+var fsckCmd = &cobra.Command{
+	Use:   "fsck",
+	Short: "check the consistency between database and storage",
+	Long: `check the consistency between database and storage, and print a JSON report
+with --repair, records without object and orphan objects are deleted,
+files without parent folder are moved to trash and disk usage is recalculated,
+stop the server before repair because uploading files may be treated as orphans`,
+	Run: func(cmd *cobra.Command, args []string) {
+		app := core.NewApp(cfgFile)
+		if err := app.Migrate(false); err != nil {
+			log.Fatal(err)
+		}
+		report, err := app.Fsck(fsckRepair)
+		if err != nil {
+			log.Fatal(err)
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			log.Fatal(err)
+		}
+		if report.HasProblems() && fsckRepair == false {
+			os.Exit(1)
+		}
+	},
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/Dudobird/dudo-server/core"
+	"github.com/Dudobird/dudo-server/migrations"
+	"github.com/Dudobird/dudo-server/models"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	migrateUpSteps   int
+	migrateDownSteps int
+)
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+	migrateCmd.AddCommand(migrateUpCmd, migrateDownCmd, migrateStatusCmd)
+	migrateUpCmd.Flags().IntVarP(&migrateUpSteps, "steps", "n", 0, "number of migrations to apply, 0 for all")
+	migrateDownCmd.Flags().IntVarP(&migrateDownSteps, "steps", "n", 1, "number of migrations to rollback")
+}
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "manage the database schema migrations",
+}
+
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "apply the pending migrations",
+	Run: func(cmd *cobra.Command, args []string) {
+		app := core.NewApp(cfgFile)
+		done, err := migrations.Up(app.DB, migrateUpSteps)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := models.InsertDefaultData(app.DB); err != nil {
+			log.Fatal(err)
+		}
+		log.Infof("%d migrations applied", len(done))
+	},
+}
+
+var migrateDownCmd = &cobra.Command{
+	Use:   "down",
+	Short: "rollback the last applied migrations",
+	Run: func(cmd *cobra.Command, args []string) {
+		app := core.NewApp(cfgFile)
+		done, err := migrations.Down(app.DB, migrateDownSteps)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Infof("%d migrations rollbacked", len(done))
+	},
+}
+
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "show the status of all migrations",
+	Run: func(cmd *cobra.Command, args []string) {
+		app := core.NewApp(cfgFile)
+		status, err := migrations.GetStatus(app.DB)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, s := range status {
+			if s.Applied {
+				fmt.Printf("%04d  %-40s applied at %s\n", s.ID, s.Name, s.AppliedAt.Format("2006-01-02 15:04:05"))
+				continue
+			}
+			fmt.Printf("%04d  %-40s pending\n", s.ID, s.Name)
+		}
+	},
+}
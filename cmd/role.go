@@ -24,7 +24,10 @@ var roleadmin = &cobra.Command{
 	Use:   "role",
 	Short: "create a new admin account",
 	Run: func(cmd *cobra.Command, args []string) {
-		_ = core.NewApp(cfgFile)
+		app := core.NewApp(cfgFile)
+		if err := app.Migrate(false); err != nil {
+			log.Fatal(err)
+		}
 		if email == "" || password == "" {
 			log.Errorln("email and password can not be nil")
 			os.Exit(1)
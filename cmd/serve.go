@@ -3,11 +3,15 @@ package cmd
 import (
 	"github.com/Dudobird/dudo-server/core"
 	"github.com/Dudobird/dudo-server/routers"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
+var applyMigrations bool
+
 func init() {
 	rootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().BoolVar(&applyMigrations, "migrate", false, "apply pending database migrations before start")
 }
 
 var serveCmd = &cobra.Command{
@@ -15,11 +19,15 @@ var serveCmd = &cobra.Command{
 	Short: "start the dudo serve",
 	Run: func(cmd *cobra.Command, args []string) {
 		app := core.NewApp(cfgFile)
+		if err := app.Migrate(applyMigrations); err != nil {
+			log.Fatal(err)
+		}
 		router, err := routers.LoadRouters()
 		if err != nil {
 			return
 		}
 		app.Router = router
+		app.StartTrashPurger()
 		app.Run()
 	},
 }
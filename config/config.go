@@ -10,6 +10,8 @@ type Config struct {
 	Database    database    `toml:"Database"`
 	Application application `toml:"Application"`
 	Storage     storage     `toml:"Storage"`
+	Mail        mail        `toml:"Mail"`
+	OIDC        oidc        `toml:"OIDC"`
 }
 
 type database struct {
@@ -19,22 +21,52 @@ type database struct {
 	DBName   string `toml:"dbname"`
 	Username string `toml:"username"`
 	Password string `toml:"password"`
+	SSLMode  string `toml:"sslmode"`
 }
 
 type storage struct {
+	Type      string `toml:"type"`
+	Root      string `toml:"root"`
 	Server    string `toml:"server"`
 	Port      string `toml:"port"`
 	AccessKey string `toml:"access_key"`
 	SecretKey string `toml:"secret_key"`
 }
 
+type mail struct {
+	Type              string `toml:"type"`
+	File              string `toml:"file"`
+	From              string `toml:"from"`
+	Host              string `toml:"host"`
+	Port              string `toml:"port"`
+	Username          string `toml:"username"`
+	Password          string `toml:"password"`
+	ResetURL          string `toml:"reset_url"`
+	ResetTokenMinutes int    `toml:"reset_token_minutes"`
+}
+
+type oidc struct {
+	Enabled      bool     `toml:"enabled"`
+	Issuer       string   `toml:"issuer"`
+	ClientID     string   `toml:"client_id"`
+	ClientSecret string   `toml:"client_secret"`
+	RedirectURL  string   `toml:"redirect_url"`
+	Scopes       []string `toml:"scopes"`
+	AdminClaim   string   `toml:"admin_claim"`
+	AdminValue   string   `toml:"admin_value"`
+}
+
 type application struct {
-	ListenAt            string `toml:"listenAt"`
-	Token               string `toml:"token"`
-	TempFolder          string `toml:"tempfolder"`
-	BucketPrefix        string `toml:"bucket_prefix"`
-	DefaultDiskLimit    string `toml:"default_disk_limit"`
-	DefaultProfileImage string `toml:"default_profile_image"`
+	ListenAt               string `toml:"listenAt"`
+	Token                  string `toml:"token"`
+	TempFolder             string `toml:"tempfolder"`
+	BucketPrefix           string `toml:"bucket_prefix"`
+	DefaultDiskLimit       string `toml:"default_disk_limit"`
+	DefaultProfileImage    string `toml:"default_profile_image"`
+	TrashRetentionDays     int    `toml:"trash_retention_days"`
+	DefaultMaxFileVersions int    `toml:"default_max_file_versions"`
+	AccessTokenMinutes     int    `toml:"access_token_minutes"`
+	RefreshTokenDays       int    `toml:"refresh_token_days"`
 }
 
 var config *Config
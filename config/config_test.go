@@ -8,12 +8,16 @@ import (
 
 var expectConfig = &Config{
 	Application: application{
-		ListenAt:            "127.0.0.1:8080",
-		Token:               "thisisonlyfortest",
-		TempFolder:          "temp",
-		BucketPrefix:        "dudotest",
-		DefaultDiskLimit:    "5GB",
-		DefaultProfileImage: "/images/default.jpg",
+		ListenAt:               "127.0.0.1:8080",
+		Token:                  "thisisonlyfortest",
+		TempFolder:             "temp",
+		BucketPrefix:           "dudotest",
+		DefaultDiskLimit:       "5GB",
+		DefaultProfileImage:    "/images/default.jpg",
+		TrashRetentionDays:     30,
+		DefaultMaxFileVersions: 10,
+		AccessTokenMinutes:     15,
+		RefreshTokenDays:       30,
 	},
 	Database: database{
 		Type:     "mysql",
@@ -22,13 +26,37 @@ var expectConfig = &Config{
 		DBName:   "dudo",
 		Password: "dudoadmin",
 		Username: "dudouser",
+		SSLMode:  "disable",
 	},
 	Storage: storage{
+		Type:      "minio",
+		Root:      "data",
 		Server:    "localhost",
 		Port:      "9000",
 		AccessKey: "minio",
 		SecretKey: "minio123",
 	},
+	Mail: mail{
+		Type:              "smtp",
+		File:              "mails.log",
+		From:              "dudo@example.com",
+		Host:              "localhost",
+		Port:              "25",
+		Username:          "",
+		Password:          "",
+		ResetURL:          "http://127.0.0.1:8080/reset-password?token=",
+		ResetTokenMinutes: 30,
+	},
+	OIDC: oidc{
+		Enabled:      false,
+		Issuer:       "https://accounts.example.com",
+		ClientID:     "dudo",
+		ClientSecret: "",
+		RedirectURL:  "http://127.0.0.1:8080/api/auth/oidc/callback",
+		Scopes:       []string{"openid", "email", "profile"},
+		AdminClaim:   "groups",
+		AdminValue:   "dudo-admins",
+	},
 }
 
 func TestLoadConfig(t *testing.T) {
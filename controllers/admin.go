@@ -92,6 +92,27 @@ func AdminChangeUserStorageLimit(w http.ResponseWriter, r *http.Request) {
 	utils.JSONMessageWithData(w, http.StatusOK, "", id)
 }
 
+// AdminChangeUserMaxFileVersions change the max versions kept for each file of user
+func AdminChangeUserMaxFileVersions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	type MaxFileVersions struct {
+		MaxFileVersions *int `json:"maxFileVersions"`
+	}
+	data := MaxFileVersions{}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil || data.MaxFileVersions == nil {
+		utils.JSONRespnseWithErr(w, &utils.ErrPostDataNotCorrect)
+		return
+	}
+	err = models.ChangeUserMaxFileVersions(id, *data.MaxFileVersions)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, http.StatusOK, "", id)
+}
+
 // AdminChangeUserPassword change user password
 func AdminChangeUserPassword(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -112,3 +133,28 @@ func AdminChangeUserPassword(w http.ResponseWriter, r *http.Request) {
 	}
 	utils.JSONMessageWithData(w, http.StatusOK, "", id)
 }
+
+// AdminChangeRoleTwoFactor set if users of role must enable two factor authentication
+func AdminChangeRoleTwoFactor(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, &utils.ErrPostDataNotCorrect)
+		return
+	}
+	type RequireTwoFactor struct {
+		Required *bool `json:"required"`
+	}
+	data := RequireTwoFactor{}
+	err = json.NewDecoder(r.Body).Decode(&data)
+	if err != nil || data.Required == nil {
+		utils.JSONRespnseWithErr(w, &utils.ErrPostDataNotCorrect)
+		return
+	}
+	err = models.ChangeRoleRequireTwoFactor(uint(id), *data.Required)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, http.StatusOK, "", id)
+}
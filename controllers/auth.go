@@ -2,16 +2,20 @@ package controllers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/url"
 
+	"github.com/Dudobird/dudo-server/core"
+	"github.com/Dudobird/dudo-server/mail"
 	"github.com/Dudobird/dudo-server/models"
 	"github.com/Dudobird/dudo-server/utils"
+	log "github.com/sirupsen/logrus"
 )
 
 type authInfo struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
-	RoleID   int    `json:"roleid"`
 }
 
 // CreateUser will create a new user based received json object
@@ -22,7 +26,8 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 		utils.JSONRespnseWithErr(w, &utils.ErrPostDataNotCorrect)
 		return
 	}
-	message := models.SignUp(data.Email, data.Password, data.RoleID)
+	// sign up from api always create a normal user
+	message := models.SignUp(data.Email, data.Password, models.UserRoleID)
 	utils.JSONResonseWithMessage(w, message)
 }
 
@@ -40,12 +45,31 @@ func Login(w http.ResponseWriter, r *http.Request) {
 	utils.JSONResonseWithMessage(w, message)
 }
 
-// Logout will logout user and delete the token infomation
+type refreshInfo struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshToken will send back new access token and refresh token
+// the refresh token can be used only once
+// if refresh token not correct or expired, send 401 unauthorization
+func RefreshToken(w http.ResponseWriter, r *http.Request) {
+	data := refreshInfo{}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil || data.RefreshToken == "" {
+		utils.JSONRespnseWithErr(w, &utils.ErrPostDataNotCorrect)
+		return
+	}
+	message := models.RefreshSession(data.RefreshToken)
+	utils.JSONResonseWithMessage(w, message)
+}
+
+// Logout will logout user and revoke the current session
 // if user token not correct, send 401 unauthorization
 // else send 200 logout success
 func Logout(w http.ResponseWriter, r *http.Request) {
 	user := r.Context().Value(utils.TokenContextKey).(string)
-	message := models.Logout(user)
+	session := r.Context().Value(utils.SessionContextKey).(string)
+	message := models.Logout(user, session)
 	utils.JSONResonseWithMessage(w, message)
 }
 
@@ -71,3 +95,84 @@ func UpdatePassword(w http.ResponseWriter, r *http.Request) {
 	message := models.UpdatePassword(userID, tempAccout.Password, tempAccout.NewPassword)
 	utils.JSONResonseWithMessage(w, message)
 }
+
+type forgotPasswordInfo struct {
+	Email string `json:"email"`
+}
+
+// ForgotPassword will send a mail with reset password link to user
+// it always send 200 even the email not exist so nobody can find
+// registered emails with this api
+func ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	data := forgotPasswordInfo{}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil || data.Email == "" {
+		utils.JSONRespnseWithErr(w, &utils.ErrPostDataNotCorrect)
+		return
+	}
+	responseMessage := "reset password mail will be sent if the email is registered"
+	account, token, err := models.CreatePasswordReset(data.Email)
+	if err != nil {
+		if err == &utils.ErrUserNotFound {
+			utils.JSONMessageWithData(w, http.StatusOK, responseMessage, nil)
+			return
+		}
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	app := core.GetApp()
+	message := &mail.Message{
+		To:      account.Email,
+		Subject: "Reset your dudo password",
+		Body: fmt.Sprintf(
+			"Open the link below to reset your password, it will expire in %d minutes:\r\n\r\n%s%s\r\n\r\n"+
+				"If you did not request a password reset, please ignore this mail.",
+			int(models.ResetTokenLifetime().Minutes()),
+			app.Config.Mail.ResetURL,
+			url.QueryEscape(token),
+		),
+	}
+	if err := app.Mailer.Send(message); err != nil {
+		// response is same as success, so the registered emails can not be found out
+		log.Errorf("send reset password mail to %s fail: %s", account.Email, err)
+	}
+	utils.JSONMessageWithData(w, http.StatusOK, responseMessage, nil)
+}
+
+type resetPasswordInfo struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// ResetPassword will set new password with the token from reset password mail
+// if token not correct, expired or already used send 400
+// else send 200 and user must login again on all devices
+func ResetPassword(w http.ResponseWriter, r *http.Request) {
+	data := resetPasswordInfo{}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil || data.Token == "" {
+		utils.JSONRespnseWithErr(w, &utils.ErrPostDataNotCorrect)
+		return
+	}
+	message := models.ResetPassword(data.Token, data.NewPassword)
+	utils.JSONResonseWithMessage(w, message)
+}
+
+type twoFactorLoginInfo struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+// LoginWithTwoFactor is the second step of login for user with two factor
+// user send the mfa token from login and a code from authenticator or a recovery code
+// if mfa token not correct or expired send 401, if code not correct send 403
+func LoginWithTwoFactor(w http.ResponseWriter, r *http.Request) {
+	data := twoFactorLoginInfo{}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil || data.MFAToken == "" || data.Code == "" {
+		utils.JSONRespnseWithErr(w, &utils.ErrPostDataNotCorrect)
+		return
+	}
+	message := models.LoginWithTwoFactor(data.MFAToken, data.Code)
+	utils.JSONResonseWithMessage(w, message)
+}
@@ -0,0 +1,283 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/store"
+	"github.com/Dudobird/dudo-server/utils"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// fileRequestUploaderCookie identify the uploader of file requests without account
+const fileRequestUploaderCookie = "dudo_uploader"
+
+type fileRequestInfo struct {
+	FolderID          string   `json:"folder_id"`
+	Title             string   `json:"title"`
+	Description       string   `json:"description"`
+	ExpireDays        int      `json:"expire_days"`
+	Password          string   `json:"password"`
+	MaxFileSize       int64    `json:"max_file_size"`
+	AllowedExtensions []string `json:"allowed_extensions"`
+	ShowUploads       bool     `json:"show_uploads"`
+}
+
+// fileRequestUploadInfo is the upload shown to uploaders
+type fileRequestUploadInfo struct {
+	FileName  string    `json:"file_name"`
+	FileSize  int64     `json:"file_size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// fileRequestReader count the bytes of upload and fail when file is too large
+type fileRequestReader struct {
+	io.Reader
+	limit    int64
+	count    int64
+	exceeded bool
+}
+
+func (r *fileRequestReader) Read(data []byte) (int, error) {
+	n, err := r.Reader.Read(data)
+	r.count += int64(n)
+	if r.limit > 0 && r.count > r.limit {
+		r.exceeded = true
+		return n, &utils.ErrFileRequestFileTooLarge
+	}
+	return n, err
+}
+
+// fileRequestUnlockCookie return the cookie name which save unlock token of file request
+func fileRequestUnlockCookie(requestID string) string {
+	return "dudo_request_" + requestID
+}
+
+// CreateFileRequest create a file request link for others upload files to folder
+// the token of link is only sent back once
+func CreateFileRequest(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	info := &fileRequestInfo{}
+	err := json.NewDecoder(r.Body).Decode(info)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, &utils.ErrPostDataNotCorrect)
+		return
+	}
+	request := &models.FileRequest{
+		FolderID:    info.FolderID,
+		Title:       info.Title,
+		Description: info.Description,
+		MaxFileSize: info.MaxFileSize,
+		ShowUploads: info.ShowUploads,
+	}
+	fileStore := store.NewFileStore(userID)
+	err = fileStore.CreateFileRequest(request, info.ExpireDays, info.Password, info.AllowedExtensions)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, http.StatusCreated, "", request)
+}
+
+// GetFileRequests list all file requests of user
+func GetFileRequests(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	requests, err := store.NewFileStore(userID).GetFileRequests()
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, http.StatusOK, "", requests)
+}
+
+// DeleteFileRequest delete the file request with id, uploaded files are kept
+func DeleteFileRequest(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	id := mux.Vars(r)["id"]
+	if err := store.NewFileStore(userID).DeleteFileRequest(id); err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, http.StatusOK, "delete success", nil)
+}
+
+// fileRequestFromRequest return the unlocked file request of token in query
+// and the file store of its owner, error is sent back when it fail
+func fileRequestFromRequest(w http.ResponseWriter, r *http.Request) (*models.FileRequest, *store.FileStore) {
+	request, err := models.GetFileRequestWithToken(r.URL.Query().Get("token"))
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return nil, nil
+	}
+	fileStore := store.NewFileStore(request.UserID)
+	if request.HasPassword() {
+		cookie, err := r.Cookie(fileRequestUnlockCookie(request.ID))
+		if err != nil || fileStore.VerifyFileRequestUnlockToken(request, cookie.Value) == false {
+			utils.JSONRespnseWithErr(w, &utils.ErrSharePasswordRequired)
+			return nil, nil
+		}
+	}
+	return request, fileStore
+}
+
+// GetFileRequestInfo return the settings of file request and the uploaded files
+// uploaders only see their own files unless the owner allow them to see all
+func GetFileRequestInfo(w http.ResponseWriter, r *http.Request) {
+	request, fileStore := fileRequestFromRequest(w, r)
+	if request == nil {
+		return
+	}
+	uploader := ""
+	if cookie, err := r.Cookie(fileRequestUploaderCookie); err == nil {
+		uploader = cookie.Value
+	}
+	uploads, err := fileStore.GetFileRequestUploads(request, uploader)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	files := []fileRequestUploadInfo{}
+	for _, upload := range uploads {
+		files = append(files, fileRequestUploadInfo{
+			FileName:  upload.FileName,
+			FileSize:  upload.FileSize,
+			CreatedAt: upload.CreatedAt,
+		})
+	}
+	utils.JSONMessageWithData(w, http.StatusOK, "", struct {
+		Title             string                  `json:"title"`
+		Description       string                  `json:"description"`
+		ExpiresAt         time.Time               `json:"expires_at"`
+		MaxFileSize       int64                   `json:"max_file_size"`
+		AllowedExtensions []string                `json:"allowed_extensions"`
+		ShowUploads       bool                    `json:"show_uploads"`
+		Files             []fileRequestUploadInfo `json:"files"`
+	}{
+		Title:             request.Title,
+		Description:       request.Description,
+		ExpiresAt:         request.ExpiresAt,
+		MaxFileSize:       request.MaxFileSize,
+		AllowedExtensions: request.ExtensionList(),
+		ShowUploads:       request.ShowUploads,
+		Files:             files,
+	})
+}
+
+// UnlockFileRequest check the password of file request and set a short lived cookie
+// which allow upload files with file request
+func UnlockFileRequest(w http.ResponseWriter, r *http.Request) {
+	info := &shareUnlockInfo{}
+	err := json.NewDecoder(r.Body).Decode(info)
+	if err != nil || info.Token == "" {
+		utils.JSONRespnseWithErr(w, &utils.ErrPostDataNotCorrect)
+		return
+	}
+	request, err := models.GetFileRequestWithToken(info.Token)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	if request.HasPassword() == false {
+		utils.JSONMessageWithData(w, 200, "file request is not protected", nil)
+		return
+	}
+	unlockToken, err := store.NewFileStore(request.UserID).UnlockFileRequest(request, info.Password)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     fileRequestUnlockCookie(request.ID),
+		Value:    unlockToken,
+		Path:     "/requests",
+		MaxAge:   int(store.UnlockLifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	utils.JSONMessageWithData(w, 200, "unlock success", nil)
+}
+
+// UploadFileRequest receive file from uploader of file request
+// file is saved to the folder of request like UploadFiles and counted in owner's disk usage,
+// file with same name is renamed instead of overwritten
+func UploadFileRequest(w http.ResponseWriter, r *http.Request) {
+	request, fileStore := fileRequestFromRequest(w, r)
+	if request == nil {
+		return
+	}
+	folder, err := fileStore.GetFileRequestFolder(request)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	// check size before receive the content
+	if size, err := strconv.ParseInt(r.Header.Get("X-File-Size"), 10, 64); err == nil && request.MaxFileSize > 0 && size > request.MaxFileSize {
+		utils.JSONRespnseWithErr(w, &utils.ErrFileRequestFileTooLarge)
+		return
+	}
+	if err := fileStore.CheckDiskQuota(declaredUploadSize(r)); err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	reader, err := r.MultipartReader()
+	if err != nil {
+		log.Errorf("upload file fail : %s ", err)
+		utils.JSONRespnseWithErr(w, &utils.ErrPostDataNotCorrect)
+		return
+	}
+	part, err := nextUploadPart(reader)
+	if err != nil {
+		log.Errorf("upload file fail : %s ", err)
+		utils.JSONRespnseWithErr(w, &utils.ErrPostDataNotCorrect)
+		return
+	}
+	defer part.Close()
+	if request.AllowFile(part.FileName()) == false {
+		utils.JSONRespnseWithErr(w, &utils.ErrFileRequestTypeNotAllowed)
+		return
+	}
+	fileName, err := fileStore.UniqueFileName(folder.ID, part.FileName())
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	content := &fileRequestReader{Reader: part, limit: request.MaxFileSize}
+	// anonymous uploads are recorded as uploaded by owner
+	id, err := saveFileToStorage(fileStore, fileStore.UserID(), folder.ID, fileName, content, -1)
+	if content.exceeded {
+		err = &utils.ErrFileRequestFileTooLarge
+	}
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	uploader := utils.GenRandomID("", 32)
+	if cookie, err := r.Cookie(fileRequestUploaderCookie); err == nil && cookie.Value != "" {
+		uploader = cookie.Value
+	}
+	err = fileStore.RecordFileRequestUpload(request, id, fileName, content.count, uploader, utils.GetRequestIP(r))
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     fileRequestUploaderCookie,
+		Value:    uploader,
+		Path:     "/requests",
+		Expires:  request.ExpiresAt,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	utils.JSONMessageWithData(w, http.StatusCreated, "", fileRequestUploadInfo{
+		FileName:  fileName,
+		FileSize:  content.count,
+		CreatedAt: time.Now(),
+	})
+}
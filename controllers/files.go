@@ -1,12 +1,16 @@
 package controllers
 
 import (
-	"fmt"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"io"
+	"mime/multipart"
 	"net/http"
-	"os"
-	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jinzhu/gorm"
 
@@ -20,109 +24,293 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// uploadFormName is the multipart form name of upload file
+const uploadFormName = "uploadfile"
+
+// sniffLength is the max length used for detect mime type
+// https://golang.org/pkg/net/http/#DetectContentType
+const sniffLength = 512
+
+// nextUploadPart return the next multipart part which form name is uploadfile
+func nextUploadPart(reader *multipart.Reader) (*multipart.Part, error) {
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == uploadFormName && part.FileName() != "" {
+			return part, nil
+		}
+		part.Close()
+	}
+}
+
 // UploadFiles receive user upload file
-// save it to temp folder and wait for upload to storage
+// and stream it to storage without save it to temp folder
+// with query version=true, file with same name will be saved as new version
+// disk quota is checked with X-File-Size header or request length before upload
 func UploadFiles(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value(utils.TokenContextKey).(string)
 	vars := mux.Vars(r)
 	folderID := vars["folderID"]
 	filePath := r.Header.Get("X-FilePath")
-	store := store.NewFileStore(userID)
+	// files uploaded to shared folder are charged to the owner of folder
+	store := ownerFileStore(w, userID, folderID, models.PermissionEditor)
+	if store == nil {
+		return
+	}
+	// check quota before receive the content
+	if err := store.CheckDiskQuota(declaredUploadSize(r)); err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
 	folderID, err := store.GetOrCreateFolder(folderID, filePath)
 	if err != nil {
 		utils.JSONRespnseWithErr(w, err)
 		return
 	}
-	app := core.GetApp()
-
-	r.ParseMultipartForm(64 << 20)
-	file, handler, err := r.FormFile("uploadfile")
+	reader, err := r.MultipartReader()
 	if err != nil {
 		log.Errorf("upload file fail : %s ", err)
 		utils.JSONRespnseWithErr(w, &utils.ErrPostDataNotCorrect)
 		return
 	}
-	buff := make([]byte, 512)
-	_, err = file.Read(buff)
+	part, err := nextUploadPart(reader)
 	if err != nil {
 		log.Errorf("upload file fail : %s ", err)
 		utils.JSONRespnseWithErr(w, &utils.ErrPostDataNotCorrect)
 		return
 	}
-	// https://golang.org/pkg/net/http/#DetectContentType
-	mimeType := http.DetectContentType(buff)
-	defer file.Close()
+	defer part.Close()
+	fileName := part.FileName()
 
-	exist := store.StorageFileExistUnderFolderID(folderID, handler.Filename)
+	exist := store.StorageFileExistUnderFolderID(folderID, fileName)
 	if exist == true {
+		// upload as a new version of the exist file
+		if r.URL.Query().Get("version") == "true" {
+			file, err := store.GetStorageFileUnderFolderID(folderID, fileName)
+			if err == nil && file.IsDir {
+				err = &utils.ErrResourceAlreadyExist
+			}
+			if err == nil {
+				err = saveFileVersion(store, file, userID, part, -1)
+			}
+			if err != nil {
+				utils.JSONRespnseWithErr(w, err)
+				return
+			}
+			utils.JSONMessageWithData(w, 201, "", file.ID)
+			return
+		}
 		utils.JSONRespnseWithErr(w, &utils.ErrResourceAlreadyExist)
 		return
 	}
 
-	// the tempfile will be userid_timestamp_realfilename
-	id := utils.GenRandomID("file", 15)
-	// bucket name has some restrict
-	// https://docs.aws.amazon.com/AmazonS3/latest/dev/BucketRestrictions.html
-	bucketName := fmt.Sprintf(
-		"%s-%s",
-		app.Config.Application.BucketPrefix,
-		strings.ToLower(strings.TrimLeft(userID, "user_")),
-	)
-	tempFileName := app.FullTempFolder + string(filepath.Separator) + id
-	f, err := os.OpenFile(tempFileName, os.O_WRONLY|os.O_CREATE, 0666)
-	defer func() {
-		f.Close()
-		os.Remove(tempFileName)
-	}()
+	id, err := saveFileToStorage(store, userID, folderID, fileName, part, -1)
 	if err != nil {
-		log.Errorf("save temp file fail : %s", err)
-		utils.JSONRespnseWithErr(w, &utils.ErrInternalServerError)
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, 201, "", id)
+	return
+}
+
+// declaredUploadSize return the file size declared by X-File-Size header
+// or the length of whole request body, 0 if both are unknown
+func declaredUploadSize(r *http.Request) int64 {
+	size, err := strconv.ParseInt(r.Header.Get("X-File-Size"), 10, 64)
+	if err == nil && size >= 0 {
+		return size
+	}
+	if r.ContentLength > 0 {
+		return r.ContentLength
+	}
+	return 0
+}
+
+// hashUploadInfo is the post data of upload file with hash
+type hashUploadInfo struct {
+	FileName string `json:"file_name"`
+	FileSize int64  `json:"file_size"`
+	Hash     string `json:"hash"`
+}
+
+// UploadFilesWithHash create file from content which user already has without upload it
+// client should upload the file with UploadFiles when it return not found
+func UploadFilesWithHash(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	vars := mux.Vars(r)
+	info := &hashUploadInfo{}
+	err := json.NewDecoder(r.Body).Decode(info)
+	if err != nil || info.FileName == "" || len(info.Hash) != sha256.Size*2 {
+		utils.JSONRespnseWithErr(w, &utils.ErrPostDataNotCorrect)
 		return
 	}
-	file.Seek(0, 0)
-	size, _ := io.Copy(f, file)
-	defer f.Close()
-	path, err := app.Storage.Upload(tempFileName, id, bucketName)
+	hash := strings.ToLower(info.Hash)
+	// content only exist in files of others is same as not exist
+	blob, err := store.NewFileStore(userID).FindUserBlob(hash)
 	if err != nil {
-		log.Errorf("upload to storage fail : %s", err)
-		utils.JSONRespnseWithErr(w, &utils.ErrInternalServerError)
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	store := ownerFileStore(w, userID, vars["folderID"], models.PermissionEditor)
+	if store == nil {
+		return
+	}
+	folderID, err := store.GetOrCreateFolder(vars["folderID"], r.Header.Get("X-FilePath"))
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	if exist := store.StorageFileExistUnderFolderID(folderID, info.FileName); exist == true {
+		utils.JSONRespnseWithErr(w, &utils.ErrResourceAlreadyExist)
+		return
+	}
+	if blob.Size != info.FileSize {
+		utils.JSONRespnseWithErr(w, &utils.ErrPostDataNotCorrect)
+		return
+	}
+	if err := store.CheckDiskQuota(blob.Size); err != nil {
+		utils.JSONRespnseWithErr(w, err)
 		return
 	}
-	// save to database
 	s := models.StorageFile{
-		UserID: userID,
+		UserID:     store.UserID(),
+		UploadedBy: userID,
 		RawStorageFileInfo: models.RawStorageFileInfo{
-			ID:       id,
-			FileName: handler.Filename,
-			Bucket:   bucketName,
+			ID:       utils.GenRandomID("file", 15),
+			FileName: info.FileName,
 			IsDir:    false,
-			MIMEType: mimeType,
-			FileType: utils.GetFileExtention(handler.Filename),
-			FileSize: size,
+			MIMEType: blob.MIMEType,
+			FileType: utils.GetFileExtention(info.FileName),
+			FileSize: blob.Size,
+			FolderID: folderID,
+			Hash:     hash,
+		},
+	}
+	if err := store.SaveStorageFromBlob(&s); err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, 201, "", s.ID)
+}
+
+// getBucketName return the storage bucket name of user
+func getBucketName(userID string) string {
+	return core.GetApp().UserBucketName(userID)
+}
+
+// getBlobBucketName return the storage bucket name for file contents
+func getBlobBucketName() string {
+	return core.GetApp().BlobBucketName()
+}
+
+// detectMIMEType read the head of reader for detect mime type
+// and return a new reader which still include the whole content
+func detectMIMEType(reader io.Reader) (string, io.Reader, error) {
+	buff := make([]byte, sniffLength)
+	n, err := io.ReadFull(reader, buff)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", nil, err
+	}
+	mimeType := http.DetectContentType(buff[:n])
+	return mimeType, io.MultiReader(bytes.NewReader(buff[:n]), reader), nil
+}
+
+// saveFileToStorage stream the file content to storage and save the
+// meta data and disk usage to database, return the new storage file id
+// size is the length of reader, -1 if unknown
+// uploaderID is the user who upload it, it is not the owner in shared folders
+func saveFileToStorage(fileStore *store.FileStore, uploaderID, folderID, fileName string, reader io.Reader, size int64) (string, error) {
+	s := &models.StorageFile{
+		UserID:     fileStore.UserID(),
+		UploadedBy: uploaderID,
+		RawStorageFileInfo: models.RawStorageFileInfo{
+			ID:       utils.GenRandomID("file", 15),
+			FileName: fileName,
+			IsDir:    false,
+			FileType: utils.GetFileExtention(fileName),
 			FolderID: folderID,
-			Path:     path,
 		},
 	}
 	// Save storage meta data and update user disk usage
-	err = store.SaveStorage(&s)
+	err := uploadFileContent(fileStore, s, reader, size, fileStore.SaveStorage)
 	if err != nil {
-		utils.JSONMessageWithData(w, 500, "", &utils.ErrInternalServerError)
-		return
+		return "", err
 	}
-	utils.JSONMessageWithData(w, 201, "", id)
-	return
+	return s.ID, nil
+}
+
+// saveFileVersion stream the content to storage as the new version of file
+// uploaded by user with uploaderID
+// the old versions over user limit are deleted from storage
+func saveFileVersion(fileStore *store.FileStore, file *models.StorageFile, uploaderID string, reader io.Reader, size int64) error {
+	objects := []models.StorageFile{}
+	file.UploadedBy = uploaderID
+	err := uploadFileContent(fileStore, file, reader, size, func(f *models.StorageFile) error {
+		var err error
+		objects, err = fileStore.SaveFileVersion(f)
+		return err
+	})
+	deleteStorageObjects(objects)
+	return err
+}
+
+// uploadFileContent stream the content to storage and fill the content
+// info of file, then save the file to database with save function
+// content is saved only once, the uploaded object will be deleted
+// if the same content already exist in storage
+func uploadFileContent(fileStore *store.FileStore, file *models.StorageFile, reader io.Reader, size int64, save func(*models.StorageFile) error) error {
+	app := core.GetApp()
+	mimeType, reader, err := detectMIMEType(reader)
+	if err != nil {
+		log.Errorf("upload file fail : %s ", err)
+		return &utils.ErrPostDataNotCorrect
+	}
+	objectName := utils.GenRandomID("blob", 15)
+	bucketName := getBlobBucketName()
+	hash := sha256.New()
+	counter := &utils.CountingReader{Reader: io.TeeReader(reader, hash)}
+	_, err = app.Storage.Upload(counter, size, objectName, bucketName)
+	if err != nil {
+		log.Errorf("upload to storage fail : %s", err)
+		return &utils.ErrInternalServerError
+	}
+	file.Bucket = bucketName
+	file.Path = objectName
+	file.MIMEType = mimeType
+	file.FileSize = counter.Count
+	file.Hash = hex.EncodeToString(hash.Sum(nil))
+	err = save(file)
+	if err != nil || file.Path != objectName {
+		// keep the object only when it is used by a blob
+		blob, findErr := fileStore.FindBlob(file.Hash)
+		if findErr != nil || blob.Path != objectName {
+			app.Storage.Delete(objectName, bucketName)
+		}
+	}
+	if err != nil {
+		if customErr, ok := err.(*utils.CustomError); ok {
+			return customErr
+		}
+		return &utils.ErrInternalServerError
+	}
+	return nil
 }
 
 // DownloadFiles will down load files from storages
+// single file support http range and conditional request
 func DownloadFiles(w http.ResponseWriter, r *http.Request) {
-	downloadFilePath := ""
-	downloadFileName := ""
 	userID := r.Context().Value(utils.TokenContextKey).(string)
 	vars := mux.Vars(r)
 	id := vars["id"]
 	app := core.GetApp()
+	fileStore := ownerFileStore(w, userID, id, models.PermissionViewer)
+	if fileStore == nil {
+		return
+	}
 	fileMeta := &models.StorageFile{}
-	err := app.DB.Model(&models.StorageFile{}).Where("id = ? and user_id = ?", id, userID).First(fileMeta).Error
+	err := app.DB.Model(&models.StorageFile{}).Where("id = ? and user_id = ?", id, fileStore.UserID()).First(fileMeta).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.JSONRespnseWithErr(w, &utils.ErrResourceNotFound)
@@ -132,65 +320,54 @@ func DownloadFiles(w http.ResponseWriter, r *http.Request) {
 		utils.JSONRespnseWithErr(w, &utils.ErrInternalServerError)
 		return
 	}
-	tempDownloadFilePath := app.FullTempFolder + string(filepath.Separator) + fileMeta.FileName
 	if fileMeta.IsDir == true {
-		store := store.NewFileStore(userID)
-		files, hasFiles, err := store.GetAllFiles(fileMeta.ID, string(filepath.Separator)+fileMeta.FileName)
-
-		if err != nil {
-			log.Errorf("download folder error: %s", err)
-			utils.JSONRespnseWithErr(w, &utils.ErrInternalServerError)
-			return
-		}
-
-		if len(files) == 0 || hasFiles == false {
-			utils.JSONRespnseWithErr(w, &utils.ErrEmptyFolder)
-			return
-		}
+		downloadFolder(w, fileStore.UserID(), fileMeta)
+		return
+	}
+	serveFileContent(w, r, fileMeta.FileName, fileMeta.MIMEType, fileMeta.UpdatedAt, fileMeta.ObjectName(), fileMeta.Bucket)
+	return
+}
 
-		randomString := utils.GenRandomID("download", 5)
-		downloadFolderPath := filepath.Join(app.FullTempFolder, randomString)
-		zipFolderPath, errors := app.Storage.DownloadFolder(downloadFolderPath, fileMeta.FileName, files)
-		if len(errors) > 0 {
-			log.Errorf("download folders got some errors : %+v", errors)
-		}
-		defer func() {
-			err := os.RemoveAll(downloadFolderPath)
-			if err != nil {
-				log.Errorf("delete folder %s fail: %s", downloadFolderPath, err)
-			}
-		}()
-		downloadFilePath = zipFolderPath
-		downloadFileName = filepath.Base(zipFolderPath)
-	} else {
-		err = app.Storage.Download(tempDownloadFilePath, fileMeta.ID, fileMeta.Bucket)
-		if err != nil {
-			log.Errorf("down load file from storage err: %s", err)
-			log.Errorf("filename = %s, bucket = %s", fileMeta.ID, fileMeta.Bucket)
-			utils.JSONRespnseWithErr(w, &utils.ErrInternalServerError)
-			return
-		}
-		defer func() {
-			err := os.Remove(tempDownloadFilePath)
-			if err != nil {
-				log.Errorf("delete file %s fail: %s", tempDownloadFilePath, err)
-			}
-		}()
-		downloadFilePath = tempDownloadFilePath
-		downloadFileName = fileMeta.FileName
+// serveFileContent send the content of object back as attachment
+func serveFileContent(w http.ResponseWriter, r *http.Request, fileName, mimeType string, modtime time.Time, objectName, bucket string) {
+	app := core.GetApp()
+	object, err := app.Storage.Open(objectName, bucket)
+	if err != nil {
+		log.Errorf("down load file from storage err: %s", err)
+		log.Errorf("filename = %s, bucket = %s", objectName, bucket)
+		utils.JSONRespnseWithErr(w, &utils.ErrInternalServerError)
+		return
 	}
+	defer object.Close()
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+fileName+"\"")
+	w.Header().Set("Content-Type", mimeType)
+	// ServeContent will handle Range, If-Range, If-Modified-Since etc.
+	// and set Accept-Ranges, Content-Length, Last-Modified headers
+	http.ServeContent(w, r, fileName, modtime, object)
+}
+
+// downloadFolder send all files in folder back as a zip stream
+func downloadFolder(w http.ResponseWriter, userID string, fileMeta *models.StorageFile) {
+	app := core.GetApp()
+	store := store.NewFileStore(userID)
+	files, hasFiles, err := store.GetAllFiles(fileMeta.ID, fileMeta.FileName)
 
-	w.Header().Set("Content-Disposition", "attachment; filename=\""+downloadFileName+"\"")
-	w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
-	f, err := os.Open(downloadFilePath)
 	if err != nil {
-		log.Errorf("open temp file err: %s", err)
+		log.Errorf("download folder error: %s", err)
 		utils.JSONRespnseWithErr(w, &utils.ErrInternalServerError)
 		return
 	}
-	defer func() {
-		f.Close()
-	}()
-	io.Copy(w, f)
+
+	if len(files) == 0 || hasFiles == false {
+		utils.JSONRespnseWithErr(w, &utils.ErrEmptyFolder)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+fileMeta.FileName+".zip\"")
+	w.Header().Set("Content-Type", "application/zip")
+	errors := app.Storage.DownloadFolder(w, files)
+	if len(errors) > 0 {
+		log.Errorf("download folders got some errors : %+v", errors)
+	}
 	return
 }
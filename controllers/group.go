@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/utils"
+	"github.com/gorilla/mux"
+)
+
+type groupInfo struct {
+	Name string `json:"name"`
+}
+
+type groupMemberInfo struct {
+	Email string `json:"email"`
+}
+
+// GetGroups list the groups which user is a member of
+func GetGroups(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	groups, err := models.GetGroups(userID)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, http.StatusOK, "", groups)
+}
+
+// CreateGroup create a new group owned by user
+func CreateGroup(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	info := &groupInfo{}
+	if err := json.NewDecoder(r.Body).Decode(info); err != nil {
+		utils.JSONRespnseWithErr(w, &utils.ErrPostDataNotCorrect)
+		return
+	}
+	group, err := models.CreateGroup(userID, info.Name)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, http.StatusCreated, "", group)
+}
+
+// DeleteGroup delete the group and the permissions granted to it
+func DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	if err := models.DeleteGroup(userID, mux.Vars(r)["id"]); err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, http.StatusOK, "delete success", nil)
+}
+
+// AddGroupMember add the user with email to group
+func AddGroupMember(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	info := &groupMemberInfo{}
+	if err := json.NewDecoder(r.Body).Decode(info); err != nil || info.Email == "" {
+		utils.JSONRespnseWithErr(w, &utils.ErrPostDataNotCorrect)
+		return
+	}
+	group, err := models.AddGroupMember(userID, mux.Vars(r)["id"], info.Email)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, http.StatusCreated, "", group)
+}
+
+// RemoveGroupMember remove member from group or leave the group
+func RemoveGroupMember(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	vars := mux.Vars(r)
+	if err := models.RemoveGroupMember(userID, vars["id"], vars["userID"]); err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, http.StatusOK, "remove success", nil)
+}
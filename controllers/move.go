@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Dudobird/dudo-server/core"
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/store"
+	"github.com/Dudobird/dudo-server/utils"
+	"github.com/gorilla/mux"
+)
+
+// targetFolderInfo is the post data of move and copy
+type targetFolderInfo struct {
+	FolderID string `json:"folder_id"`
+}
+
+// readTargetFolder read the target folder id from post data
+func readTargetFolder(r *http.Request) (string, error) {
+	info := &targetFolderInfo{}
+	err := json.NewDecoder(r.Body).Decode(info)
+	if err != nil || info.FolderID == "" {
+		return "", &utils.ErrPostDataNotCorrect
+	}
+	return info.FolderID, nil
+}
+
+// targetFileStore return the store of file owner when user has role on the file
+// and can edit the target folder, both must belong to the same owner
+func targetFileStore(w http.ResponseWriter, userID, id, targetID, role string) *store.FileStore {
+	fileStore := ownerFileStore(w, userID, id, role)
+	if fileStore == nil {
+		return nil
+	}
+	targetStore := ownerFileStore(w, userID, targetID, models.PermissionEditor)
+	if targetStore == nil {
+		return nil
+	}
+	if targetStore.UserID() != fileStore.UserID() {
+		utils.JSONRespnseWithErr(w, &utils.ErrPostDataNotCorrect)
+		return nil
+	}
+	return fileStore
+}
+
+// MoveFile move file or folder into another folder
+func MoveFile(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	vars := mux.Vars(r)
+	targetID, err := readTargetFolder(r)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	fileStore := targetFileStore(w, userID, vars["id"], targetID, models.PermissionEditor)
+	if fileStore == nil {
+		return
+	}
+	file, err := fileStore.MoveFile(vars["id"], targetID)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, 200, "", file)
+}
+
+// CopyFile copy file or folder with all sub files into another folder
+func CopyFile(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	vars := mux.Vars(r)
+	targetID, err := readTargetFolder(r)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	app := core.GetApp()
+	fileStore := targetFileStore(w, userID, vars["id"], targetID, models.PermissionViewer)
+	if fileStore == nil {
+		return
+	}
+	file, copied, err := fileStore.CopyFile(vars["id"], targetID, func(src, dst *models.StorageFile) error {
+		return app.Storage.Copy(src.ObjectName(), src.Bucket, dst.ObjectName(), dst.Bucket)
+	})
+	if err != nil {
+		deleteStorageObjects(copied)
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, 201, "", file)
+}
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/Dudobird/dudo-server/core"
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/oidc"
+	"github.com/Dudobird/dudo-server/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// oidcStateCookie bind the login state to browser which start the login
+const oidcStateCookie = "dudo_oidc_state"
+
+// OIDCLogin redirect user to identity provider for login
+// the nonce and PKCE code verifier are saved with state for the callback
+func OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	provider := core.GetApp().OIDC
+	if provider == nil {
+		utils.JSONRespnseWithErr(w, &utils.ErrSSONotEnabled)
+		return
+	}
+	state := oidc.RandomString()
+	nonce := oidc.RandomString()
+	codeVerifier := oidc.RandomString()
+	loginURL, err := provider.AuthCodeURL(state, nonce, codeVerifier)
+	if err != nil {
+		log.Errorf("get identity provider metadata fail: %s", err)
+		utils.JSONRespnseWithErr(w, &utils.ErrInternalServerError)
+		return
+	}
+	if err := models.CreateOIDCLogin(state, nonce, codeVerifier); err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/auth/oidc",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, loginURL, http.StatusFound)
+}
+
+// OIDCCallback finish the login with the code from identity provider
+// user is created when first login, send back the user with token like login
+func OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	provider := core.GetApp().OIDC
+	if provider == nil {
+		utils.JSONRespnseWithErr(w, &utils.ErrSSONotEnabled)
+		return
+	}
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		log.Warnf("identity provider login fail: %s", query.Get("error"))
+		utils.JSONRespnseWithErr(w, &utils.ErrSSOLoginFail)
+		return
+	}
+	state := query.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if state == "" || query.Get("code") == "" || err != nil || cookie.Value != state {
+		utils.JSONRespnseWithErr(w, &utils.ErrSSOStateNotValid)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/api/auth/oidc", MaxAge: -1})
+	login, err := models.TakeOIDCLogin(state)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	claims, err := provider.Exchange(query.Get("code"), login.CodeVerifier, login.Nonce)
+	if err != nil {
+		log.Warnf("exchange code with identity provider fail: %s", err)
+		utils.JSONRespnseWithErr(w, &utils.ErrSSOLoginFail)
+		return
+	}
+	verified, ok := claims["email_verified"].(bool)
+	if ok && verified == false {
+		utils.JSONRespnseWithErr(w, &utils.ErrSSOEmailNotVerified)
+		return
+	}
+	message := models.LoginWithOIDC(
+		provider.Issuer,
+		claims.String("sub"),
+		claims.String("email"),
+		verified,
+		provider.IsAdmin(claims),
+	)
+	utils.JSONResonseWithMessage(w, message)
+}
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/store"
+	"github.com/Dudobird/dudo-server/utils"
+	"github.com/gorilla/mux"
+)
+
+type filePermissionInfo struct {
+	Email   string `json:"email"`
+	GroupID string `json:"group_id"`
+	Role    string `json:"role"`
+}
+
+// ownerFileStore return the file store of the owner of file with id when user
+// has role on it, so changes are made and charged to the owner,
+// the store of user is returned for files not exist or not shared with user
+// and "root", error is sent back when user has no right for role
+func ownerFileStore(w http.ResponseWriter, userID, id, role string) *store.FileStore {
+	file, err := store.NewFileStore(userID).GetFileWithPermission(id, role)
+	if err == &utils.ErrResourceNotFound {
+		return store.NewFileStore(userID)
+	}
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return nil
+	}
+	return store.NewFileStore(file.UserID)
+}
+
+// GetFilePermissions list the users and groups granted on file directly
+func GetFilePermissions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	fileStore := store.NewFileStore(userID)
+	file, err := fileStore.GetFileWithPermission(mux.Vars(r)["id"], models.PermissionCoOwner)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	permissions, err := fileStore.GetFilePermissions(file)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, http.StatusOK, "", permissions)
+}
+
+// GrantFilePermission grant a role on file to user with email or group
+// only owner and co-owners can manage permissions
+func GrantFilePermission(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	info := &filePermissionInfo{}
+	err := json.NewDecoder(r.Body).Decode(info)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, &utils.ErrPostDataNotCorrect)
+		return
+	}
+	fileStore := store.NewFileStore(userID)
+	file, err := fileStore.GetFileWithPermission(mux.Vars(r)["id"], models.PermissionCoOwner)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	permission, err := fileStore.GrantFilePermission(file, info.Email, info.GroupID, info.Role)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, http.StatusCreated, "", permission)
+}
+
+// RevokeFilePermission delete the permission with id from file
+func RevokeFilePermission(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	vars := mux.Vars(r)
+	fileStore := store.NewFileStore(userID)
+	file, err := fileStore.GetFileWithPermission(vars["id"], models.PermissionCoOwner)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	if err := fileStore.RevokeFilePermission(file, vars["permissionID"]); err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, http.StatusOK, "revoke success", nil)
+}
+
+// GetSharedWithMe list the files and folders shared with user by others
+func GetSharedWithMe(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	files, err := store.NewFileStore(userID).GetSharedWithMe()
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, http.StatusOK, "", files)
+}
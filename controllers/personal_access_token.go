@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/utils"
+	"github.com/gorilla/mux"
+)
+
+type personalAccessTokenInfo struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+// GetPersonalAccessTokens list all personal access tokens of user
+func GetPersonalAccessTokens(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	tokens, err := models.GetPersonalAccessTokens(userID)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, http.StatusOK, "", tokens)
+}
+
+// CreatePersonalAccessToken create a new personal access token
+// the token is only sent back once and can not be got again
+func CreatePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	data := personalAccessTokenInfo{}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, &utils.ErrPostDataNotCorrect)
+		return
+	}
+	token, err := models.CreatePersonalAccessToken(userID, data.Name, data.Scopes, data.ExpiresInDays)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, http.StatusCreated, "", token)
+}
+
+// RevokePersonalAccessToken revoke the personal access token with id
+func RevokePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	id := mux.Vars(r)["id"]
+	if err := models.RevokePersonalAccessToken(userID, id); err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, http.StatusOK, "", id)
+}
@@ -60,7 +60,7 @@ func UpdateProfile(w http.ResponseWriter, r *http.Request) {
 		utils.JSONRespnseWithErr(w, &utils.ErrInternalServerError)
 		return
 	}
-	err = models.GetDB().Model(currentUserProfile).Omit("disk_limit", "usage_disk_size").Updates(profile).Error
+	err = models.GetDB().Model(currentUserProfile).Omit("disk_limit", "usage_disk_size", "max_file_versions").Updates(profile).Error
 	if err != nil {
 		log.Errorf("update user profile error: %s", err)
 		utils.JSONRespnseWithErr(w, &utils.ErrInternalServerError)
@@ -4,7 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/Dudobird/dudo-server/models"
 	"github.com/Dudobird/dudo-server/store"
 	"github.com/Dudobird/dudo-server/utils"
 	"github.com/gorilla/mux"
@@ -14,6 +18,42 @@ type shareFileInfo struct {
 	FileID      string `json:"file_id"`
 	ExpireDays  int    `json:"expire_days"`
 	Description string `json:"description"`
+	Password    string `json:"password"`
+	// MaxDownloads limit the downloads of share, 0 means no limit
+	MaxDownloads int `json:"max_downloads"`
+}
+
+type shareUnlockInfo struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// shareAccessWriter record the status and bytes of share download for access log
+type shareAccessWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *shareAccessWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *shareAccessWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(data)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// shareUnlockCookie return the cookie name which save unlock token of share
+func shareUnlockCookie(shareID string) string {
+	return "dudo_share_" + shareID
 }
 
 // CreateShareFile create a new shared files
@@ -27,7 +67,7 @@ func CreateShareFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	fileStore := store.NewFileStore(userID)
-	token, err := fileStore.CreateShareToken(sfi.FileID, sfi.ExpireDays, sfi.Description)
+	token, err := fileStore.CreateShareToken(sfi.FileID, sfi.ExpireDays, sfi.Description, sfi.Password, sfi.MaxDownloads)
 	if err != nil {
 		utils.JSONRespnseWithErr(w, (err).(*utils.CustomError))
 		return
@@ -38,26 +78,282 @@ func CreateShareFile(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
-// GetShareFileFromToken download share file for others
-func GetShareFileFromToken(w http.ResponseWriter, r *http.Request) {
+// UnlockShareFile check the password of share and set a short lived cookie
+// which allow download the share file
+func UnlockShareFile(w http.ResponseWriter, r *http.Request) {
+	info := &shareUnlockInfo{}
+	err := json.NewDecoder(r.Body).Decode(info)
+	if err != nil || info.Token == "" {
+		utils.JSONRespnseWithErr(w, &utils.ErrPostDataNotCorrect)
+		return
+	}
+	fileStore := store.NewFileStore("")
+	share, err := fileStore.VerifyShareToken(info.Token)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	if share.HasPassword() == false {
+		utils.JSONMessageWithData(w, 200, "share is not protected", nil)
+		return
+	}
+	unlockToken, err := fileStore.UnlockShare(share, info.Password)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     shareUnlockCookie(share.ID),
+		Value:    unlockToken,
+		Path:     "/shares",
+		MaxAge:   int(store.UnlockLifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	utils.JSONMessageWithData(w, 200, "unlock success", nil)
+}
+
+// sharedFileInfo is the file information shown to visitors of share
+type sharedFileInfo struct {
+	ID               string    `json:"id"`
+	FileName         string    `json:"file_name"`
+	MIMEType         string    `json:"mime_type"`
+	FileType         string    `json:"file_type"`
+	FileSize         int64     `json:"file_size"`
+	FileSizeReadable string    `json:"file_size_readable"`
+	IsDir            bool      `json:"is_dir"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+func newSharedFileInfo(file *models.StorageFile) *sharedFileInfo {
+	return &sharedFileInfo{
+		ID:               file.ID,
+		FileName:         file.FileName,
+		MIMEType:         file.MIMEType,
+		FileType:         file.FileType,
+		FileSize:         file.FileSize,
+		FileSizeReadable: utils.GetReadableFileSize(float64(file.FileSize)),
+		IsDir:            file.IsDir,
+		UpdatedAt:        file.UpdatedAt,
+	}
+}
+
+// shareFromRequest return the share of token in request
+// error is sent back and nil returned when token is not valid
+func shareFromRequest(w http.ResponseWriter, r *http.Request, fileStore *store.FileStore) *models.ShareFiles {
 	token := r.URL.Query().Get("token")
 	if token == "" {
 		utils.JSONMessageWithData(w, 400, "token is empty", nil)
-		return
+		return nil
 	}
-	fileStore := store.NewFileStore("")
-	fileID, userID, err := fileStore.VerifyShareToken(token)
+	share, err := fileStore.VerifyShareToken(token)
 	if err != nil {
 		utils.JSONRespnseWithErr(w, err)
+		return nil
+	}
+	return share
+}
+
+// shareUnlocked return true if share has no password or it is unlocked by the request
+func shareUnlocked(r *http.Request, fileStore *store.FileStore, share *models.ShareFiles) bool {
+	if share.HasPassword() == false {
+		return true
+	}
+	cookie, err := r.Cookie(shareUnlockCookie(share.ID))
+	return err == nil && fileStore.VerifyShareUnlockToken(share, cookie.Value)
+}
+
+// byteRange is a part of file requested with Range header
+type byteRange struct {
+	start  int64
+	length int64
+}
+
+// parseByteRanges parse the Range header in the same way as http.ServeContent,
+// ranges start after the end of file are skipped, false is returned for invalid header
+func parseByteRanges(header string, size int64) ([]byteRange, bool) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(header, prefix) {
+		return nil, false
+	}
+	ranges := []byteRange{}
+	for _, spec := range strings.Split(header[len(prefix):], ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		i := strings.Index(spec, "-")
+		if i < 0 {
+			return nil, false
+		}
+		first, last := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+		if first == "" {
+			// suffix range is the last bytes of file
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, false
+			}
+			if n > size {
+				n = size
+			}
+			ranges = append(ranges, byteRange{start: size - n, length: n})
+			continue
+		}
+		start, err := strconv.ParseInt(first, 10, 64)
+		if err != nil || start < 0 {
+			return nil, false
+		}
+		if start >= size {
+			continue
+		}
+		end := size - 1
+		if last != "" {
+			end, err = strconv.ParseInt(last, 10, 64)
+			if err != nil || start > end {
+				return nil, false
+			}
+			if end >= size {
+				end = size - 1
+			}
+		}
+		ranges = append(ranges, byteRange{start: start, length: end - start + 1})
+	}
+	return ranges, true
+}
+
+// isFullShareDownload return true when request may get the whole file,
+// only resumed downloads which all ranges start after the beginning and cover
+// part of file are not counted, folders are always sent back as a whole zip
+func isFullShareDownload(r *http.Request, file *models.StorageFile) bool {
+	if r.Method == http.MethodHead {
+		return false
+	}
+	header := r.Header.Get("Range")
+	if file.IsDir || header == "" {
+		return true
+	}
+	// Range is ignored when If-Range not match the modified time of file
+	if ifRange := r.Header.Get("If-Range"); ifRange != "" {
+		modified, err := http.ParseTime(ifRange)
+		if err != nil || modified.Unix() != file.UpdatedAt.Unix() {
+			return true
+		}
+	}
+	ranges, ok := parseByteRanges(header, file.FileSize)
+	if !ok || len(ranges) == 0 {
+		return true
+	}
+	var covered int64
+	for _, part := range ranges {
+		if part.start == 0 {
+			return true
+		}
+		covered += part.length
+	}
+	return covered >= file.FileSize
+}
+
+// downloadShareFile send the file or folder of share back
+// the request is saved in access log and full download is counted unless it fail
+// or file is not modified
+func downloadShareFile(w http.ResponseWriter, r *http.Request, fileStore *store.FileStore, share *models.ShareFiles, fileID string) {
+	writer := &shareAccessWriter{ResponseWriter: w}
+	defer func() {
+		fileStore.RecordShareAccess(share, fileID, utils.GetRequestIP(r), r.UserAgent(), writer.status, writer.bytes)
+	}()
+	if shareUnlocked(r, fileStore, share) == false {
+		utils.JSONRespnseWithErr(writer, &utils.ErrSharePasswordRequired)
+		return
+	}
+	file, err := store.NewFileStore(share.UserID).GetFileWithPermission(fileID, models.PermissionViewer)
+	if err != nil {
+		utils.JSONRespnseWithErr(writer, err)
 		return
 	}
-	ctx := context.WithValue(r.Context(), utils.TokenContextKey, userID)
+	counted := isFullShareDownload(r, file)
+	if counted {
+		if err := fileStore.AcquireShareDownload(share); err != nil {
+			utils.JSONRespnseWithErr(writer, err)
+			return
+		}
+	}
+	ctx := context.WithValue(r.Context(), utils.TokenContextKey, share.UserID)
 	r = r.WithContext(ctx)
 	data := make(map[string]string)
 	data["id"] = fileID
 	r = mux.SetURLVars(r, data)
-	DownloadFiles(w, r)
-	return
+	DownloadFiles(writer, r)
+	if counted && (writer.status >= http.StatusBadRequest || writer.status == http.StatusNotModified) {
+		fileStore.ReleaseShareDownload(share)
+	}
+}
+
+// GetShareFileFromToken download share file for others
+// share with password must be unlocked first
+func GetShareFileFromToken(w http.ResponseWriter, r *http.Request) {
+	fileStore := store.NewFileStore("")
+	share := shareFromRequest(w, r, fileStore)
+	if share == nil {
+		return
+	}
+	downloadShareFile(w, r, fileStore, share, share.FileID)
+}
+
+// getSharedFile return the file of shared folder with id or path in query
+func getSharedFile(w http.ResponseWriter, r *http.Request) (*store.FileStore, *models.ShareFiles, *models.StorageFile, string) {
+	share := shareFromRequest(w, r, store.NewFileStore(""))
+	if share == nil {
+		return nil, nil, nil, ""
+	}
+	// files are queried with owner of share and limited in shared folder
+	fileStore := store.NewFileStore(share.UserID)
+	if shareUnlocked(r, fileStore, share) == false {
+		utils.JSONRespnseWithErr(w, &utils.ErrSharePasswordRequired)
+		return nil, nil, nil, ""
+	}
+	query := r.URL.Query()
+	file, path, err := fileStore.GetSharedFile(share, query.Get("id"), query.Get("path"))
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return nil, nil, nil, ""
+	}
+	return fileStore, share, file, path
+}
+
+// ListShareFolder list the files in shared folder or its sub folder
+func ListShareFolder(w http.ResponseWriter, r *http.Request) {
+	fileStore, _, folder, path := getSharedFile(w, r)
+	if folder == nil {
+		return
+	}
+	files, err := fileStore.ListSharedFolder(folder)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	children := []*sharedFileInfo{}
+	for i := range files {
+		children = append(children, newSharedFileInfo(&files[i]))
+	}
+	utils.JSONMessageWithData(w, 200, "", struct {
+		Folder *sharedFileInfo   `json:"folder"`
+		Path   string            `json:"path"`
+		Files  []*sharedFileInfo `json:"files"`
+	}{
+		Folder: newSharedFileInfo(folder),
+		Path:   path,
+		Files:  children,
+	})
+}
+
+// DownloadShareFolderFile download a file or sub folder in shared folder
+func DownloadShareFolderFile(w http.ResponseWriter, r *http.Request) {
+	fileStore, share, file, _ := getSharedFile(w, r)
+	if file == nil {
+		return
+	}
+	downloadShareFile(w, r, fileStore, share, file.ID)
 }
 
 // GetShareFiles get all shared folders with user id
@@ -73,6 +369,19 @@ func GetShareFiles(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+// GetShareAccessLogs return the access history of share
+func GetShareAccessLogs(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	fileStore := store.NewFileStore(userID)
+	logs, err := fileStore.GetShareAccessLogs(id)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, 200, "", logs)
+}
+
 // DeleteShareFile get the id from url and delete the share file reference
 func DeleteShareFile(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
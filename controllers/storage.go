@@ -7,7 +7,6 @@ import (
 
 	"github.com/Dudobird/dudo-server/store"
 
-	"github.com/Dudobird/dudo-server/core"
 	"github.com/Dudobird/dudo-server/models"
 	"github.com/Dudobird/dudo-server/utils"
 	"github.com/gorilla/mux"
@@ -22,12 +21,18 @@ func CreateFolder(w http.ResponseWriter, r *http.Request) {
 		utils.JSONRespnseWithErr(w, errWithCode)
 		return
 	}
-	file := &models.StorageFile{UserID: userID}
+	file := &models.StorageFile{}
 	err := json.NewDecoder(r.Body).Decode(file)
 	if err != nil {
 		utils.JSONRespnseWithErr(w, &utils.ErrPostDataNotCorrect)
 		return
 	}
+	// folder created in shared folder is owned by the owner of shared folder
+	fileStore := ownerFileStore(w, userID, file.FolderID, models.PermissionEditor)
+	if fileStore == nil {
+		return
+	}
+	file.UserID = fileStore.UserID()
 	errWithCode = file.CreateFolder(userID)
 	if errWithCode != nil {
 		utils.JSONRespnseWithErr(w, errWithCode)
@@ -52,7 +57,10 @@ func UpdateFileInfo(w http.ResponseWriter, r *http.Request) {
 		utils.JSONRespnseWithErr(w, &utils.ErrPostDataNotCorrect)
 		return
 	}
-	fileStore := store.NewFileStore(userID)
+	fileStore := ownerFileStore(w, userID, id, models.PermissionEditor)
+	if fileStore == nil {
+		return
+	}
 	data, errWithCode := fileStore.RenameFileName(id, fileInfo.Name)
 	if errWithCode != nil {
 		utils.JSONRespnseWithErr(w, errWithCode)
@@ -72,8 +80,13 @@ func GetFileInfo(w http.ResponseWriter, r *http.Request) {
 		utils.JSONRespnseWithErr(w, errWithCode)
 		return
 	}
+	fileStore := ownerFileStore(w, userID, id, models.PermissionViewer)
+	if fileStore == nil {
+		return
+	}
 	swu := models.StorageFilesWithUser{
-		Owner: user,
+		Owner:   user,
+		OwnerID: fileStore.UserID(),
 	}
 	data, errWithCode := swu.ListCurrentFile(id)
 	if errWithCode != nil {
@@ -94,8 +107,13 @@ func ListFolderFiles(w http.ResponseWriter, r *http.Request) {
 		utils.JSONRespnseWithErr(w, errWithCode)
 		return
 	}
+	fileStore := ownerFileStore(w, userID, id, models.PermissionViewer)
+	if fileStore == nil {
+		return
+	}
 	swu := models.StorageFilesWithUser{
-		Owner: user,
+		Owner:   user,
+		OwnerID: fileStore.UserID(),
 	}
 	data, errWithCode := swu.ListChildren(id)
 	if errWithCode != nil {
@@ -106,33 +124,24 @@ func ListFolderFiles(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
-// DeleteFiles delete current file or folder( all reference files)
+// DeleteFiles move current file or folder( all reference files) to trash
 func DeleteFiles(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
-	app := core.GetApp()
-	if app == nil {
-		utils.JSONRespnseWithErr(w, &utils.ErrInternalServerError)
-		return
-	}
 	userID := r.Context().Value(utils.TokenContextKey).(string)
 
-	fileStore := store.NewFileStore(userID)
-	files, err := fileStore.DeleteFolders(id)
+	// files deleted by others are moved to the trash of owner
+	fileStore := ownerFileStore(w, userID, id, models.PermissionEditor)
+	if fileStore == nil {
+		return
+	}
+	files, err := fileStore.TrashFiles(id)
 	if err != nil {
-		log.Errorf("delete folders fail : %s", err)
-		utils.JSONRespnseWithErr(w, &utils.ErrPostDataNotCorrect)
+		utils.JSONRespnseWithErr(w, err)
 		return
 	}
 	messages := []string{}
 	for _, file := range files {
-		err := app.Storage.Delete(file.ID, file.Bucket)
-		if err != nil {
-			log.Errorf("delete from storage error : %s", err)
-			log.Errorf("delete detail info : %s %s", file.Bucket, file.ID)
-			messages = append(messages, fmt.Sprintf("%s:%s", file.FileName, err))
-			continue
-		}
 		messages = append(messages, fmt.Sprintf("%s:success", file.FileName))
 	}
 	utils.JSONMessageWithData(w, 200, "", messages)
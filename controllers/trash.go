@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Dudobird/dudo-server/core"
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/store"
+	"github.com/Dudobird/dudo-server/utils"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// ListTrash list the deleted files and folders of user
+func ListTrash(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	fileStore := store.NewFileStore(userID)
+	files, err := fileStore.ListTrash()
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, 200, "", files)
+}
+
+// RestoreTrash restore the deleted file or folder with id
+func RestoreTrash(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	vars := mux.Vars(r)
+	fileStore := store.NewFileStore(userID)
+	file, err := fileStore.RestoreTrash(vars["id"])
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, 200, "", file)
+}
+
+// EmptyTrash delete all files in trash permanently
+func EmptyTrash(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	fileStore := store.NewFileStore(userID)
+	files, err := fileStore.EmptyTrash()
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, 200, "", deleteStorageObjects(files))
+}
+
+// deleteStorageObjects delete the objects of files from storage
+// return the delete result message of each file
+func deleteStorageObjects(files []models.StorageFile) []string {
+	app := core.GetApp()
+	messages := []string{}
+	for _, file := range files {
+		err := app.Storage.Delete(file.ObjectName(), file.Bucket)
+		if err != nil {
+			log.Errorf("delete from storage error : %s", err)
+			log.Errorf("delete detail info : %s %s", file.Bucket, file.ObjectName())
+			messages = append(messages, fmt.Sprintf("%s:%s", file.FileName, err))
+			continue
+		}
+		messages = append(messages, fmt.Sprintf("%s:success", file.FileName))
+	}
+	return messages
+}
@@ -0,0 +1,309 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Dudobird/dudo-server/core"
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/store"
+	"github.com/Dudobird/dudo-server/utils"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// resumable upload based on tus protocol
+// https://tus.io/protocols/resumable-upload.html
+const (
+	tusVersion     = "1.0.0"
+	tusExtensions  = "creation,termination"
+	tusContentType = "application/offset+octet-stream"
+	tusUploadsURL  = "/api/tus/uploads/"
+)
+
+// checkTusRequest set the common tus headers and check the client version
+func checkTusRequest(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		utils.JSONRespnseWithErr(w, &utils.ErrTusVersionNotSupported)
+		return false
+	}
+	return true
+}
+
+// parseTusMetadata decode the Upload-Metadata header
+// the format is "key base64value,key2 base64value2"
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, " ", 2)
+		value := ""
+		if len(kv) == 2 {
+			decoded, err := base64.StdEncoding.DecodeString(kv[1])
+			if err != nil {
+				return nil, err
+			}
+			value = string(decoded)
+		}
+		metadata[kv[0]] = value
+	}
+	return metadata, nil
+}
+
+// TusOptions return the tus protocol information of server
+func TusOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// isValidTusFileName return false for empty name and name with path,
+// folders must be sent in X-FilePath like UploadFiles
+func isValidTusFileName(fileName string) bool {
+	if fileName == "" || fileName == "." || fileName == ".." {
+		return false
+	}
+	return !strings.ContainsAny(fileName, "/\\")
+}
+
+// TusCreateUpload create a new resumable upload under folder
+// file name is read from the Upload-Metadata filename key
+// and the folders in X-FilePath will be created like UploadFiles
+func TusCreateUpload(w http.ResponseWriter, r *http.Request) {
+	if checkTusRequest(w, r) == false {
+		return
+	}
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	vars := mux.Vars(r)
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		utils.JSONRespnseWithErr(w, &utils.ErrPostDataNotCorrect)
+		return
+	}
+	metadata, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil || isValidTusFileName(metadata["filename"]) == false {
+		utils.JSONRespnseWithErr(w, &utils.ErrPostDataNotCorrect)
+		return
+	}
+	fileName := metadata["filename"]
+	// file uploaded to shared folder is charged to the owner of folder
+	fileStore := ownerFileStore(w, userID, vars["folderID"], models.PermissionEditor)
+	if fileStore == nil {
+		return
+	}
+	folderID, err := fileStore.GetOrCreateFolder(vars["folderID"], r.Header.Get("X-FilePath"))
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	if exist := fileStore.StorageFileExistUnderFolderID(folderID, fileName); exist == true {
+		utils.JSONRespnseWithErr(w, &utils.ErrResourceAlreadyExist)
+		return
+	}
+	if err := fileStore.CheckDiskQuota(length); err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	upload, err := store.NewFileStore(userID).CreateUpload(fileStore.UserID(), folderID, fileName, getBucketName(userID), length)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	// empty file is complete after create
+	if upload.IsComplete() {
+		if err := completeUpload(upload); err != nil {
+			utils.JSONRespnseWithErr(w, err)
+			return
+		}
+		w.Header().Set("X-FileID", upload.FileID)
+	}
+	w.Header().Set("Location", tusUploadsURL+upload.ID)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// TusGetUploadOffset return the offset of upload for client to resume
+func TusGetUploadOffset(w http.ResponseWriter, r *http.Request) {
+	if checkTusRequest(w, r) == false {
+		return
+	}
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	vars := mux.Vars(r)
+	fileStore := store.NewFileStore(userID)
+	upload, err := fileStore.GetUpload(vars["id"])
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	// retry the upload which fail to complete after all chunks received
+	if upload.IsComplete() && upload.FileID == "" {
+		if err := completeUpload(upload); err != nil {
+			utils.JSONRespnseWithErr(w, err)
+			return
+		}
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.UploadOffset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.UploadLength, 10))
+	if upload.FileID != "" {
+		w.Header().Set("X-FileID", upload.FileID)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// TusPatchUpload receive a chunk of upload and save it to storage
+// the file will be created when all chunks received
+func TusPatchUpload(w http.ResponseWriter, r *http.Request) {
+	if checkTusRequest(w, r) == false {
+		return
+	}
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	vars := mux.Vars(r)
+	if r.Header.Get("Content-Type") != tusContentType {
+		utils.JSONRespnseWithErr(w, &utils.ErrUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		utils.JSONRespnseWithErr(w, &utils.ErrPostDataNotCorrect)
+		return
+	}
+	fileStore := store.NewFileStore(userID)
+	upload, err := fileStore.GetUpload(vars["id"])
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	if offset != upload.UploadOffset || upload.FileID != "" {
+		utils.JSONRespnseWithErr(w, &utils.ErrUploadOffsetConflict)
+		return
+	}
+	// all chunks received but the file is not created, retry to complete it
+	if upload.IsComplete() {
+		if err := completeUpload(upload); err != nil {
+			utils.JSONRespnseWithErr(w, err)
+			return
+		}
+		w.Header().Set("X-FileID", upload.FileID)
+		w.Header().Set("Upload-Offset", strconv.FormatInt(upload.UploadOffset, 10))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	remaining := upload.UploadLength - upload.UploadOffset
+	if r.ContentLength > remaining {
+		utils.JSONRespnseWithErr(w, &utils.ErrUploadLengthExceeded)
+		return
+	}
+	app := core.GetApp()
+	chunkName := upload.NewChunkName()
+	counter := &utils.CountingReader{Reader: io.LimitReader(r.Body, remaining)}
+	_, err = app.Storage.Upload(counter, r.ContentLength, chunkName, upload.Bucket)
+	if err != nil {
+		log.Errorf("save upload chunk fail : %s", err)
+		utils.JSONRespnseWithErr(w, &utils.ErrInternalServerError)
+		return
+	}
+	if counter.Count > 0 {
+		err = fileStore.AddUploadChunk(upload, chunkName, counter.Count)
+	}
+	// chunk of the request lost the offset is never referenced
+	if counter.Count == 0 || err != nil {
+		app.Storage.Delete(chunkName, upload.Bucket)
+		if err != nil {
+			utils.JSONRespnseWithErr(w, err)
+			return
+		}
+	}
+	if upload.IsComplete() {
+		if err := completeUpload(upload); err != nil {
+			utils.JSONRespnseWithErr(w, err)
+			return
+		}
+		w.Header().Set("X-FileID", upload.FileID)
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.UploadOffset, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TusDeleteUpload terminate the upload and delete all received chunks
+func TusDeleteUpload(w http.ResponseWriter, r *http.Request) {
+	if checkTusRequest(w, r) == false {
+		return
+	}
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	vars := mux.Vars(r)
+	fileStore := store.NewFileStore(userID)
+	upload, err := fileStore.GetUpload(vars["id"])
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	// chunks already merged and deleted after upload complete
+	if upload.FileID == "" {
+		deleteUploadChunks(fileStore, upload)
+	}
+	if err := fileStore.DeleteUpload(upload.ID); err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// completeUpload merge all chunks to a new storage file of the file owner
+// uploader must still be editor of the shared folder when upload complete
+func completeUpload(upload *models.Upload) error {
+	app := core.GetApp()
+	fileStore := store.NewFileStore(upload.UserID)
+	if upload.OwnerID != "" && upload.OwnerID != upload.UserID {
+		if _, err := fileStore.GetFileWithPermission(upload.FolderID, models.PermissionEditor); err != nil {
+			return err
+		}
+	}
+	ownerStore := store.NewFileStore(upload.FileOwnerID())
+	if exist := ownerStore.StorageFileExistUnderFolderID(upload.FolderID, upload.FileName); exist == true {
+		return &utils.ErrResourceAlreadyExist
+	}
+	chunks, err := fileStore.GetUploadChunks(upload)
+	if err != nil {
+		return err
+	}
+	readers := []io.Reader{}
+	for _, chunk := range chunks {
+		object, err := app.Storage.Open(chunk.Object, upload.Bucket)
+		if err != nil {
+			log.Errorf("open upload chunk fail : %s", err)
+			return &utils.ErrInternalServerError
+		}
+		defer object.Close()
+		readers = append(readers, object)
+	}
+	id, err := saveFileToStorage(ownerStore, upload.UserID, upload.FolderID, upload.FileName, io.MultiReader(readers...), upload.UploadLength)
+	if err != nil {
+		return err
+	}
+	deleteUploadChunks(fileStore, upload)
+	upload.FileID = id
+	return fileStore.CompleteUpload(upload, id)
+}
+
+func deleteUploadChunks(fileStore *store.FileStore, upload *models.Upload) {
+	app := core.GetApp()
+	chunks, err := fileStore.GetUploadChunks(upload)
+	if err != nil {
+		return
+	}
+	for _, chunk := range chunks {
+		err := app.Storage.Delete(chunk.Object, upload.Bucket)
+		if err != nil {
+			log.Errorf("delete upload chunk %s fail : %s", chunk.Object, err)
+		}
+	}
+}
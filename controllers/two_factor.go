@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/utils"
+)
+
+type twoFactorCodeInfo struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// GetTwoFactorStatus send back if two factor authentication is enabled or required
+func GetTwoFactorStatus(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	status, err := models.GetTwoFactorStatus(userID)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, http.StatusOK, "", status)
+}
+
+// EnrollTwoFactor send back a new TOTP secret and its provisioning uri
+// client should show the uri as QR code for authenticator apps
+func EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	enrollment, err := models.EnrollTwoFactor(userID)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, http.StatusOK, "", enrollment)
+}
+
+// ConfirmTwoFactor enable two factor authentication with a code from authenticator
+// send back the recovery codes, they will not be shown again
+func ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	data := twoFactorCodeInfo{}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil || data.Code == "" {
+		utils.JSONRespnseWithErr(w, &utils.ErrPostDataNotCorrect)
+		return
+	}
+	codes, err := models.ConfirmTwoFactor(userID, data.Code)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, http.StatusOK, "", map[string][]string{"recovery_codes": codes})
+}
+
+// DisableTwoFactor disable two factor authentication
+// user must send the password and a code from authenticator or a recovery code
+func DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	data := twoFactorCodeInfo{}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil || data.Code == "" {
+		utils.JSONRespnseWithErr(w, &utils.ErrPostDataNotCorrect)
+		return
+	}
+	err = models.DisableTwoFactor(userID, data.Password, data.Code)
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, http.StatusOK, "disable two factor authentication success", nil)
+}
@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/utils"
+	"github.com/gorilla/mux"
+)
+
+// ListFileVersions list the old versions of file
+func ListFileVersions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	vars := mux.Vars(r)
+	fileStore := ownerFileStore(w, userID, vars["id"], models.PermissionViewer)
+	if fileStore == nil {
+		return
+	}
+	versions, err := fileStore.ListFileVersions(vars["id"])
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, 200, "", versions)
+}
+
+// DownloadFileVersion send the content of an old version back
+func DownloadFileVersion(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	vars := mux.Vars(r)
+	fileStore := ownerFileStore(w, userID, vars["id"], models.PermissionViewer)
+	if fileStore == nil {
+		return
+	}
+	file, version, err := fileStore.GetFileVersion(vars["id"], vars["versionID"])
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	serveFileContent(w, r, file.FileName, version.MIMEType, version.CreatedAt, version.Path, version.Bucket)
+}
+
+// RestoreFileVersion make an old version as current content of file
+func RestoreFileVersion(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	vars := mux.Vars(r)
+	fileStore := ownerFileStore(w, userID, vars["id"], models.PermissionEditor)
+	if fileStore == nil {
+		return
+	}
+	file, err := fileStore.RestoreFileVersion(vars["id"], vars["versionID"])
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, 200, "", file)
+}
+
+// DeleteFileVersion delete an old version of file permanently
+func DeleteFileVersion(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(utils.TokenContextKey).(string)
+	vars := mux.Vars(r)
+	fileStore := ownerFileStore(w, userID, vars["id"], models.PermissionEditor)
+	if fileStore == nil {
+		return
+	}
+	objects, err := fileStore.DeleteFileVersion(vars["id"], vars["versionID"])
+	if err != nil {
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	utils.JSONMessageWithData(w, 200, "", deleteStorageObjects(objects))
+}
@@ -2,14 +2,19 @@ package core
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/Dudobird/dudo-server/migrations"
 	"github.com/Dudobird/dudo-server/models"
 	"github.com/jinzhu/gorm"
 
 	"github.com/Dudobird/dudo-server/config"
+	"github.com/Dudobird/dudo-server/mail"
+	"github.com/Dudobird/dudo-server/oidc"
 	"github.com/Dudobird/dudo-server/storage"
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
@@ -23,6 +28,8 @@ type App struct {
 	Router         *mux.Router
 	DB             *gorm.DB
 	Storage        storage.Storage
+	Mailer         mail.Mailer
+	OIDC           *oidc.Provider
 	FullTempFolder string
 }
 
@@ -50,8 +57,15 @@ func (app *App) Run() {
 	log.Println("server start listen at:", hostAndPort)
 	c := cors.New(cors.Options{
 		AllowCredentials: true,
-		AllowedMethods:   []string{"GET", "POST", "DELETE", "PUT"},
-		AllowedHeaders:   []string{"Authorization", "Content-Type", "X-FilePath"},
+		AllowedMethods:   []string{"GET", "POST", "DELETE", "PUT", "PATCH", "HEAD", "OPTIONS"},
+		AllowedHeaders: []string{
+			"Authorization", "Content-Type", "X-FilePath", "X-File-Size",
+			"Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata",
+		},
+		ExposedHeaders: []string{
+			"Location", "X-FileID",
+			"Tus-Resumable", "Tus-Version", "Tus-Extension", "Upload-Length", "Upload-Offset",
+		},
 	})
 	err := http.ListenAndServe(hostAndPort, c.Handler(app.Router))
 	if err != nil {
@@ -59,6 +73,42 @@ func (app *App) Run() {
 	}
 }
 
+// Migrate check the database schema is up to date
+// pending migrations are applied when apply = true, or return error
+// default data is inserted after database schema is ready
+func (app *App) Migrate(apply bool) error {
+	pending, err := migrations.Pending(app.DB)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		if apply == false {
+			return fmt.Errorf("%d database migrations are pending, run `dudo migrate up` first", len(pending))
+		}
+		if _, err := migrations.Up(app.DB, 0); err != nil {
+			return err
+		}
+	}
+	return models.InsertDefaultData(app.DB)
+}
+
+// UserBucketName return the storage bucket name of user
+func (app *App) UserBucketName(userID string) string {
+	// bucket name has some restrict
+	// https://docs.aws.amazon.com/AmazonS3/latest/dev/BucketRestrictions.html
+	return fmt.Sprintf(
+		"%s-%s",
+		app.Config.Application.BucketPrefix,
+		strings.ToLower(strings.TrimLeft(userID, "user_")),
+	)
+}
+
+// BlobBucketName return the storage bucket name for file contents
+// contents are shared between users so all blobs are saved in one bucket
+func (app *App) BlobBucketName() string {
+	return fmt.Sprintf("%s-blobs", app.Config.Application.BucketPrefix)
+}
+
 // Init load the config file and init the database connection
 func (app *App) init(configFile string) (err error) {
 	if configFile == "" {
@@ -75,12 +125,10 @@ func (app *App) init(configFile string) (err error) {
 	if err != nil {
 		return
 	}
-	err = models.InsertDefaultData(db)
-	if err != nil {
-		return
-	}
 	app.DB = db
 	app.Storage = storage.InitStorageManager()
+	app.Mailer = mail.InitMailer()
+	app.OIDC = oidc.InitProvider()
 	if err != nil {
 		return
 	}
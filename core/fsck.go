@@ -0,0 +1,141 @@
+package core
+
+import (
+	"sort"
+
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/store"
+	log "github.com/sirupsen/logrus"
+)
+
+// FsckObject is a object in storage
+type FsckObject struct {
+	Bucket string `json:"bucket"`
+	Object string `json:"object"`
+}
+
+// FsckReport is the result of consistency check between database and storage
+type FsckReport struct {
+	// MissingObjects are records whose object not exist in storage
+	MissingObjects []store.ObjectRef `json:"missing_objects"`
+	// OrphanObjects are objects in storage without any record
+	OrphanObjects []FsckObject `json:"orphan_objects"`
+	// OrphanFiles are files and folders whose parent folder not exist
+	OrphanFiles []models.StorageFile `json:"orphan_files"`
+	// UsageMismatches are users whose disk usage is not correct
+	UsageMismatches []store.UsageMismatch `json:"usage_mismatches"`
+	Repaired        bool                  `json:"repaired"`
+}
+
+// HasProblems return true when any problem is found
+func (r *FsckReport) HasProblems() bool {
+	return len(r.MissingObjects) > 0 || len(r.OrphanObjects) > 0 ||
+		len(r.OrphanFiles) > 0 || len(r.UsageMismatches) > 0
+}
+
+// Fsck check the records in database and the objects in storage
+// problems are fixed when repair = true:
+// records with missing object are deleted, orphan objects are deleted,
+// orphan files are moved to trash and disk usage is recalculated
+// it should run when no user is uploading files
+func (app *App) Fsck(repair bool) (*FsckReport, error) {
+	report := &FsckReport{
+		MissingObjects: []store.ObjectRef{},
+		OrphanObjects:  []FsckObject{},
+		Repaired:       repair,
+	}
+	refs, err := store.ListObjectRefs()
+	if err != nil {
+		return nil, err
+	}
+	objects, err := app.listAllObjects(refs)
+	if err != nil {
+		return nil, err
+	}
+	referenced := map[FsckObject]bool{}
+	for _, ref := range refs {
+		object := FsckObject{Bucket: ref.Bucket, Object: ref.Object}
+		referenced[object] = true
+		if objects[object] == false {
+			report.MissingObjects = append(report.MissingObjects, ref)
+		}
+	}
+	for object := range objects {
+		if referenced[object] == false {
+			report.OrphanObjects = append(report.OrphanObjects, object)
+		}
+	}
+	sort.Slice(report.OrphanObjects, func(i, j int) bool {
+		a, b := report.OrphanObjects[i], report.OrphanObjects[j]
+		return a.Bucket < b.Bucket || (a.Bucket == b.Bucket && a.Object < b.Object)
+	})
+	if report.OrphanFiles, err = store.FindOrphanFiles(); err != nil {
+		return nil, err
+	}
+	if repair {
+		if err := app.repairFsckProblems(report); err != nil {
+			return nil, err
+		}
+	}
+	// usage is checked after other problems fixed
+	if report.UsageMismatches, err = store.FindUsageMismatches(); err != nil {
+		return nil, err
+	}
+	if repair {
+		for _, mismatch := range report.UsageMismatches {
+			if err := store.FixDiskUsage(mismatch); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return report, nil
+}
+
+// listAllObjects return all objects in the buckets used by dudo
+// which are the blob bucket, the buckets of users and the
+// buckets referenced by records
+func (app *App) listAllObjects(refs []store.ObjectRef) (map[FsckObject]bool, error) {
+	userIDs := []string{}
+	err := app.DB.Unscoped().Model(&models.User{}).Pluck("id", &userIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	buckets := map[string]bool{app.BlobBucketName(): true}
+	for _, id := range userIDs {
+		buckets[app.UserBucketName(id)] = true
+	}
+	for _, ref := range refs {
+		buckets[ref.Bucket] = true
+	}
+	objects := map[FsckObject]bool{}
+	for bucket := range buckets {
+		names, err := app.Storage.ListObjects(bucket)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			objects[FsckObject{Bucket: bucket, Object: name}] = true
+		}
+	}
+	return objects, nil
+}
+
+// repairFsckProblems fix the problems found in report except disk usage
+func (app *App) repairFsckProblems(report *FsckReport) error {
+	deleteObjects, err := store.DeleteObjectRefs(report.MissingObjects)
+	if err != nil {
+		return err
+	}
+	// objects of versions deleted with file and chunks of deleted uploads are also deleted
+	for _, file := range deleteObjects {
+		if err := app.Storage.Delete(file.ObjectName(), file.Bucket); err != nil {
+			log.Errorf("delete %s from bucket %s fail: %s", file.ObjectName(), file.Bucket, err)
+		}
+	}
+	for _, object := range report.OrphanObjects {
+		if err := app.Storage.Delete(object.Object, object.Bucket); err != nil {
+			log.Errorf("delete %s from bucket %s fail: %s", object.Object, object.Bucket, err)
+		}
+	}
+	return store.TrashOrphanFiles(report.OrphanFiles)
+}
@@ -0,0 +1,46 @@
+package core
+
+import (
+	"time"
+
+	"github.com/Dudobird/dudo-server/store"
+	log "github.com/sirupsen/logrus"
+)
+
+// trashPurgeInterval is the interval of checking expired files in trash
+const trashPurgeInterval = time.Hour
+
+// StartTrashPurger start a background job to delete the files
+// in trash permanently after the retention days
+func (app *App) StartTrashPurger() {
+	days := app.Config.Application.TrashRetentionDays
+	if days <= 0 {
+		log.Infoln("trash purger is disabled")
+		return
+	}
+	go func() {
+		for {
+			app.PurgeTrash(time.Now().AddDate(0, 0, -days))
+			time.Sleep(trashPurgeInterval)
+		}
+	}()
+}
+
+// PurgeTrash delete the files moved to trash before time
+// from database and storage
+func (app *App) PurgeTrash(before time.Time) {
+	files, err := store.PurgeTrash(before)
+	if err != nil {
+		log.Errorf("purge trash fail: %s", err)
+		return
+	}
+	for _, file := range files {
+		err := app.Storage.Delete(file.ObjectName(), file.Bucket)
+		if err != nil {
+			log.Errorf("delete %s from bucket %s fail: %s", file.ObjectName(), file.Bucket, err)
+		}
+	}
+	if len(files) > 0 {
+		log.Infof("purge %d files from trash", len(files))
+	}
+}
@@ -0,0 +1,175 @@
+package e2e
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/utils"
+)
+
+func getUsageDiskSize(userID string) uint64 {
+	profile := models.Profile{}
+	models.GetDB().Where("user_id = ?", userID).First(&profile)
+	return profile.UsageDiskSize
+}
+
+func TestDeduplicateFiles(t *testing.T) {
+	app := GetTestApp()
+	userResponse, _ := signUpTestUser(app)
+	token := userResponse.Data.Token
+	otherResponse, err := signUp(&models.User{Email: "other@example.com", Password: "123456"})
+	utils.OK(t, err)
+	defer func() {
+		tearDownUser(app)
+		tearDownStorages()
+	}()
+	folders, files := setUpRealFiles(token)
+	content, err := ioutil.ReadFile("./files/1.file")
+	utils.OK(t, err)
+	rr := uploadFile("/api/upload/files/root", otherResponse.Data.Token, "1.file", string(content), nil)
+	utils.Equals(t, http.StatusCreated, rr.Code)
+
+	// 1.file uploaded three times but saved only once
+	sameFiles := []models.StorageFile{}
+	models.GetDB().Where("file_name = ?", "1.file").Find(&sameFiles)
+	utils.Equals(t, 3, len(sameFiles))
+	for _, f := range sameFiles {
+		utils.Equals(t, files["1.file"].Hash, f.Hash)
+		utils.Equals(t, files["1.file"].Path, f.Path)
+	}
+	var counter int
+	models.GetDB().Model(&models.Blob{}).Count(&counter)
+	utils.Equals(t, 3, counter)
+	blob := models.Blob{}
+	models.GetDB().Where("hash = ?", files["1.file"].Hash).First(&blob)
+	utils.Equals(t, int64(3), blob.RefCount)
+
+	// each user still use their logical size
+	utils.Equals(t, uint64(4*14), getUsageDiskSize(userResponse.Data.ID))
+	utils.Equals(t, uint64(14), getUsageDiskSize(otherResponse.Data.ID))
+
+	deleteAndDownload := func(id string, downloadID string, downloadCode int) {
+		// content is released after trash emptied
+		for _, url := range []string{"/api/files/" + id, "/api/trash"} {
+			utils.Equals(t, http.StatusOK, doRequest("DELETE", url, token).Code)
+		}
+		utils.Equals(t, downloadCode, doRequest("GET", "/api/download/files/"+downloadID, otherResponse.Data.Token).Code)
+	}
+	otherFile := models.StorageFile{}
+	models.GetDB().Where("user_id = ?", otherResponse.Data.ID).First(&otherFile)
+
+	// content still exist when other files use it
+	deleteAndDownload(folders["backup"].ID, otherFile.ID, http.StatusOK)
+	deleteAndDownload(files["1.file"].ID, otherFile.ID, http.StatusOK)
+	models.GetDB().Where("hash = ?", files["1.file"].Hash).First(&blob)
+	utils.Equals(t, int64(1), blob.RefCount)
+
+	// object is deleted with the last reference
+	for _, url := range []string{"/api/files/" + otherFile.ID, "/api/trash"} {
+		utils.Equals(t, http.StatusOK, doRequest("DELETE", url, otherResponse.Data.Token).Code)
+	}
+	models.GetDB().Model(&models.Blob{}).Where("hash = ?", files["1.file"].Hash).Count(&counter)
+	utils.Equals(t, 0, counter)
+	_, err = app.Storage.Open(otherFile.Path, otherFile.Bucket)
+	utils.Assert(t, err != nil, "object should be deleted from storage")
+}
+
+func TestUploadFilesWithHash(t *testing.T) {
+	app := GetTestApp()
+	userResponse, _ := signUpTestUser(app)
+	token := userResponse.Data.Token
+	defer func() {
+		tearDownUser(app)
+		tearDownStorages()
+	}()
+	folders, files := setUpRealFiles(token)
+	hash := files["1.file"].Hash
+	testCases := []struct {
+		folderID   string
+		body       string
+		statuscode int
+	}{
+		{
+			folderID:   "root",
+			body:       `{"file_name":"1.file","file_size":14,"hash":"` + hash + `"}`,
+			statuscode: http.StatusCreated,
+		},
+		{
+			// name conflict in folder
+			folderID:   folders["files"].ID,
+			body:       `{"file_name":"1.file","file_size":14,"hash":"` + hash + `"}`,
+			statuscode: http.StatusBadRequest,
+		},
+		{
+			folderID:   "root",
+			body:       `{"file_name":"wrong-size.file","file_size":15,"hash":"` + hash + `"}`,
+			statuscode: http.StatusBadRequest,
+		},
+		{
+			folderID:   "root",
+			body:       `{"file_name":"not-exist.file","file_size":14,"hash":"` + strings.Repeat("0", 64) + `"}`,
+			statuscode: http.StatusNotFound,
+		},
+		{
+			folderID:   "root",
+			body:       `{"file_name":"bad-hash.file","file_size":14,"hash":"123"}`,
+			statuscode: http.StatusBadRequest,
+		},
+	}
+	var fileID string
+	for _, tc := range testCases {
+		req, _ := http.NewRequest("POST", "/api/upload/hash/"+tc.folderID, strings.NewReader(tc.body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+		utils.Equals(t, tc.statuscode, rr.Code)
+		if rr.Code == http.StatusCreated {
+			message := struct {
+				Data string `json:"data"`
+			}{}
+			utils.OK(t, json.NewDecoder(rr.Body).Decode(&message))
+			fileID = message.Data
+		}
+	}
+	rr := doRequest("GET", "/api/download/files/"+fileID, token)
+	utils.Equals(t, http.StatusOK, rr.Code)
+	utils.Equals(t, "this is 1.file", rr.Body.String())
+	utils.Equals(t, uint64(5*14), getUsageDiskSize(userResponse.Data.ID))
+	blob := models.Blob{}
+	models.GetDB().Where("hash = ?", hash).First(&blob)
+	utils.Equals(t, int64(3), blob.RefCount)
+
+	// quota is checked before create file
+	models.GetDB().Model(&models.Profile{}).Where("user_id = ?", userResponse.Data.ID).Update("disk_limit", 5*14+1)
+	req, _ := http.NewRequest("POST", "/api/upload/hash/root", strings.NewReader(
+		`{"file_name":"quota.file","file_size":14,"hash":"`+hash+`"}`,
+	))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr = httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+	utils.Equals(t, http.StatusInsufficientStorage, rr.Code)
+
+	// content of others is same as not exist
+	otherResponse, err := signUp(&models.User{Email: "other@example.com", Password: "123456"})
+	utils.OK(t, err)
+	responses := []string{}
+	for _, h := range []string{hash, strings.Repeat("0", 64)} {
+		req, _ = http.NewRequest("POST", "/api/upload/hash/root", strings.NewReader(
+			`{"file_name":"other.file","file_size":14,"hash":"`+h+`"}`,
+		))
+		req.Header.Set("Authorization", "Bearer "+otherResponse.Data.Token)
+		rr = httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+		utils.Equals(t, http.StatusNotFound, rr.Code)
+		responses = append(responses, rr.Body.String())
+	}
+	utils.Equals(t, responses[0], responses[1])
+	var counter int
+	models.GetDB().Model(&models.StorageFile{}).Where("user_id = ?", otherResponse.Data.ID).Count(&counter)
+	utils.Equals(t, 0, counter)
+}
@@ -0,0 +1,211 @@
+package e2e
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/utils"
+)
+
+type fileRequestResponse struct {
+	ID                string   `json:"id"`
+	Token             string   `json:"token"`
+	AllowedExtensions []string `json:"allowed_extensions"`
+	PasswordProtected bool     `json:"password_protected"`
+	UploadCount       int      `json:"upload_count"`
+}
+
+type fileRequestUploadResponse struct {
+	FileName string `json:"file_name"`
+	FileSize int64  `json:"file_size"`
+}
+
+func createFileRequest(t *testing.T, token, body string) *fileRequestResponse {
+	request := &fileRequestResponse{}
+	utils.Equals(t, http.StatusCreated, doJSON("POST", "/api/requests", token, body, request))
+	utils.Assert(t, request.Token != "", "token of file request should be returned")
+	return request
+}
+
+// uploadToFileRequest upload the content as file with file request token
+func uploadToFileRequest(requestToken, fileName, content string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	values := []string{}
+	for _, cookie := range cookies {
+		values = append(values, cookie.Name+"="+cookie.Value)
+	}
+	headers := map[string]string{}
+	if len(values) > 0 {
+		headers["Cookie"] = strings.Join(values, "; ")
+	}
+	return uploadFile("/requests/upload?token="+requestToken, "", fileName, content, headers)
+}
+
+// getFileRequestFiles return the files shown to uploader of file request
+func getFileRequestFiles(t *testing.T, requestToken string, cookies ...*http.Cookie) []fileRequestUploadResponse {
+	req := httptest.NewRequest("GET", "/requests?token="+requestToken, nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+	utils.Equals(t, http.StatusOK, rr.Code)
+	message := struct {
+		Data struct {
+			Files []fileRequestUploadResponse `json:"files"`
+		} `json:"data"`
+	}{}
+	utils.OK(t, json.NewDecoder(rr.Body).Decode(&message))
+	return message.Data.Files
+}
+
+func TestFileRequest(t *testing.T) {
+	app := GetTestApp()
+	userResponse, _ := signUpTestUser(app)
+	token := userResponse.Data.Token
+	folders, files := setUpRealFiles(token)
+	defer func() {
+		tearDownUser(app)
+		tearDownStorages()
+	}()
+	folderID := folders["empty"].ID
+	testCases := []struct {
+		body       string
+		statuscode int
+	}{
+		{body: fmt.Sprintf(`{"folder_id":"%s"}`, folderID), statuscode: http.StatusBadRequest},
+		{body: fmt.Sprintf(`{"folder_id":"%s","expire_days":91}`, folderID), statuscode: http.StatusBadRequest},
+		{body: fmt.Sprintf(`{"folder_id":"%s","expire_days":7,"max_file_size":-1}`, folderID), statuscode: http.StatusBadRequest},
+		{body: fmt.Sprintf(`{"folder_id":"%s","expire_days":7,"allowed_extensions":[""]}`, folderID), statuscode: http.StatusBadRequest},
+		{body: fmt.Sprintf(`{"folder_id":"%s","expire_days":7}`, files["2.file"].ID), statuscode: http.StatusBadRequest},
+		{body: `{"folder_id":"not-exist","expire_days":7}`, statuscode: http.StatusNotFound},
+	}
+	for _, tc := range testCases {
+		utils.Equals(t, tc.statuscode, doJSON("POST", "/api/requests", token, tc.body, nil))
+	}
+	request := createFileRequest(t, token, fmt.Sprintf(
+		`{"folder_id":"%s","title":"contracts","expire_days":7,"max_file_size":20,"allowed_extensions":[".TXT","pdf","txt"]}`,
+		folderID,
+	))
+	utils.Equals(t, []string{"txt", "pdf"}, request.AllowedExtensions)
+	utils.Equals(t, 0, len(getFileRequestFiles(t, request.Token)))
+
+	profile := &models.Profile{}
+	utils.OK(t, app.DB.Where("user_id = ?", UserID).First(profile).Error)
+	usage := profile.UsageDiskSize
+
+	rr := uploadToFileRequest(request.Token, "a.txt", "hello")
+	utils.Equals(t, http.StatusCreated, rr.Code)
+	cookies := rr.Result().Cookies()
+	utils.Equals(t, 1, len(cookies))
+	// same name is renamed
+	rr = uploadToFileRequest(request.Token, "a.txt", "world", cookies...)
+	utils.Equals(t, http.StatusCreated, rr.Code)
+	upload := &fileRequestUploadResponse{}
+	message := struct {
+		Data interface{} `json:"data"`
+	}{Data: upload}
+	utils.OK(t, json.NewDecoder(rr.Body).Decode(&message))
+	utils.Equals(t, "a (1).txt", upload.FileName)
+	utils.Equals(t, int64(5), upload.FileSize)
+
+	utils.Equals(t, http.StatusUnsupportedMediaType, uploadToFileRequest(request.Token, "a.exe", "hello").Code)
+	utils.Equals(t, http.StatusRequestEntityTooLarge, uploadToFileRequest(request.Token, "big.txt", "this content is larger than limit").Code)
+	utils.Equals(t, http.StatusNotFound, uploadToFileRequest("not-exist", "a.txt", "hello").Code)
+
+	// files are saved in folder of owner and counted in disk usage
+	uploaded := []models.StorageFile{}
+	utils.OK(t, app.DB.Where("folder_id = ? and user_id = ?", folderID, UserID).Order("file_name").Find(&uploaded).Error)
+	utils.Equals(t, 2, len(uploaded))
+	utils.Equals(t, "a (1).txt", uploaded[0].FileName)
+	utils.Equals(t, "a.txt", uploaded[1].FileName)
+	utils.OK(t, app.DB.Where("user_id = ?", UserID).First(profile).Error)
+	utils.Equals(t, usage+10, profile.UsageDiskSize)
+
+	// uploaders only see their own files
+	utils.Equals(t, 2, len(getFileRequestFiles(t, request.Token, cookies...)))
+	utils.Equals(t, 0, len(getFileRequestFiles(t, request.Token)))
+	rr = uploadToFileRequest(request.Token, "b.pdf", "other")
+	utils.Equals(t, http.StatusCreated, rr.Code)
+	utils.Equals(t, 1, len(getFileRequestFiles(t, request.Token, rr.Result().Cookies()...)))
+
+	requests := []fileRequestResponse{}
+	utils.Equals(t, http.StatusOK, doJSON("GET", "/api/requests", token, "", &requests))
+	utils.Equals(t, 1, len(requests))
+	utils.Equals(t, 3, requests[0].UploadCount)
+	utils.Equals(t, "", requests[0].Token)
+
+	// all uploads are shown when owner allow it
+	shown := createFileRequest(t, token, fmt.Sprintf(`{"folder_id":"%s","expire_days":7,"show_uploads":true}`, folderID))
+	utils.Equals(t, http.StatusCreated, uploadToFileRequest(shown.Token, "c.txt", "one").Code)
+	utils.Equals(t, http.StatusCreated, uploadToFileRequest(shown.Token, "d.txt", "two").Code)
+	utils.Equals(t, 2, len(getFileRequestFiles(t, shown.Token)))
+	// deleted files are not shown
+	app.DB.Where("file_name = ?", "d.txt").Delete(&models.StorageFile{})
+	utils.Equals(t, 1, len(getFileRequestFiles(t, shown.Token)))
+
+	// owner quota is checked
+	utils.OK(t, app.DB.Where("user_id = ?", UserID).First(profile).Error)
+	app.DB.Model(&models.Profile{}).Where("user_id = ?", UserID).Update("usage_disk_size", profile.DiskLimit-1)
+	utils.Equals(t, http.StatusInsufficientStorage, uploadToFileRequest(shown.Token, "e.txt", "hello").Code)
+	app.DB.Model(&models.Profile{}).Where("user_id = ?", UserID).Update("usage_disk_size", profile.UsageDiskSize)
+
+	// expired request can not be used
+	app.DB.Model(&models.FileRequest{}).Where("id = ?", shown.ID).Update("expires_at", time.Now().Add(-time.Minute))
+	utils.Equals(t, http.StatusGone, uploadToFileRequest(shown.Token, "e.txt", "hello").Code)
+
+	// delete request keep the uploaded files
+	utils.Equals(t, http.StatusOK, doJSON("DELETE", "/api/requests/"+request.ID, token, "", nil))
+	utils.Equals(t, http.StatusNotFound, doJSON("DELETE", "/api/requests/"+request.ID, token, "", nil))
+	utils.Equals(t, http.StatusNotFound, uploadToFileRequest(request.Token, "a.txt", "hello").Code)
+	count := 0
+	app.DB.Model(&models.StorageFile{}).Where("folder_id = ?", folderID).Count(&count)
+	utils.Equals(t, 4, count)
+}
+
+func TestPasswordProtectedFileRequest(t *testing.T) {
+	app := GetTestApp()
+	userResponse, _ := signUpTestUser(app)
+	token := userResponse.Data.Token
+	folders, _ := setUpRealFiles(token)
+	defer func() {
+		tearDownUser(app)
+		tearDownStorages()
+	}()
+	request := createFileRequest(t, token, fmt.Sprintf(
+		`{"folder_id":"%s","expire_days":7,"password":"secret"}`, folders["empty"].ID,
+	))
+	utils.Assert(t, request.PasswordProtected, "file request should be protected by password")
+	utils.Equals(t, http.StatusUnauthorized, doJSON("GET", "/requests?token="+request.Token, "", "", nil))
+	utils.Equals(t, http.StatusUnauthorized, uploadToFileRequest(request.Token, "a.txt", "hello").Code)
+
+	unlock := func(password string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"token": request.Token, "password": password})
+		req := httptest.NewRequest("POST", "/requests/unlock", bytes.NewBuffer(body))
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+		return rr
+	}
+	utils.Equals(t, http.StatusForbidden, unlock("wrong").Code)
+	rr := unlock("secret")
+	utils.Equals(t, http.StatusOK, rr.Code)
+	cookies := rr.Result().Cookies()
+	rr = uploadToFileRequest(request.Token, "a.txt", "hello", cookies...)
+	utils.Equals(t, http.StatusCreated, rr.Code)
+	cookies = append(cookies, rr.Result().Cookies()...)
+	utils.Equals(t, 1, len(getFileRequestFiles(t, request.Token, cookies...)))
+
+	forged := &http.Cookie{Name: "dudo_request_" + request.ID, Value: "not-valid"}
+	utils.Equals(t, http.StatusUnauthorized, uploadToFileRequest(request.Token, "b.txt", "hello", forged).Code)
+	for i := 0; i < 4; i++ {
+		utils.Equals(t, http.StatusForbidden, unlock("wrong").Code)
+	}
+	utils.Equals(t, http.StatusTooManyRequests, unlock("wrong").Code)
+	utils.Equals(t, http.StatusTooManyRequests, unlock("secret").Code)
+}
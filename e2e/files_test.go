@@ -1,6 +1,8 @@
 package e2e
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"io"
 	"io/ioutil"
@@ -8,6 +10,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sync"
 	"testing"
 
 	"github.com/Dudobird/dudo-server/models"
@@ -52,10 +55,51 @@ func TestUploadFiles(t *testing.T) {
 		rr, _ := fileUploadRequest(tc.url, tc.formDataName, tc.localPath, tc.token, "")
 		utils.Equals(t, tc.statusCode, rr.Code)
 	}
+	// size and mime type are caculated while streaming to storage
+	s := &models.StorageFile{}
+	models.GetDB().Model(&models.StorageFile{}).Where("file_name = ? and user_id = ?", "1.file", userResponse.Data.ID).First(s)
+	utils.Equals(t, int64(len("this is 1.file")), s.FileSize)
+	utils.Equals(t, "text/plain; charset=utf-8", s.MIMEType)
 	tearDownUser(app)
 	tearDownStorages()
 }
 
+func TestConcurrentUploadSameName(t *testing.T) {
+	app := GetTestApp()
+	userResponse, _ := signUpTestUser(app)
+	token := userResponse.Data.Token
+	defer func() {
+		tearDownUser(app)
+		tearDownStorages()
+	}()
+	headers := map[string]string{"X-FilePath": base64.StdEncoding.EncodeToString([]byte("/a/b/same.file"))}
+	statuses := make(chan int, 8)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses <- uploadFile("/api/upload/files/root", token, "same.file", "same", headers).Code
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+	created := 0
+	for status := range statuses {
+		if status == http.StatusCreated {
+			created++
+			continue
+		}
+		utils.Equals(t, http.StatusBadRequest, status)
+	}
+	utils.Equals(t, 1, created)
+	for _, name := range []string{"a", "b", "same.file"} {
+		var counter int
+		app.DB.Model(&models.StorageFile{}).Where("file_name = ? and user_id = ?", name, userResponse.Data.ID).Count(&counter)
+		utils.Equals(t, 1, counter)
+	}
+}
+
 func TestUploadFilesWithFoldersPath(t *testing.T) {
 	app := GetTestApp()
 	userResponse, _ := signUpTestUser(app)
@@ -190,6 +234,75 @@ func TestDownloadFilesWithID(t *testing.T) {
 
 }
 
+func TestDownloadFilesWithRange(t *testing.T) {
+	app := GetTestApp()
+	userResponse, _ := signUpTestUser(app)
+	token := userResponse.Data.Token
+	_, files := setUpRealFiles(token)
+	defer func() {
+		tearDownUser(app)
+		tearDownStorages()
+	}()
+	lastModified := files["1.file"].UpdatedAt.UTC().Format(http.TimeFormat)
+	testCases := []struct {
+		headers       map[string]string
+		statusCode    int
+		content       string
+		contentLength string
+	}{
+		{
+			headers:       map[string]string{},
+			statusCode:    200,
+			content:       "this is 1.file",
+			contentLength: "14",
+		},
+		{
+			headers:       map[string]string{"Range": "bytes=8-"},
+			statusCode:    206,
+			content:       "1.file",
+			contentLength: "6",
+		},
+		{
+			headers:       map[string]string{"Range": "bytes=0-3", "If-Range": lastModified},
+			statusCode:    206,
+			content:       "this",
+			contentLength: "4",
+		},
+		{
+			// file changed after If-Range date will send the whole file
+			headers:       map[string]string{"Range": "bytes=0-3", "If-Range": "Mon, 02 Jan 2006 15:04:05 GMT"},
+			statusCode:    200,
+			content:       "this is 1.file",
+			contentLength: "14",
+		},
+		{
+			headers:    map[string]string{"Range": "bytes=100-"},
+			statusCode: 416,
+		},
+		{
+			headers:    map[string]string{"If-Modified-Since": lastModified},
+			statusCode: 304,
+		},
+	}
+	for _, tc := range testCases {
+		req, _ := http.NewRequest("GET", "/api/download/files/"+files["1.file"].ID, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		for k, v := range tc.headers {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+		utils.Equals(t, tc.statusCode, rr.Code)
+		if tc.content != "" {
+			utils.Equals(t, tc.content, rr.Body.String())
+			utils.Equals(t, tc.contentLength, rr.Header().Get("Content-Length"))
+			utils.Equals(t, "bytes", rr.Header().Get("Accept-Ranges"))
+			utils.Equals(t, lastModified, rr.Header().Get("Last-Modified"))
+			utils.Equals(t, files["1.file"].MIMEType, rr.Header().Get("Content-Type"))
+		}
+	}
+}
+
 func TestListCurrentFileWithID(t *testing.T) {
 	app := GetTestApp()
 	userResponse, _ := signUpTestUser(app)
@@ -453,3 +566,60 @@ func TestDeleteFilesWithID(t *testing.T) {
 	models.GetDB().Model(models.StorageFile{}).Count(&counter)
 	utils.Equals(t, 2, counter)
 }
+
+func TestSearchFiles(t *testing.T) {
+	app := GetTestApp()
+	userResponse, _ := signUpTestUser(app)
+	token := userResponse.Data.Token
+	defer func() {
+		tearDownUser(app)
+		tearDownStorages()
+	}()
+	folders, _ := setUpRealFiles(token)
+	testCases := []struct {
+		search     string
+		statuscode int
+		parents    map[string]string
+	}{
+		{
+			search:     "1.FILE",
+			statuscode: 200,
+			parents: map[string]string{
+				folders["files"].ID:  "files",
+				folders["backup"].ID: "backup",
+			},
+		},
+		{
+			// top level folder has no parent
+			search:     "empty",
+			statuscode: 200,
+			parents:    map[string]string{"": ""},
+		},
+		{
+			search:     "",
+			statuscode: 400,
+		},
+	}
+	for _, tc := range testCases {
+		req, _ := http.NewRequest("POST", "/api/search/files", bytes.NewBufferString(`{"search":"`+tc.search+`"}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+		utils.Equals(t, tc.statuscode, rr.Code)
+		if rr.Code != 200 {
+			continue
+		}
+		message := struct {
+			Data []struct {
+				ParentID       string `json:"parent_id"`
+				ParentFileName string `json:"parent_filename"`
+			} `json:"data"`
+		}{}
+		utils.OK(t, json.NewDecoder(rr.Body).Decode(&message))
+		parents := make(map[string]string)
+		for _, result := range message.Data {
+			parents[result.ParentID] = result.ParentFileName
+		}
+		utils.Equals(t, tc.parents, parents)
+	}
+}
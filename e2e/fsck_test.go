@@ -0,0 +1,141 @@
+package e2e
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Dudobird/dudo-server/core"
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/store"
+	"github.com/Dudobird/dudo-server/utils"
+)
+
+func TestFsck(t *testing.T) {
+	app := GetTestApp()
+	userResponse, _ := signUpTestUser(app)
+	token := userResponse.Data.Token
+	userID := userResponse.Data.ID
+	defer func() {
+		tearDownUser(app)
+		tearDownStorages()
+	}()
+	_, files := setUpRealFiles(token)
+	report, err := app.Fsck(false)
+	utils.OK(t, err)
+	utils.Assert(t, report.HasProblems() == false, "no problem should be found: %+v", report)
+
+	// object of 2.file is lost
+	utils.OK(t, app.Storage.Delete(files["2.file"].Path, files["2.file"].Bucket))
+	// object without record
+	bucket := app.UserBucketName(userID)
+	_, err = app.Storage.Upload(strings.NewReader("orphan"), 6, "orphan_object", bucket)
+	utils.OK(t, err)
+	// folder whose parent is deleted
+	orphan := &models.StorageFile{
+		UserID: userID,
+		RawStorageFileInfo: models.RawStorageFileInfo{
+			ID:       "folder_orphan",
+			FileName: "orphan",
+			IsDir:    true,
+			FolderID: "folder_notexist",
+		},
+	}
+	utils.OK(t, models.GetDB().Create(orphan).Error)
+	models.GetDB().Model(&models.Profile{}).Where("user_id = ?", userID).Update("usage_disk_size", 999)
+
+	report, err = app.Fsck(false)
+	utils.OK(t, err)
+	utils.Equals(t, 2, len(report.MissingObjects))
+	for _, ref := range report.MissingObjects {
+		utils.Equals(t, files["2.file"].Path, ref.Object)
+		utils.Assert(t, ref.Kind == store.ObjectRefFile || ref.Kind == store.ObjectRefBlob, "unexpected ref %+v", ref)
+	}
+	utils.Equals(t, []core.FsckObject{{Bucket: bucket, Object: "orphan_object"}}, report.OrphanObjects)
+	utils.Equals(t, 1, len(report.OrphanFiles))
+	utils.Equals(t, orphan.ID, report.OrphanFiles[0].ID)
+	utils.Equals(t, []store.UsageMismatch{{UserID: userID, Recorded: 999, Actual: 4 * 14}}, report.UsageMismatches)
+
+	report, err = app.Fsck(true)
+	utils.OK(t, err)
+	utils.Assert(t, report.Repaired, "report should be repaired")
+	// usage is checked after the lost file deleted
+	utils.Equals(t, []store.UsageMismatch{{UserID: userID, Recorded: 999, Actual: 3 * 14}}, report.UsageMismatches)
+	utils.Equals(t, uint64(3*14), getUsageDiskSize(userID))
+	var counter int
+	models.GetDB().Unscoped().Model(&models.StorageFile{}).Where("id = ?", files["2.file"].ID).Count(&counter)
+	utils.Equals(t, 0, counter)
+	_, err = app.Storage.Open("orphan_object", bucket)
+	utils.Assert(t, err != nil, "orphan object should be deleted")
+	models.GetDB().Unscoped().Model(&models.StorageFile{}).Where("id = ? and trash_id = ?", orphan.ID, orphan.ID).Count(&counter)
+	utils.Equals(t, 1, counter)
+
+	report, err = app.Fsck(false)
+	utils.OK(t, err)
+	utils.Assert(t, report.HasProblems() == false, "problems should be repaired: %+v", report)
+}
+
+func TestFsckRepairVersionsAndUploads(t *testing.T) {
+	app := GetTestApp()
+	userResponse, _ := signUpTestUser(app)
+	token := userResponse.Data.Token
+	userID := userResponse.Data.ID
+	defer func() {
+		tearDownUser(app)
+		tearDownStorages()
+	}()
+	_, files := setUpRealFiles(token)
+	// version whose object is lost together with its file
+	version := &models.FileVersion{
+		ID:     "version_lost",
+		FileID: files["2.file"].ID,
+		UserID: userID,
+		Bucket: files["2.file"].Bucket,
+		Path:   "lost_version_object",
+	}
+	utils.OK(t, models.GetDB().Create(version).Error)
+	utils.OK(t, app.Storage.Delete(files["2.file"].Path, files["2.file"].Bucket))
+
+	// upload lost one of its chunks
+	rr := tusRequest("POST", "/api/tus/folders/root", token, map[string]string{
+		"Upload-Length":   "20",
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("tus.file")),
+	}, nil)
+	utils.Equals(t, http.StatusCreated, rr.Code)
+	location := rr.Header().Get("Location")
+	for _, offset := range []string{"0", "5"} {
+		rr = tusRequest("PATCH", location, token, map[string]string{
+			"Content-Type":  "application/offset+octet-stream",
+			"Upload-Offset": offset,
+		}, []byte("chunk"))
+		utils.Equals(t, http.StatusNoContent, rr.Code)
+	}
+	chunks := []models.UploadChunk{}
+	models.GetDB().Order("chunk_index").Find(&chunks)
+	utils.Equals(t, 2, len(chunks))
+	bucket := app.UserBucketName(userID)
+	utils.OK(t, app.Storage.Delete(chunks[0].Object, bucket))
+
+	report, err := app.Fsck(true)
+	utils.OK(t, err)
+	utils.Assert(t, report.Repaired, "report should be repaired")
+	kinds := map[string]int{}
+	for _, ref := range report.MissingObjects {
+		kinds[ref.Kind]++
+	}
+	utils.Equals(t, map[string]int{store.ObjectRefFile: 1, store.ObjectRefBlob: 1, store.ObjectRefVersion: 1, store.ObjectRefUpload: 1}, kinds)
+	var counter int
+	models.GetDB().Model(&models.FileVersion{}).Where("id = ?", version.ID).Count(&counter)
+	utils.Equals(t, 0, counter)
+	models.GetDB().Model(&models.Upload{}).Count(&counter)
+	utils.Equals(t, 0, counter)
+	models.GetDB().Model(&models.UploadChunk{}).Count(&counter)
+	utils.Equals(t, 0, counter)
+	_, err = app.Storage.Open(chunks[1].Object, bucket)
+	utils.Assert(t, err != nil, "other chunks of upload should be deleted")
+
+	report, err = app.Fsck(false)
+	utils.OK(t, err)
+	utils.Assert(t, report.HasProblems() == false, "problems should be repaired: %+v", report)
+}
@@ -16,6 +16,7 @@ import (
 
 	"github.com/Dudobird/dudo-server/controllers"
 	"github.com/Dudobird/dudo-server/core"
+	"github.com/Dudobird/dudo-server/migrations"
 	"github.com/Dudobird/dudo-server/models"
 	"github.com/Dudobird/dudo-server/routers"
 	"github.com/Dudobird/dudo-server/utils"
@@ -38,28 +39,35 @@ func GetTestApp() *core.App {
 	return app
 }
 
-var appModels = []interface{}{
-	&models.User{},
-	&models.Profile{},
-	&models.StorageFile{},
-	&models.ShareFiles{},
-}
-
-// createTables create table automatic
+// createTables create tables by migrations
 func createTables(app *core.App) {
 	log.Println("create tables for test")
-	app.DB.AutoMigrate(appModels...)
+	if err := app.Migrate(true); err != nil {
+		log.Panic(err)
+	}
 	log.Println("data migrate success")
 }
 
-// cleanTables will drop all models tables
+// cleanTables will rollback all migrations
 func cleanTables(app *core.App) {
-	app.DB.DropTable(appModels...)
+	if _, err := migrations.Down(app.DB, len(migrations.All())); err != nil {
+		log.Panic(err)
+	}
 	log.Println("clean all tables success")
 }
 
 func tearDownStorages() {
 	models.GetDB().Unscoped().Model(&models.StorageFile{}).Delete(&models.StorageFile{})
+	models.GetDB().Delete(&models.Upload{})
+	models.GetDB().Delete(&models.UploadChunk{})
+	models.GetDB().Delete(&models.Blob{})
+	models.GetDB().Delete(&models.FileVersion{})
+	models.GetDB().Unscoped().Delete(&models.ShareFiles{})
+	models.GetDB().Delete(&models.ShareAccessLog{})
+	models.GetDB().Delete(&models.FileRequest{})
+	models.GetDB().Delete(&models.FileRequestUpload{})
+	models.GetDB().Delete(&models.FilePermission{})
+	GetTestApp().Storage.RemoveBucket("dudotest-blobs", true)
 	userID := strings.ToLower(strings.TrimLeft(UserID, "user_"))
 	bucketName := fmt.Sprintf("dudotest-%s", userID)
 	GetTestApp().Storage.RemoveBucket(bucketName, true)
@@ -86,10 +94,11 @@ type UserResponse struct {
 	Status  int    `json:"status"`
 	Message string `json:"message"`
 	Data    struct {
-		Email    string `json:"email"`
-		Token    string `json:"token"`
-		Password string `json:"password"`
-		ID       string `json:"id"`
+		Email        string `json:"email"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+		Password     string `json:"password"`
+		ID           string `json:"id"`
 	}
 }
 
@@ -145,6 +154,16 @@ func signUpTestUser(app *core.App) (*UserResponse, error) {
 
 func tearDownUser(app *core.App) {
 	app.DB.Unscoped().Delete(&models.User{})
+	app.DB.Delete(&models.Session{})
+	app.DB.Delete(&models.RevokedToken{})
+	app.DB.Delete(&models.TwoFactor{})
+	app.DB.Delete(&models.RecoveryCode{})
+	app.DB.Delete(&models.MFAChallenge{})
+	app.DB.Delete(&models.PersonalAccessToken{})
+	app.DB.Delete(&models.OIDCIdentity{})
+	app.DB.Delete(&models.OIDCLogin{})
+	app.DB.Delete(&models.Group{})
+	app.DB.Delete(&models.GroupMember{})
 }
 
 // StoragesResponse save the response infomation
@@ -355,3 +374,53 @@ func fileUploadRequest(url, paramName, localPath, token, filePath string) (*http
 	router.ServeHTTP(rr, req)
 	return rr, nil
 }
+
+// uploadFile upload content as file with name to url, token is sent when
+// not empty and headers are added to the request
+func uploadFile(url, token, fileName, content string, headers map[string]string) *httptest.ResponseRecorder {
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("uploadfile", fileName)
+	part.Write([]byte(content))
+	writer.Close()
+	req := httptest.NewRequest(http.MethodPost, url, body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+	return rr
+}
+
+// doRequest send request with token and return the response
+func doRequest(method, url, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+	return rr
+}
+
+// doJSON send request with token and decode the data of response
+func doJSON(method, url, token, body string, data interface{}) int {
+	req := httptest.NewRequest(method, url, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+	if data != nil && rr.Code < 300 {
+		message := struct {
+			Data interface{} `json:"data"`
+		}{Data: data}
+		json.NewDecoder(rr.Body).Decode(&message)
+	}
+	return rr.Code
+}
@@ -0,0 +1,127 @@
+package e2e
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/utils"
+)
+
+func TestMoveFiles(t *testing.T) {
+	app := GetTestApp()
+	userResponse, _ := signUpTestUser(app)
+	token := userResponse.Data.Token
+	defer func() {
+		tearDownUser(app)
+		tearDownStorages()
+	}()
+	folders, files := setUpRealFiles(token)
+	testCases := []struct {
+		id         string
+		target     string
+		statuscode int
+	}{
+		{id: folders["files"].ID, target: folders["backup"].ID, statuscode: http.StatusOK},
+		// move folder into its sub folder
+		{id: folders["backup"].ID, target: folders["files"].ID, statuscode: http.StatusBadRequest},
+		{id: folders["backup"].ID, target: folders["backup"].ID, statuscode: http.StatusBadRequest},
+		// backup folder already has 1.file
+		{id: files["1.file"].ID, target: folders["backup"].ID, statuscode: http.StatusBadRequest},
+		// target is not a folder
+		{id: files["2.file"].ID, target: files["1.file"].ID, statuscode: http.StatusBadRequest},
+		{id: files["2.file"].ID, target: "notexist", statuscode: http.StatusNotFound},
+		{id: "notexist", target: "root", statuscode: http.StatusNotFound},
+		{id: files["2.file"].ID, target: "root", statuscode: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		req, _ := http.NewRequest("POST", "/api/files/"+tc.id+"/move", strings.NewReader(`{"folder_id":"`+tc.target+`"}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+		utils.Equals(t, tc.statuscode, rr.Code)
+		if rr.Code == http.StatusOK {
+			s := models.StorageFile{}
+			models.GetDB().Where("id = ?", tc.id).First(&s)
+			utils.Equals(t, tc.target, s.FolderID)
+		}
+	}
+}
+
+func TestCopyFiles(t *testing.T) {
+	app := GetTestApp()
+	userResponse, _ := signUpTestUser(app)
+	token := userResponse.Data.Token
+	defer func() {
+		tearDownUser(app)
+		tearDownStorages()
+	}()
+	folders, files := setUpRealFiles(token)
+	copyFile := func(id, target string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/api/files/"+id+"/copy", strings.NewReader(`{"folder_id":"`+target+`"}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+		return rr
+	}
+	download := func(id string) string {
+		req, _ := http.NewRequest("GET", "/api/download/files/"+id, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+		utils.Equals(t, http.StatusOK, rr.Code)
+		return rr.Body.String()
+	}
+	utils.Equals(t, http.StatusBadRequest, copyFile(folders["files"].ID, folders["files"].ID).Code)
+	utils.Equals(t, http.StatusBadRequest, copyFile(files["1.file"].ID, folders["backup"].ID).Code)
+
+	rr := copyFile(folders["files"].ID, folders["empty"].ID)
+	utils.Equals(t, http.StatusCreated, rr.Code)
+	response := struct {
+		Data models.StorageFile `json:"data"`
+	}{}
+	utils.OK(t, json.NewDecoder(rr.Body).Decode(&response))
+	utils.Equals(t, folders["empty"].ID, response.Data.FolderID)
+	utils.Equals(t, "files", response.Data.FileName)
+	copies := []models.StorageFile{}
+	models.GetDB().Where("folder_id = ?", response.Data.ID).Find(&copies)
+	utils.Equals(t, 3, len(copies))
+	for _, c := range copies {
+		utils.Equals(t, files[c.FileName].Hash, c.Hash)
+		utils.Assert(t, c.ID != files[c.FileName].ID, "copied file should have new id")
+		utils.Equals(t, "this is "+c.FileName, download(c.ID))
+	}
+	// content is shared and usage counted for each copy
+	blob := models.Blob{}
+	models.GetDB().Where("hash = ?", files["1.file"].Hash).First(&blob)
+	utils.Equals(t, int64(3), blob.RefCount)
+	utils.Equals(t, uint64(7*14), getUsageDiskSize(userResponse.Data.ID))
+
+	// old file without hash is copied in storage
+	legacy := models.StorageFile{
+		UserID: userResponse.Data.ID,
+		RawStorageFileInfo: models.RawStorageFileInfo{
+			ID:       "file_legacy",
+			FileName: "legacy.file",
+			Bucket:   "dudotest-legacy",
+			FileSize: 6,
+			FolderID: "root",
+		},
+	}
+	utils.OK(t, models.GetDB().Create(&legacy).Error)
+	_, err := app.Storage.Upload(strings.NewReader("legacy"), 6, legacy.ID, legacy.Bucket)
+	utils.OK(t, err)
+	defer app.Storage.RemoveBucket(legacy.Bucket, true)
+	rr = copyFile(legacy.ID, folders["empty"].ID)
+	utils.Equals(t, http.StatusCreated, rr.Code)
+	utils.OK(t, json.NewDecoder(rr.Body).Decode(&response))
+	utils.OK(t, app.Storage.Delete(legacy.ID, legacy.Bucket))
+	utils.Equals(t, "legacy", download(response.Data.ID))
+
+	// quota is checked before copy
+	models.GetDB().Model(&models.Profile{}).Where("user_id = ?", userResponse.Data.ID).Update("disk_limit", 7*14+6)
+	utils.Equals(t, http.StatusInsufficientStorage, copyFile(folders["backup"].ID, folders["empty"].ID).Code)
+}
@@ -0,0 +1,244 @@
+package e2e
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/oidc"
+	"github.com/Dudobird/dudo-server/utils"
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+const (
+	mockClientID     = "dudo"
+	mockClientSecret = "dudo-secret"
+)
+
+type mockAuthCode struct {
+	challenge string
+	nonce     string
+	claims    map[string]interface{}
+}
+
+// mockIdentityProvider is a minimal openid connect provider for tests
+type mockIdentityProvider struct {
+	*httptest.Server
+	key   *rsa.PrivateKey
+	lock  sync.Mutex
+	codes map[string]mockAuthCode
+}
+
+func newMockIdentityProvider(t *testing.T) *mockIdentityProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	utils.OK(t, err)
+	idp := &mockIdentityProvider{key: key, codes: map[string]mockAuthCode{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kid": "test-key",
+				"kty": "RSA",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, secret, ok := r.BasicAuth()
+		if !ok || clientID != mockClientID || secret != mockClientSecret {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		idp.lock.Lock()
+		code, ok := idp.codes[r.FormValue("code")]
+		delete(idp.codes, r.FormValue("code"))
+		idp.lock.Unlock()
+		if !ok || oidc.CodeChallenge(r.FormValue("code_verifier")) != code.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		claims := jwt.MapClaims{
+			"iss":   idp.URL,
+			"aud":   mockClientID,
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"iat":   time.Now().Unix(),
+			"nonce": code.nonce,
+		}
+		for name, value := range code.claims {
+			claims[name] = value
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test-key"
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idToken, "token_type": "Bearer"})
+	})
+	idp.Server = httptest.NewServer(mux)
+	return idp
+}
+
+// startOIDCLogin start login and return the state cookie and query of authorize url
+func startOIDCLogin(t *testing.T) (*http.Cookie, url.Values) {
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/auth/oidc/login", nil))
+	utils.Equals(t, http.StatusFound, rr.Code)
+	location, err := url.Parse(rr.Header().Get("Location"))
+	utils.OK(t, err)
+	query := location.Query()
+	utils.Equals(t, "S256", query.Get("code_challenge_method"))
+	utils.Equals(t, mockClientID, query.Get("client_id"))
+	cookies := rr.Result().Cookies()
+	utils.Assert(t, len(cookies) == 1, "state cookie should be set")
+	utils.Equals(t, query.Get("state"), cookies[0].Value)
+	return cookies[0], query
+}
+
+func oidcCallback(cookie *http.Cookie, query string, data interface{}) int {
+	req := httptest.NewRequest("GET", "/api/auth/oidc/callback?"+query, nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+	if data != nil && rr.Code < 300 {
+		json.NewDecoder(rr.Body).Decode(data)
+	}
+	return rr.Code
+}
+
+// loginWithOIDC login with identity provider which return the claims
+func loginWithOIDC(t *testing.T, idp *mockIdentityProvider, claims map[string]interface{}) (*UserResponse, int) {
+	response := &UserResponse{}
+	return response, oidcLogin(t, idp, claims, response)
+}
+
+// oidcLogin login with identity provider and decode the response to data
+func oidcLogin(t *testing.T, idp *mockIdentityProvider, claims map[string]interface{}, data interface{}) int {
+	cookie, query := startOIDCLogin(t)
+	code := utils.GenRandomID("code", 10)
+	idp.lock.Lock()
+	idp.codes[code] = mockAuthCode{
+		challenge: query.Get("code_challenge"),
+		nonce:     query.Get("nonce"),
+		claims:    claims,
+	}
+	idp.lock.Unlock()
+	return oidcCallback(cookie, url.Values{"code": {code}, "state": {query.Get("state")}}.Encode(), data)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	app := GetTestApp()
+	// sso is disabled in test config
+	utils.Equals(t, http.StatusNotFound, doJSON("GET", "/api/auth/oidc/login", "", "", nil))
+
+	idp := newMockIdentityProvider(t)
+	provider := oidc.NewProvider(idp.URL, mockClientID, mockClientSecret, "http://localhost/api/auth/oidc/callback", nil)
+	provider.AdminClaim = "groups"
+	provider.AdminValue = "dudo-admins"
+	app.OIDC = provider
+	defer func() {
+		app.OIDC = nil
+		idp.Close()
+		tearDownUser(app)
+	}()
+
+	// first login create the user
+	claims := map[string]interface{}{
+		"sub":    "user-1",
+		"email":  "sso@example.com",
+		"groups": []string{"staff"},
+	}
+	response, status := loginWithOIDC(t, idp, claims)
+	utils.Equals(t, http.StatusOK, status)
+	utils.Equals(t, "sso@example.com", response.Data.Email)
+	utils.Equals(t, http.StatusOK, getProfileWithToken(response.Data.Token))
+	account := &models.User{}
+	utils.OK(t, app.DB.Where("email = ?", "sso@example.com").First(account).Error)
+	utils.Equals(t, uint(models.UserRoleID), account.RoleID)
+
+	// same user is used for next login and admin role is synced from claim
+	claims["groups"] = []string{"staff", "dudo-admins"}
+	second, status := loginWithOIDC(t, idp, claims)
+	utils.Equals(t, http.StatusOK, status)
+	utils.Equals(t, response.Data.ID, second.Data.ID)
+	utils.OK(t, app.DB.Where("id = ?", response.Data.ID).First(account).Error)
+	utils.Equals(t, uint(models.AdminRoleID), account.RoleID)
+	claims["groups"] = []string{}
+	_, status = loginWithOIDC(t, idp, claims)
+	utils.Equals(t, http.StatusOK, status)
+	utils.OK(t, app.DB.Where("id = ?", response.Data.ID).First(account).Error)
+	utils.Equals(t, uint(models.UserRoleID), account.RoleID)
+
+	// exist user with same email is linked only when email is verified
+	local, err := signUpTestUser(app)
+	utils.OK(t, err)
+	_, status = loginWithOIDC(t, idp, map[string]interface{}{"sub": "user-2", "email": testUser.Email})
+	utils.Equals(t, http.StatusForbidden, status)
+	var counter int
+	app.DB.Model(&models.OIDCIdentity{}).Where("user_id = ?", local.Data.ID).Count(&counter)
+	utils.Equals(t, 0, counter)
+	linkClaims := map[string]interface{}{"sub": "user-2", "email": testUser.Email, "email_verified": true}
+	linked, status := loginWithOIDC(t, idp, linkClaims)
+	utils.Equals(t, http.StatusOK, status)
+	utils.Equals(t, local.Data.ID, linked.Data.ID)
+
+	// user with two factor must finish login with code
+	_, recoveryCodes := enableTwoFactor(t, local.Data.Token)
+	challenge := struct {
+		Data models.MFAChallengeResponse `json:"data"`
+	}{}
+	utils.Equals(t, http.StatusOK, oidcLogin(t, idp, linkClaims, &challenge))
+	utils.Assert(t, challenge.Data.MFARequired, "login should require two factor code")
+	login := UserResponse{}.Data
+	body := `{"mfa_token":"` + challenge.Data.MFAToken + `","code":"` + recoveryCodes[0] + `"}`
+	utils.Equals(t, http.StatusOK, doJSON("POST", "/api/auth/signin/2fa", "", body, &login))
+	utils.Equals(t, local.Data.ID, login.ID)
+
+	// email must be verified when provider send the claim
+	_, status = loginWithOIDC(t, idp, map[string]interface{}{
+		"sub": "user-3", "email": "unverified@example.com", "email_verified": false,
+	})
+	utils.Equals(t, http.StatusForbidden, status)
+
+	// state must match the cookie and can be used only once
+	cookie, query := startOIDCLogin(t)
+	utils.Equals(t, http.StatusBadRequest, oidcCallback(nil, "code=abc&state="+query.Get("state"), nil))
+	utils.Equals(t, http.StatusBadRequest, oidcCallback(cookie, "code=abc&state=not-exist", nil))
+	utils.Equals(t, http.StatusUnauthorized, oidcCallback(cookie, "code=abc&state="+query.Get("state"), nil))
+	utils.Equals(t, http.StatusBadRequest, oidcCallback(cookie, "code=abc&state="+query.Get("state"), nil))
+
+	// code verifier of another login is not accepted
+	cookie, query = startOIDCLogin(t)
+	_, other := startOIDCLogin(t)
+	code := utils.GenRandomID("code", 10)
+	idp.codes[code] = mockAuthCode{
+		challenge: other.Get("code_challenge"),
+		nonce:     query.Get("nonce"),
+		claims:    claims,
+	}
+	utils.Equals(t, http.StatusUnauthorized, oidcCallback(cookie, "code="+code+"&state="+query.Get("state"), nil))
+}
@@ -0,0 +1,105 @@
+package e2e
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/Dudobird/dudo-server/mail"
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/utils"
+)
+
+func postJSON(url string, body string) int {
+	req, _ := http.NewRequest("POST", url, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+	return rr.Code
+}
+
+func TestResetPassword(t *testing.T) {
+	app := GetTestApp()
+	root, err := ioutil.TempDir("", "dudo-mail")
+	utils.OK(t, err)
+	mailFile := filepath.Join(root, "mails.log")
+	mailer := app.Mailer
+	app.Mailer = mail.NewFileMailer(mailFile, app.Config.Mail.From)
+	response, err := signUpTestUser(app)
+	utils.OK(t, err)
+	defer func() {
+		app.Mailer = mailer
+		os.RemoveAll(root)
+		tearDownUser(app)
+		models.GetDB().Delete(&models.PasswordReset{})
+	}()
+	resetLink := regexp.MustCompile(regexp.QuoteMeta(app.Config.Mail.ResetURL) + `(\S+)`)
+	lastToken := func() string {
+		content, err := ioutil.ReadFile(mailFile)
+		utils.OK(t, err)
+		matches := resetLink.FindAllStringSubmatch(string(content), -1)
+		utils.Assert(t, len(matches) > 0, "reset link not found in mail")
+		token, err := url.QueryUnescape(matches[len(matches)-1][1])
+		utils.OK(t, err)
+		return token
+	}
+
+	// no mail is sent for not exist email but response is same
+	utils.Equals(t, http.StatusOK, postJSON("/api/auth/password/forgot", `{"email":"notexist@example.com"}`))
+	_, err = os.Stat(mailFile)
+	utils.Assert(t, os.IsNotExist(err), "mail should not be sent")
+	utils.Equals(t, http.StatusBadRequest, postJSON("/api/auth/password/forgot", `{}`))
+
+	utils.Equals(t, http.StatusOK, postJSON("/api/auth/password/forgot", `{"email":"`+testUser.Email+`"}`))
+	oldToken := lastToken()
+	accessToken := createPersonalAccessToken(t, response.Data.Token, `{"name":"files","scopes":["files:read"]}`)
+	// new request make the old token not valid
+	utils.Equals(t, http.StatusOK, postJSON("/api/auth/password/forgot", `{"email":"`+testUser.Email+`"}`))
+	token := lastToken()
+	utils.Assert(t, oldToken != token, "reset token should be changed")
+
+	testCases := []struct {
+		body       string
+		statuscode int
+	}{
+		{body: `{"token":"` + oldToken + `","new_password":"654321"}`, statuscode: http.StatusBadRequest},
+		{body: `{"token":"not-exist","new_password":"654321"}`, statuscode: http.StatusBadRequest},
+		{body: `{"token":"` + token + `","new_password":""}`, statuscode: http.StatusBadRequest},
+		{body: `{"new_password":"654321"}`, statuscode: http.StatusBadRequest},
+		{body: `{"token":"` + token + `","new_password":"654321"}`, statuscode: http.StatusOK},
+		// token can be used only once
+		{body: `{"token":"` + token + `","new_password":"abcdef"}`, statuscode: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		utils.Equals(t, tc.statuscode, postJSON("/api/auth/password/reset", tc.body))
+	}
+
+	// sessions and personal access tokens before reset are revoked
+	utils.Equals(t, http.StatusUnauthorized, getProfileWithToken(response.Data.Token))
+	utils.Equals(t, http.StatusUnauthorized, doJSON("GET", "/api/folders/root", accessToken.Token, "", nil))
+	_, code := refreshToken(response.Data.RefreshToken)
+	utils.Equals(t, http.StatusUnauthorized, code)
+	_, err = signIn(testUser)
+	utils.Assert(t, err != nil, "old password should not be used")
+	_, err = signIn(&models.User{Email: testUser.Email, Password: "654321"})
+	utils.OK(t, err)
+
+	// expired token can not be used
+	utils.Equals(t, http.StatusOK, postJSON("/api/auth/password/forgot", `{"email":"`+testUser.Email+`"}`))
+	token = lastToken()
+	models.GetDB().Model(&models.PasswordReset{}).Where("used_at is null").UpdateColumn(
+		"expires_at", time.Now().Add(-time.Minute),
+	)
+	utils.Equals(t, http.StatusBadRequest, postJSON("/api/auth/password/reset", `{"token":"`+token+`","new_password":"abcdef"}`))
+
+	// response is same when mail can not be sent, parent of mail file is a file
+	app.Mailer = mail.NewFileMailer(filepath.Join(mailFile, "mails.log"), app.Config.Mail.From)
+	utils.Equals(t, http.StatusOK, postJSON("/api/auth/password/forgot", `{"email":"`+testUser.Email+`"}`))
+}
@@ -0,0 +1,219 @@
+package e2e
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/utils"
+)
+
+type filePermissionResponse struct {
+	ID          string `json:"id"`
+	GranteeType string `json:"grantee_type"`
+	GranteeName string `json:"grantee_name"`
+	Role        string `json:"role"`
+}
+
+type sharedFileResponse struct {
+	Role       string `json:"role"`
+	OwnerEmail string `json:"owner_email"`
+	File       struct {
+		ID       string `json:"id"`
+		FileName string `json:"file_name"`
+	} `json:"file"`
+}
+
+// uploadWithToken upload the content as file to folder with token
+func getSharedWithMe(t *testing.T, token string) []sharedFileResponse {
+	files := []sharedFileResponse{}
+	utils.Equals(t, http.StatusOK, doJSON("GET", "/api/shared", token, "", &files))
+	return files
+}
+
+func TestShareFilesWithUsersAndGroups(t *testing.T) {
+	app := GetTestApp()
+	userResponse, _ := signUpTestUser(app)
+	token := userResponse.Data.Token
+	ownerID := UserID
+	folders, files := setUpRealFiles(token)
+	viewerResponse, err := signUp(&models.User{Email: "viewer@example.com", Password: "123456"})
+	utils.OK(t, err)
+	editorResponse, err := signUp(&models.User{Email: "editor@example.com", Password: "123456"})
+	utils.OK(t, err)
+	UserID = ownerID
+	defer func() {
+		tearDownUser(app)
+		tearDownStorages()
+	}()
+	viewer := viewerResponse.Data.Token
+	editor := editorResponse.Data.Token
+	folderID := folders["files"].ID
+	permissionsURL := "/api/files/" + folderID + "/permissions"
+
+	// files not shared are not visible
+	utils.Equals(t, http.StatusNotFound, doJSON("GET", "/api/files/"+files["2.file"].ID, viewer, "", nil))
+	utils.Equals(t, http.StatusNotFound, doJSON("GET", "/api/download/files/"+files["2.file"].ID, viewer, "", nil))
+	list := []models.StorageFile{}
+	utils.Equals(t, http.StatusOK, doJSON("GET", "/api/folders/"+folderID, viewer, "", &list))
+	utils.Equals(t, 0, len(list))
+	utils.Equals(t, 0, len(getSharedWithMe(t, viewer)))
+
+	testCases := []struct {
+		body       string
+		statuscode int
+	}{
+		{body: `{"email":"viewer@example.com","role":"admin"}`, statuscode: http.StatusBadRequest},
+		{body: `{"role":"viewer"}`, statuscode: http.StatusBadRequest},
+		{body: `{"email":"test@example.com","role":"viewer"}`, statuscode: http.StatusBadRequest},
+		{body: `{"email":"not-exist@example.com","role":"viewer"}`, statuscode: http.StatusNotFound},
+		{body: `{"group_id":"not-exist","role":"viewer"}`, statuscode: http.StatusNotFound},
+	}
+	for _, tc := range testCases {
+		utils.Equals(t, tc.statuscode, doJSON("POST", permissionsURL, token, tc.body, nil))
+	}
+	permission := &filePermissionResponse{}
+	utils.Equals(t, http.StatusCreated, doJSON("POST", permissionsURL, token, `{"email":"viewer@example.com","role":"viewer"}`, permission))
+	utils.Equals(t, "viewer@example.com", permission.GranteeName)
+
+	// viewer can read all files under folder
+	shared := getSharedWithMe(t, viewer)
+	utils.Equals(t, 1, len(shared))
+	utils.Equals(t, models.PermissionViewer, shared[0].Role)
+	utils.Equals(t, "test@example.com", shared[0].OwnerEmail)
+	utils.Equals(t, "files", shared[0].File.FileName)
+	utils.Equals(t, http.StatusOK, doJSON("GET", "/api/folders/"+folderID, viewer, "", &list))
+	utils.Equals(t, 3, len(list))
+	rr := doRequest("GET", "/api/download/files/"+files["2.file"].ID, viewer)
+	utils.Equals(t, http.StatusOK, rr.Code)
+	utils.Equals(t, "this is 2.file", rr.Body.String())
+	// but can not change them
+	utils.Equals(t, http.StatusForbidden, doJSON("PUT", "/api/files/"+files["2.file"].ID, viewer, `{"file_name":"renamed"}`, nil))
+	utils.Equals(t, http.StatusForbidden, doJSON("DELETE", "/api/files/"+files["2.file"].ID, viewer, "", nil))
+	utils.Equals(t, http.StatusForbidden, uploadFile("/api/upload/files/"+folderID, viewer, "viewer.txt", "hello", nil).Code)
+	utils.Equals(t, http.StatusForbidden, doJSON("GET", permissionsURL, viewer, "", nil))
+
+	// share with group
+	group := &models.Group{}
+	utils.Equals(t, http.StatusCreated, doJSON("POST", "/api/groups", token, `{"name":"team"}`, group))
+	utils.Equals(t, http.StatusCreated, doJSON("POST", "/api/groups/"+group.ID+"/members", token, `{"email":"editor@example.com"}`, group))
+	utils.Equals(t, 2, len(group.Members))
+	utils.Equals(t, http.StatusBadRequest, doJSON("POST", "/api/groups/"+group.ID+"/members", token, `{"email":"editor@example.com"}`, nil))
+	utils.Equals(t, http.StatusNotFound, doJSON("POST", "/api/groups/"+group.ID+"/members", viewer, `{"email":"viewer@example.com"}`, nil))
+	utils.Equals(t, http.StatusForbidden, doJSON("POST", "/api/groups/"+group.ID+"/members", editor, `{"email":"viewer@example.com"}`, nil))
+	groups := []models.Group{}
+	utils.Equals(t, http.StatusOK, doJSON("GET", "/api/groups", editor, "", &groups))
+	utils.Equals(t, 1, len(groups))
+	utils.Equals(t, http.StatusCreated, doJSON("POST", permissionsURL, token, fmt.Sprintf(`{"group_id":"%s","role":"editor"}`, group.ID), nil))
+
+	// editor upload files which are owned and charged to owner
+	ownerUsage := getUsageDiskSize(ownerID)
+	editorUsage := getUsageDiskSize(editorResponse.Data.ID)
+	utils.Equals(t, http.StatusCreated, uploadFile("/api/upload/files/"+folderID, editor, "editor.txt", "hello", nil).Code)
+	uploaded := &models.StorageFile{}
+	utils.OK(t, app.DB.Where("file_name = ?", "editor.txt").First(uploaded).Error)
+	utils.Equals(t, ownerID, uploaded.UserID)
+	utils.Equals(t, folderID, uploaded.FolderID)
+	utils.Equals(t, ownerUsage+5, getUsageDiskSize(ownerID))
+	utils.Equals(t, editorUsage, getUsageDiskSize(editorResponse.Data.ID))
+	profile := &models.Profile{}
+	utils.OK(t, app.DB.Where("user_id = ?", ownerID).First(profile).Error)
+	app.DB.Model(&models.Profile{}).Where("user_id = ?", ownerID).Update("usage_disk_size", profile.DiskLimit-1)
+	utils.Equals(t, http.StatusInsufficientStorage, uploadFile("/api/upload/files/"+folderID, editor, "full.txt", "hello", nil).Code)
+	app.DB.Model(&models.Profile{}).Where("user_id = ?", ownerID).Update("usage_disk_size", profile.UsageDiskSize)
+	rr = tusRequest("POST", "/api/tus/folders/"+folderID, editor, map[string]string{
+		"Upload-Length":   "3",
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("tus.txt")),
+	}, nil)
+	utils.Equals(t, http.StatusCreated, rr.Code)
+	rr = tusRequest("PATCH", rr.Header().Get("Location"), editor, map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": "0",
+	}, []byte("tus"))
+	utils.Equals(t, http.StatusNoContent, rr.Code)
+	tusFile := &models.StorageFile{}
+	utils.OK(t, app.DB.Where("id = ?", rr.Header().Get("X-FileID")).First(tusFile).Error)
+	utils.Equals(t, ownerID, tusFile.UserID)
+	utils.Equals(t, editorResponse.Data.ID, tusFile.UploadedBy)
+	utils.Equals(t, ownerUsage+8, getUsageDiskSize(ownerID))
+
+	// versions keep the uploader of old content
+	utils.Equals(t, editorResponse.Data.ID, uploaded.UploadedBy)
+	rr = uploadFile("/api/upload/files/"+folderID+"?version=true", token, "editor.txt", "owner", nil)
+	utils.Equals(t, http.StatusCreated, rr.Code)
+	versions := []models.FileVersion{}
+	utils.Equals(t, http.StatusOK, doJSON("GET", "/api/files/"+uploaded.ID+"/versions", editor, "", &versions))
+	utils.Equals(t, 1, len(versions))
+	utils.Equals(t, editorResponse.Data.ID, versions[0].UserID)
+	utils.OK(t, app.DB.Where("id = ?", uploaded.ID).First(uploaded).Error)
+	utils.Equals(t, ownerID, uploaded.UploadedBy)
+	utils.Equals(t, ownerUsage+13, getUsageDiskSize(ownerID))
+
+	// editor change files in folder and permission is inherited by sub folders
+	utils.Equals(t, http.StatusOK, doJSON("PUT", "/api/files/"+files["3.file"].ID, editor, `{"file_name":"renamed"}`, nil))
+	utils.Equals(t, http.StatusCreated, doJSON("POST", "/api/folders", editor, fmt.Sprintf(`{"is_dir":true,"file_name":"sub","folder_id":"%s"}`, folderID), nil))
+	sub := &models.StorageFile{}
+	utils.OK(t, app.DB.Where("file_name = ?", "sub").First(sub).Error)
+	utils.Equals(t, ownerID, sub.UserID)
+	utils.Equals(t, http.StatusCreated, uploadFile("/api/upload/files/"+sub.ID, editor, "deep.txt", "deep", nil).Code)
+	utils.Equals(t, http.StatusOK, doJSON("GET", "/api/folders/"+sub.ID, viewer, "", &list))
+	utils.Equals(t, 1, len(list))
+	utils.Equals(t, http.StatusOK, doJSON("POST", "/api/files/"+uploaded.ID+"/move", editor, fmt.Sprintf(`{"folder_id":"%s"}`, sub.ID), nil))
+	// files can not be moved out of shared folder
+	utils.Equals(t, http.StatusBadRequest, doJSON("POST", "/api/files/"+uploaded.ID+"/move", editor, fmt.Sprintf(`{"folder_id":"%s"}`, folders["backup"].ID), nil))
+	utils.Equals(t, http.StatusBadRequest, doJSON("POST", "/api/files/"+uploaded.ID+"/move", editor, `{"folder_id":"root"}`, nil))
+	utils.Equals(t, http.StatusOK, doJSON("DELETE", "/api/files/"+files["1.file"].ID, editor, "", nil))
+	trash := listTrash(t, token)
+	utils.Equals(t, 1, len(trash))
+	utils.Equals(t, files["1.file"].ID, trash[0].ID)
+	utils.Equals(t, http.StatusForbidden, doJSON("GET", permissionsURL, editor, "", nil))
+
+	// upload is not completed after editor lost the permission
+	rr = tusRequest("POST", "/api/tus/folders/"+folderID, editor, map[string]string{
+		"Upload-Length":   "4",
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("pending.txt")),
+	}, nil)
+	utils.Equals(t, http.StatusCreated, rr.Code)
+	pendingURL := rr.Header().Get("Location")
+	rr = tusRequest("PATCH", pendingURL, editor, map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": "0",
+	}, []byte("tu"))
+	utils.Equals(t, http.StatusNoContent, rr.Code)
+
+	// co-owner manage permissions, role of user is changed with grant again
+	utils.Equals(t, http.StatusCreated, doJSON("POST", permissionsURL, token, `{"email":"viewer@example.com","role":"co-owner"}`, nil))
+	shared = getSharedWithMe(t, viewer)
+	utils.Equals(t, 1, len(shared))
+	utils.Equals(t, models.PermissionCoOwner, shared[0].Role)
+	permissions := []filePermissionResponse{}
+	utils.Equals(t, http.StatusOK, doJSON("GET", permissionsURL, viewer, "", &permissions))
+	utils.Equals(t, 2, len(permissions))
+	utils.Equals(t, "team", permissions[1].GranteeName)
+	utils.Equals(t, http.StatusOK, doJSON("DELETE", permissionsURL+"/"+permissions[1].ID, viewer, "", nil))
+	utils.Equals(t, http.StatusNotFound, doJSON("DELETE", permissionsURL+"/"+permissions[1].ID, viewer, "", nil))
+	utils.Equals(t, http.StatusNotFound, doJSON("GET", "/api/files/"+folderID, editor, "", nil))
+	utils.Equals(t, 0, len(getSharedWithMe(t, editor)))
+	rr = tusRequest("PATCH", pendingURL, editor, map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": "2",
+	}, []byte("s!"))
+	utils.Equals(t, http.StatusNotFound, rr.Code)
+	count := 0
+	app.DB.Model(&models.StorageFile{}).Where("file_name = ?", "pending.txt").Count(&count)
+	utils.Equals(t, 0, count)
+	utils.Equals(t, http.StatusNoContent, tusRequest("DELETE", pendingURL, editor, nil, nil).Code)
+
+	// files in trash of owner are not shared
+	utils.Equals(t, http.StatusOK, doJSON("DELETE", "/api/files/"+folderID, token, "", nil))
+	utils.Equals(t, 0, len(getSharedWithMe(t, viewer)))
+	utils.Equals(t, http.StatusNotFound, doJSON("GET", "/api/files/"+sub.ID, viewer, "", nil))
+
+	// delete group remove its permissions
+	utils.Equals(t, http.StatusOK, doJSON("DELETE", "/api/groups/"+group.ID+"/members/"+editorResponse.Data.ID, editor, "", nil))
+	utils.Equals(t, http.StatusBadRequest, doJSON("DELETE", "/api/groups/"+group.ID+"/members/"+ownerID, token, "", nil))
+	utils.Equals(t, http.StatusOK, doJSON("DELETE", "/api/groups/"+group.ID, token, "", nil))
+	utils.Equals(t, http.StatusNotFound, doJSON("DELETE", "/api/groups/"+group.ID, token, "", nil))
+}
@@ -0,0 +1,117 @@
+package e2e
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/utils"
+)
+
+type personalAccessTokenResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	Token      string     `json:"token"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip"`
+}
+
+func createPersonalAccessToken(t *testing.T, token, body string) *personalAccessTokenResponse {
+	accessToken := &personalAccessTokenResponse{}
+	utils.Equals(t, http.StatusCreated, doJSON("POST", "/api/tokens", token, body, accessToken))
+	utils.Assert(t, strings.HasPrefix(accessToken.Token, models.PersonalAccessTokenPrefix), "token prefix not correct")
+	return accessToken
+}
+
+func TestPersonalAccessToken(t *testing.T) {
+	app := GetTestApp()
+	response, err := signUpTestUser(app)
+	utils.OK(t, err)
+	defer tearDownUser(app)
+	token := response.Data.Token
+	testCases := []struct {
+		body       string
+		statuscode int
+	}{
+		{body: `{"scopes":["files:read"]}`, statuscode: http.StatusBadRequest},
+		{body: `{"name":"ci"}`, statuscode: http.StatusBadRequest},
+		{body: `{"name":"ci","scopes":["files:delete"]}`, statuscode: http.StatusBadRequest},
+		{body: `{"name":"ci","scopes":["files:read"],"expires_in_days":-1}`, statuscode: http.StatusBadRequest},
+		// only admin can create token with admin scope
+		{body: `{"name":"ci","scopes":["admin"]}`, statuscode: http.StatusForbidden},
+	}
+	for _, tc := range testCases {
+		utils.Equals(t, tc.statuscode, doJSON("POST", "/api/tokens", token, tc.body, nil))
+	}
+	reader := createPersonalAccessToken(t, token, `{"name":"reader","scopes":["files:read","files:read"]}`)
+	utils.Equals(t, []string{models.ScopeFilesRead}, reader.Scopes)
+	utils.Assert(t, reader.ExpiresAt == nil, "token without expiry should not expire")
+	writer := createPersonalAccessToken(t, token, `{"name":"writer","scopes":["files:read","files:write"],"expires_in_days":30}`)
+	utils.Assert(t, writer.ExpiresAt != nil, "token expiry not set")
+
+	scopeCases := []struct {
+		method     string
+		url        string
+		body       string
+		token      string
+		statuscode int
+	}{
+		{method: "GET", url: "/api/folders/root", token: reader.Token, statuscode: http.StatusOK},
+		{method: "POST", url: "/api/folders", body: `{"is_dir":true,"file_name":"reader"}`, token: reader.Token, statuscode: http.StatusForbidden},
+		{method: "GET", url: "/api/shares", token: reader.Token, statuscode: http.StatusForbidden},
+		{method: "POST", url: "/api/search/files", body: `{"search":"file"}`, token: reader.Token, statuscode: http.StatusOK},
+		{method: "POST", url: "/api/folders", body: `{"is_dir":true,"file_name":"writer"}`, token: writer.Token, statuscode: http.StatusCreated},
+		// token can not manage tokens or change password
+		{method: "GET", url: "/api/tokens", token: writer.Token, statuscode: http.StatusForbidden},
+		{method: "POST", url: "/api/auth/password", body: `{"password":"123456","new_password":"654321"}`, token: writer.Token, statuscode: http.StatusForbidden},
+		{method: "GET", url: "/api/folders/root", token: models.PersonalAccessTokenPrefix + "notexist", statuscode: http.StatusUnauthorized},
+	}
+	for _, tc := range scopeCases {
+		utils.Equals(t, tc.statuscode, doJSON(tc.method, tc.url, tc.token, tc.body, nil))
+	}
+
+	// token is listed without its value and last use is recorded
+	tokens := []personalAccessTokenResponse{}
+	utils.Equals(t, http.StatusOK, doJSON("GET", "/api/tokens", token, "", &tokens))
+	utils.Equals(t, 2, len(tokens))
+	for _, accessToken := range tokens {
+		utils.Equals(t, "", accessToken.Token)
+		utils.Assert(t, accessToken.LastUsedAt != nil, "last used time not recorded")
+		utils.Equals(t, "192.0.2.1", accessToken.LastUsedIP)
+	}
+
+	// expired token can not be used
+	models.GetDB().Model(&models.PersonalAccessToken{}).Where("id = ?", writer.ID).UpdateColumn(
+		"expires_at", time.Now().Add(-time.Minute),
+	)
+	utils.Equals(t, http.StatusUnauthorized, doJSON("GET", "/api/folders/root", writer.Token, "", nil))
+
+	utils.Equals(t, http.StatusOK, doJSON("DELETE", "/api/tokens/"+reader.ID, token, "", nil))
+	utils.Equals(t, http.StatusNotFound, doJSON("DELETE", "/api/tokens/"+reader.ID, token, "", nil))
+	utils.Equals(t, http.StatusUnauthorized, doJSON("GET", "/api/folders/root", reader.Token, "", nil))
+	utils.Equals(t, http.StatusOK, doJSON("GET", "/api/tokens", token, "", &tokens))
+	utils.Equals(t, 1, len(tokens))
+}
+
+func TestPersonalAccessTokenAdminScope(t *testing.T) {
+	app := GetTestApp()
+	admin, err := signUpAdminUser(app)
+	utils.OK(t, err)
+	defer tearDownUser(app)
+	user, err := signUpTestUser(app)
+	utils.OK(t, err)
+	adminToken := createPersonalAccessToken(t, admin.Data.Token, `{"name":"admin","scopes":["admin"]}`)
+	filesToken := createPersonalAccessToken(t, admin.Data.Token, `{"name":"files","scopes":["files:read"]}`)
+	utils.Equals(t, http.StatusOK, doJSON("GET", "/api/admin/users", adminToken.Token, "", nil))
+	utils.Equals(t, http.StatusForbidden, doJSON("GET", "/api/admin/users", filesToken.Token, "", nil))
+
+	// token of disabled user can not be used
+	userToken := createPersonalAccessToken(t, user.Data.Token, `{"name":"files","scopes":["files:read"]}`)
+	utils.Equals(t, http.StatusOK, doJSON("GET", "/api/folders/root", userToken.Token, "", nil))
+	utils.Equals(t, http.StatusOK, doJSON("DELETE", "/api/admin/users/"+user.Data.ID, adminToken.Token, "", nil))
+	utils.Equals(t, http.StatusUnauthorized, doJSON("GET", "/api/folders/root", userToken.Token, "", nil))
+}
@@ -0,0 +1,60 @@
+package e2e
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/utils"
+)
+
+func TestDiskQuota(t *testing.T) {
+	app := GetTestApp()
+	userResponse, _ := signUpTestUser(app)
+	token := userResponse.Data.Token
+	userID := userResponse.Data.ID
+	defer func() {
+		tearDownUser(app)
+		tearDownStorages()
+	}()
+	upload := func(url, fileName, content, declaredSize string) *httptest.ResponseRecorder {
+		return uploadFile(url, token, fileName, content, map[string]string{"X-File-Size": declaredSize})
+	}
+	models.GetDB().Model(&models.Profile{}).Where("user_id = ?", userID).Update("disk_limit", 20)
+
+	utils.Equals(t, http.StatusCreated, upload("/api/upload/files/root", "1.file", "this is 1.file", "14").Code)
+	utils.Equals(t, uint64(14), getUsageDiskSize(userID))
+	// declared size is checked before upload
+	utils.Equals(t, http.StatusRequestEntityTooLarge, upload("/api/upload/files/root", "2.file", "this is 2.file", "100").Code)
+	utils.Equals(t, http.StatusInsufficientStorage, upload("/api/upload/files/root", "2.file", "this is 2.file", "14").Code)
+	// wrong declared size is still checked when save the file
+	utils.Equals(t, http.StatusInsufficientStorage, upload("/api/upload/files/root", "2.file", "this is 2.file", "1").Code)
+	var counter int
+	models.GetDB().Model(&models.StorageFile{}).Where("file_name = ?", "2.file").Count(&counter)
+	utils.Equals(t, 0, counter)
+	models.GetDB().Model(&models.Blob{}).Count(&counter)
+	utils.Equals(t, 1, counter)
+	utils.Equals(t, uint64(14), getUsageDiskSize(userID))
+	rr := tusRequest("POST", "/api/tus/folders/root", token, map[string]string{
+		"Upload-Length":   "100",
+		"Upload-Metadata": "filename dHVzLmZpbGU=",
+	}, nil)
+	utils.Equals(t, http.StatusRequestEntityTooLarge, rr.Code)
+
+	// new version is also counted in quota
+	rr = upload("/api/upload/files/root?version=true", "1.file", "this is 1.file again", "1")
+	utils.Equals(t, http.StatusInsufficientStorage, rr.Code)
+	file := models.StorageFile{}
+	models.GetDB().Where("file_name = ?", "1.file").First(&file)
+	models.GetDB().Model(&models.FileVersion{}).Count(&counter)
+	utils.Equals(t, 0, counter)
+	utils.Equals(t, int64(14), file.FileSize)
+	utils.Equals(t, http.StatusCreated, upload("/api/upload/files/root", "3.file", "3", "1").Code)
+
+	// usage is released after delete from trash
+	utils.Equals(t, http.StatusOK, doRequest("DELETE", "/api/files/"+file.ID, token).Code)
+	utils.Equals(t, uint64(15), getUsageDiskSize(userID))
+	utils.Equals(t, http.StatusOK, doRequest("DELETE", "/api/trash", token).Code)
+	utils.Equals(t, uint64(1), getUsageDiskSize(userID))
+}
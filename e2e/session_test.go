@@ -0,0 +1,155 @@
+package e2e
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/utils"
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+func getProfileWithToken(token string) int {
+	return doRequest("GET", "/api/profile", token).Code
+}
+
+func refreshToken(refreshToken string) (*UserResponse, int) {
+	body, _ := json.Marshal(map[string]string{"refresh_token": refreshToken})
+	req, _ := http.NewRequest("POST", "/api/auth/refresh", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+	message := &UserResponse{}
+	if rr.Code == http.StatusOK {
+		json.NewDecoder(rr.Body).Decode(message)
+	}
+	return message, rr.Code
+}
+
+func TestRefreshToken(t *testing.T) {
+	app := GetTestApp()
+	response, err := signUpTestUser(app)
+	utils.OK(t, err)
+	defer tearDownUser(app)
+	utils.Assert(t, response.Data.RefreshToken != "", "refresh token is empty")
+
+	refreshed, code := refreshToken(response.Data.RefreshToken)
+	utils.Equals(t, http.StatusOK, code)
+	utils.Equals(t, response.Data.ID, refreshed.Data.ID)
+	utils.Assert(t, refreshed.Data.Token != response.Data.Token, "access token not changed")
+	utils.Assert(t, refreshed.Data.RefreshToken != response.Data.RefreshToken, "refresh token not changed")
+
+	// old tokens can not be used after refresh
+	utils.Equals(t, http.StatusUnauthorized, getProfileWithToken(response.Data.Token))
+	_, code = refreshToken(response.Data.RefreshToken)
+	utils.Equals(t, http.StatusUnauthorized, code)
+	utils.Equals(t, http.StatusOK, getProfileWithToken(refreshed.Data.Token))
+
+	_, code = refreshToken("not-exist")
+	utils.Equals(t, http.StatusUnauthorized, code)
+	req, _ := http.NewRequest("POST", "/api/auth/refresh", bytes.NewBufferString(`{}`))
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+	utils.Equals(t, http.StatusBadRequest, rr.Code)
+
+	// expired session can not be refreshed
+	models.GetDB().Model(&models.Session{}).Where("user_id = ?", response.Data.ID).UpdateColumn(
+		"expires_at", time.Now().Add(-time.Minute),
+	)
+	_, code = refreshToken(refreshed.Data.RefreshToken)
+	utils.Equals(t, http.StatusUnauthorized, code)
+}
+
+func TestLogoutRevokeSession(t *testing.T) {
+	app := GetTestApp()
+	response, err := signUpTestUser(app)
+	utils.OK(t, err)
+	defer tearDownUser(app)
+	other, err := signIn(testUser)
+	utils.OK(t, err)
+
+	req, _ := http.NewRequest("GET", "/api/auth/logout", nil)
+	req.Header.Set("Authorization", "Bearer "+response.Data.Token)
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+	utils.Equals(t, http.StatusOK, rr.Code)
+
+	utils.Equals(t, http.StatusUnauthorized, getProfileWithToken(response.Data.Token))
+	_, code := refreshToken(response.Data.RefreshToken)
+	utils.Equals(t, http.StatusUnauthorized, code)
+	// other sessions of user are not changed
+	utils.Equals(t, http.StatusOK, getProfileWithToken(other.Data.Token))
+}
+
+func TestPasswordChangeRevokeSessions(t *testing.T) {
+	app := GetTestApp()
+	response, err := signUpTestUser(app)
+	utils.OK(t, err)
+	defer tearDownUser(app)
+	other, err := signIn(testUser)
+	utils.OK(t, err)
+
+	req, _ := http.NewRequest("POST", "/api/auth/password", bytes.NewBufferString(
+		`{"password":"123456","new_password":"654321"}`,
+	))
+	req.Header.Set("Authorization", "Bearer "+response.Data.Token)
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+	utils.Equals(t, http.StatusOK, rr.Code)
+	for _, session := range []*UserResponse{response, other} {
+		utils.Equals(t, http.StatusUnauthorized, getProfileWithToken(session.Data.Token))
+		_, code := refreshToken(session.Data.RefreshToken)
+		utils.Equals(t, http.StatusUnauthorized, code)
+	}
+	login, err := signIn(&models.User{Email: testUser.Email, Password: "654321"})
+	utils.OK(t, err)
+	utils.Equals(t, http.StatusOK, getProfileWithToken(login.Data.Token))
+}
+
+func TestAdminRevokeSessions(t *testing.T) {
+	app := GetTestApp()
+	admin, err := signUpAdminUser(app)
+	utils.OK(t, err)
+	defer tearDownUser(app)
+	testCases := []struct {
+		method string
+		url    string
+		body   string
+	}{
+		{method: "PUT", url: "/api/admin/users/%s/password", body: `{"password":"654321"}`},
+		{method: "DELETE", url: "/api/admin/users/%s"},
+	}
+	for _, tc := range testCases {
+		response, err := signUpTestUser(app)
+		utils.OK(t, err)
+		req, _ := http.NewRequest(tc.method, fmt.Sprintf(tc.url, response.Data.ID), bytes.NewBufferString(tc.body))
+		req.Header.Set("Authorization", "Bearer "+admin.Data.Token)
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+		utils.Equals(t, http.StatusOK, rr.Code)
+		utils.Equals(t, http.StatusUnauthorized, getProfileWithToken(response.Data.Token))
+		_, code := refreshToken(response.Data.RefreshToken)
+		utils.Equals(t, http.StatusUnauthorized, code)
+		models.GetDB().Unscoped().Where("id = ?", response.Data.ID).Delete(&models.User{})
+	}
+}
+
+func TestTokenWithoutID(t *testing.T) {
+	app := GetTestApp()
+	response, err := signUpTestUser(app)
+	utils.OK(t, err)
+	defer tearDownUser(app)
+	// token created by old version has no id and can not be revoked
+	token, err := jwt.NewWithClaims(jwt.GetSigningMethod("HS256"), &models.Token{
+		UserID: response.Data.ID,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+	}).SignedString([]byte(app.Config.Application.Token))
+	utils.OK(t, err)
+	utils.Equals(t, http.StatusUnauthorized, getProfileWithToken(token))
+}
@@ -2,12 +2,16 @@ package e2e
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/Dudobird/dudo-server/models"
 	"github.com/Dudobird/dudo-server/utils"
 )
 
@@ -67,3 +71,381 @@ func TestCreateShareFile(t *testing.T) {
 		}
 	}
 }
+
+func TestGetShareFileWithRange(t *testing.T) {
+	app := GetTestApp()
+	userResponse, _ := signUpTestUser(app)
+	token := userResponse.Data.Token
+	_, files := setUpRealFiles(token)
+	defer func() {
+		tearDownUser(app)
+		tearDownStorages()
+	}()
+	shareToken := createShareToken(t, token, files["2.file"].ID)
+	url := "/shares?token=" + base64.StdEncoding.EncodeToString([]byte(shareToken))
+
+	req, _ := http.NewRequest("GET", url, nil)
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+	utils.Equals(t, 200, rr.Code)
+	utils.Equals(t, "this is 2.file", rr.Body.String())
+
+	req, _ = http.NewRequest("GET", url, nil)
+	req.Header.Set("Range", "bytes=0-3")
+	rr = httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+	utils.Equals(t, 206, rr.Code)
+	utils.Equals(t, "this", rr.Body.String())
+	utils.Equals(t, "bytes 0-3/14", rr.Header().Get("Content-Range"))
+}
+
+func createShareToken(t *testing.T, token string, fileID string) string {
+	post := []byte(fmt.Sprintf(`{"file_id":"%s","expire_days":7}`, fileID))
+	req, _ := http.NewRequest("POST", "/api/shares", bytes.NewBuffer(post))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+	utils.Equals(t, 201, rr.Code)
+	message := struct {
+		Data struct {
+			Token string `json:"token"`
+		}
+	}{}
+	utils.OK(t, json.NewDecoder(rr.Body).Decode(&message))
+	return message.Data.Token
+}
+
+func unlockShare(shareToken, password string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(map[string]string{"token": shareToken, "password": password})
+	req := httptest.NewRequest("POST", "/shares/unlock", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestPasswordProtectedShare(t *testing.T) {
+	app := GetTestApp()
+	userResponse, _ := signUpTestUser(app)
+	token := userResponse.Data.Token
+	_, files := setUpRealFiles(token)
+	defer func() {
+		tearDownUser(app)
+		tearDownStorages()
+	}()
+	share := struct {
+		Token string `json:"token"`
+	}{}
+	body := fmt.Sprintf(`{"file_id":"%s","expire_days":7,"password":"secret"}`, files["2.file"].ID)
+	utils.Equals(t, http.StatusCreated, doJSON("POST", "/api/shares", token, body, &share))
+	shareToken := base64.StdEncoding.EncodeToString([]byte(share.Token))
+	download := func(cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/shares?token="+shareToken, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	shares := []struct {
+		ID                string `json:"id"`
+		PasswordProtected bool   `json:"password_protected"`
+	}{}
+	utils.Equals(t, http.StatusOK, doJSON("GET", "/api/shares", token, "", &shares))
+	utils.Equals(t, 1, len(shares))
+	utils.Assert(t, shares[0].PasswordProtected, "share should be protected by password")
+
+	utils.Equals(t, http.StatusUnauthorized, download(nil).Code)
+	utils.Equals(t, http.StatusForbidden, unlockShare(shareToken, "wrong").Code)
+	utils.Equals(t, http.StatusBadRequest, unlockShare("", "secret").Code)
+	rr := unlockShare(shareToken, "secret")
+	utils.Equals(t, http.StatusOK, rr.Code)
+	cookies := rr.Result().Cookies()
+	utils.Equals(t, 1, len(cookies))
+	utils.Assert(t, cookies[0].HttpOnly, "unlock cookie should be http only")
+	rr = download(cookies[0])
+	utils.Equals(t, http.StatusOK, rr.Code)
+	utils.Equals(t, "this is 2.file", rr.Body.String())
+
+	// cookie of other share is not accepted
+	other := createShareToken(t, token, files["1.file"].ID)
+	otherToken := base64.StdEncoding.EncodeToString([]byte(other))
+	utils.Equals(t, http.StatusOK, unlockShare(otherToken, "").Code)
+	forged := &http.Cookie{Name: cookies[0].Name, Value: "not-valid"}
+	utils.Equals(t, http.StatusUnauthorized, download(forged).Code)
+
+	// share is locked after too many wrong attempts, even for correct password
+	for i := 0; i < 4; i++ {
+		utils.Equals(t, http.StatusForbidden, unlockShare(shareToken, "wrong").Code)
+	}
+	utils.Equals(t, http.StatusTooManyRequests, unlockShare(shareToken, "wrong").Code)
+	utils.Equals(t, http.StatusTooManyRequests, unlockShare(shareToken, "secret").Code)
+	// unlocked cookie still works until it expires
+	utils.Equals(t, http.StatusOK, download(cookies[0]).Code)
+
+	app.DB.Model(&models.ShareFiles{}).Where("id = ?", shares[0].ID).UpdateColumn(
+		"locked_until", time.Now().Add(-time.Minute),
+	)
+	utils.Equals(t, http.StatusOK, unlockShare(shareToken, "secret").Code)
+
+	// parallel wrong attempts are limited too
+	statuses := make(chan int, 10)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses <- unlockShare(shareToken, "wrong").Code
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+	forbidden := 0
+	for status := range statuses {
+		if status == http.StatusForbidden {
+			forbidden++
+			continue
+		}
+		utils.Equals(t, http.StatusTooManyRequests, status)
+	}
+	utils.Assert(t, forbidden < 5, "only attempts before lock should be checked")
+	utils.Equals(t, http.StatusTooManyRequests, unlockShare(shareToken, "secret").Code)
+}
+
+func TestShareDownloadLimitAndAccessLogs(t *testing.T) {
+	app := GetTestApp()
+	userResponse, _ := signUpTestUser(app)
+	token := userResponse.Data.Token
+	folders, files := setUpRealFiles(token)
+	defer func() {
+		tearDownUser(app)
+		tearDownStorages()
+	}()
+	share := struct {
+		Token string `json:"token"`
+	}{}
+	body := fmt.Sprintf(`{"file_id":"%s","expire_days":7,"max_downloads":-1}`, files["2.file"].ID)
+	utils.Equals(t, http.StatusBadRequest, doJSON("POST", "/api/shares", token, body, nil))
+	body = fmt.Sprintf(`{"file_id":"%s","expire_days":7,"max_downloads":2}`, files["2.file"].ID)
+	utils.Equals(t, http.StatusCreated, doJSON("POST", "/api/shares", token, body, &share))
+	url := "/shares?token=" + base64.StdEncoding.EncodeToString([]byte(share.Token))
+	download := func() int {
+		req := httptest.NewRequest("GET", url, nil)
+		req.Header.Set("User-Agent", "dudo-test")
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	utils.Equals(t, http.StatusOK, download())
+	utils.Equals(t, http.StatusOK, download())
+	utils.Equals(t, http.StatusGone, download())
+
+	shares := []struct {
+		ID            string `json:"id"`
+		MaxDownloads  int    `json:"max_downloads"`
+		DownloadCount int    `json:"download_count"`
+	}{}
+	utils.Equals(t, http.StatusOK, doJSON("GET", "/api/shares", token, "", &shares))
+	utils.Equals(t, 1, len(shares))
+	utils.Equals(t, 2, shares[0].MaxDownloads)
+	utils.Equals(t, 2, shares[0].DownloadCount)
+
+	logs := []models.ShareAccessLog{}
+	utils.Equals(t, http.StatusOK, doJSON("GET", "/api/share/"+shares[0].ID+"/logs", token, "", &logs))
+	utils.Equals(t, 3, len(logs))
+	// newest log is the failed one
+	utils.Equals(t, http.StatusGone, logs[0].Status)
+	utils.Equals(t, false, logs[0].Success)
+	for _, entry := range logs[1:] {
+		utils.Equals(t, http.StatusOK, entry.Status)
+		utils.Equals(t, true, entry.Success)
+		utils.Equals(t, int64(len("this is 2.file")), entry.BytesServed)
+		utils.Equals(t, "192.0.2.1", entry.IP)
+		utils.Equals(t, "dudo-test", entry.UserAgent)
+	}
+
+	// failed download is not counted
+	body = fmt.Sprintf(`{"file_id":"%s","expire_days":7,"max_downloads":1}`, files["1.file"].ID)
+	utils.Equals(t, http.StatusCreated, doJSON("POST", "/api/shares", token, body, &share))
+	url = "/shares?token=" + base64.StdEncoding.EncodeToString([]byte(share.Token))
+	models.GetDB().Unscoped().Where("id = ?", files["1.file"].ID).Delete(&models.StorageFile{})
+	utils.Equals(t, http.StatusNotFound, download())
+	failed := &models.ShareFiles{}
+	utils.OK(t, models.GetDB().Where("file_id = ?", files["1.file"].ID).First(failed).Error)
+	utils.Equals(t, 0, failed.DownloadCount)
+
+	// only downloads from beginning of file are counted
+	body = fmt.Sprintf(`{"file_id":"%s","expire_days":7,"max_downloads":1}`, files["2.file"].ID)
+	utils.Equals(t, http.StatusCreated, doJSON("POST", "/api/shares", token, body, &share))
+	url = "/shares?token=" + base64.StdEncoding.EncodeToString([]byte(share.Token))
+	rangeDownload := func(ranges string, modifiedSince time.Time) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", url, nil)
+		req.Header.Set("Range", ranges)
+		if !modifiedSince.IsZero() {
+			req.Header.Set("If-Modified-Since", modifiedSince.UTC().Format(http.TimeFormat))
+		}
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, req)
+		return rr
+	}
+	future := time.Now().Add(time.Hour)
+	utils.Equals(t, http.StatusNotModified, rangeDownload("", future).Code)
+	rr := rangeDownload("bytes=0-3", time.Time{})
+	utils.Equals(t, http.StatusPartialContent, rr.Code)
+	utils.Equals(t, "this", rr.Body.String())
+	rr = rangeDownload("bytes=4-", time.Time{})
+	utils.Equals(t, http.StatusPartialContent, rr.Code)
+	utils.Equals(t, " is 2.file", rr.Body.String())
+	rr = rangeDownload("bytes=-10", time.Time{})
+	utils.Equals(t, http.StatusPartialContent, rr.Code)
+	utils.Equals(t, " is 2.file", rr.Body.String())
+	// ranges which may get the whole file are counted
+	for _, ranges := range []string{"bytes=0-", "bytes=-14", "bytes=-100", "bytes=4-,0-0", "bytes=1-,1-", "bytes=abc"} {
+		utils.Equals(t, http.StatusGone, rangeDownload(ranges, time.Time{}).Code)
+	}
+	limited := &models.ShareFiles{}
+	utils.OK(t, models.GetDB().Where("file_id = ? and max_downloads = 1", files["2.file"].ID).First(limited).Error)
+	utils.Equals(t, 1, limited.DownloadCount)
+
+	// folder is always downloaded as a whole zip
+	body = fmt.Sprintf(`{"file_id":"%s","expire_days":7,"max_downloads":1}`, folders["files"].ID)
+	utils.Equals(t, http.StatusCreated, doJSON("POST", "/api/shares", token, body, &share))
+	url = "/shares?token=" + base64.StdEncoding.EncodeToString([]byte(share.Token))
+	rr = rangeDownload("bytes=5-", time.Time{})
+	utils.Equals(t, http.StatusOK, rr.Code)
+	utils.Equals(t, "application/zip", rr.Header().Get("Content-Type"))
+	utils.Equals(t, http.StatusGone, rangeDownload("bytes=5-", time.Time{}).Code)
+
+	// logs of other user's share are not visible
+	other, err := signUp(&models.User{Email: "other@example.com", Password: "123456"})
+	utils.OK(t, err)
+	utils.Equals(t, http.StatusNotFound, doJSON("GET", "/api/share/"+shares[0].ID+"/logs", other.Data.Token, "", nil))
+	utils.Equals(t, http.StatusNotFound, doJSON("GET", "/api/share/not-exist/logs", token, "", nil))
+
+	// logs are deleted with share
+	utils.Equals(t, http.StatusOK, doJSON("DELETE", "/api/share/"+shares[0].ID, token, "", nil))
+	count := 0
+	models.GetDB().Model(&models.ShareAccessLog{}).Where("share_id = ?", shares[0].ID).Count(&count)
+	utils.Equals(t, 0, count)
+}
+
+func TestBrowseSharedFolder(t *testing.T) {
+	app := GetTestApp()
+	userResponse, _ := signUpTestUser(app)
+	token := userResponse.Data.Token
+	folders, files := setUpRealFiles(token)
+	defer func() {
+		tearDownUser(app)
+		tearDownStorages()
+	}()
+	sub := models.StorageFile{}
+	body := fmt.Sprintf(`{"is_dir":true,"file_name":"sub","folder_id":"%s"}`, folders["files"].ID)
+	utils.Equals(t, http.StatusCreated, doJSON("POST", "/api/folders", token, body, nil))
+	utils.OK(t, app.DB.Where("file_name = ? and folder_id = ?", "sub", folders["files"].ID).First(&sub).Error)
+	rr, err := fileUploadRequest("/api/upload/files/"+sub.ID, "uploadfile", "./files/2.file", token, "")
+	utils.OK(t, err)
+	utils.Equals(t, http.StatusCreated, rr.Code)
+	outside := models.StorageFile{}
+	utils.OK(t, app.DB.Where("folder_id = ?", folders["backup"].ID).First(&outside).Error)
+
+	shareToken := base64.StdEncoding.EncodeToString([]byte(createShareToken(t, token, folders["files"].ID)))
+	type listing struct {
+		Folder struct {
+			ID    string `json:"id"`
+			IsDir bool   `json:"is_dir"`
+		} `json:"folder"`
+		Path  string `json:"path"`
+		Files []struct {
+			ID       string `json:"id"`
+			FileName string `json:"file_name"`
+			IsDir    bool   `json:"is_dir"`
+			UserID   string `json:"user_id"`
+		} `json:"files"`
+	}
+	list := func(query string) (*listing, int) {
+		data := &listing{}
+		return data, doJSON("GET", "/shares/files?token="+shareToken+query, "", "", data)
+	}
+	download := func(query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		app.Router.ServeHTTP(rr, httptest.NewRequest("GET", "/shares/download?token="+shareToken+query, nil))
+		return rr
+	}
+
+	root, status := list("")
+	utils.Equals(t, http.StatusOK, status)
+	utils.Equals(t, folders["files"].ID, root.Folder.ID)
+	utils.Equals(t, "/", root.Path)
+	utils.Equals(t, 4, len(root.Files))
+	// folders are listed first and owner is not shown
+	utils.Equals(t, "sub", root.Files[0].FileName)
+	utils.Equals(t, "", root.Files[0].UserID)
+
+	for _, query := range []string{"&path=sub", "&path=/sub/", "&id=" + sub.ID} {
+		folder, status := list(query)
+		utils.Equals(t, http.StatusOK, status)
+		utils.Equals(t, sub.ID, folder.Folder.ID)
+		utils.Equals(t, "/sub", folder.Path)
+		utils.Equals(t, 1, len(folder.Files))
+		utils.Equals(t, "2.file", folder.Files[0].FileName)
+	}
+	_, status = list("&id=" + files["2.file"].ID)
+	utils.Equals(t, http.StatusBadRequest, status)
+
+	// files outside of shared folder are not found
+	for _, query := range []string{
+		"&id=" + folders["backup"].ID,
+		"&id=" + outside.ID,
+		"&path=../backup",
+		"&path=sub/../../backup",
+		"&path=not-exist",
+		"&id=not-exist",
+	} {
+		_, status = list(query)
+		utils.Equals(t, http.StatusNotFound, status)
+		utils.Equals(t, http.StatusNotFound, download(query).Code)
+	}
+
+	rr = download("&path=sub/2.file")
+	utils.Equals(t, http.StatusOK, rr.Code)
+	utils.Equals(t, "this is 2.file", rr.Body.String())
+	rr = download("&id=" + files["1.file"].ID)
+	utils.Equals(t, http.StatusOK, rr.Code)
+	rr = download("&id=" + sub.ID)
+	utils.Equals(t, http.StatusOK, rr.Code)
+	utils.Equals(t, "application/zip", rr.Header().Get("Content-Type"))
+
+	share := &models.ShareFiles{}
+	utils.OK(t, app.DB.Where("file_id = ?", folders["files"].ID).First(share).Error)
+	utils.Equals(t, 3, share.DownloadCount)
+	logs := []models.ShareAccessLog{}
+	utils.Equals(t, http.StatusOK, doJSON("GET", "/api/share/"+share.ID+"/logs", token, "", &logs))
+	utils.Equals(t, sub.ID, logs[0].FileID)
+
+	// other users' files can not be shared
+	other, err := signUp(&models.User{Email: "other@example.com", Password: "123456"})
+	utils.OK(t, err)
+	body = fmt.Sprintf(`{"file_id":"%s","expire_days":7}`, folders["files"].ID)
+	utils.Equals(t, http.StatusNotFound, doJSON("POST", "/api/shares", other.Data.Token, body, nil))
+
+	// folder share with password must be unlocked for browsing
+	locked := struct {
+		Token string `json:"token"`
+	}{}
+	body = fmt.Sprintf(`{"file_id":"%s","expire_days":7,"password":"secret"}`, folders["files"].ID)
+	utils.Equals(t, http.StatusCreated, doJSON("POST", "/api/shares", token, body, &locked))
+	shareToken = base64.StdEncoding.EncodeToString([]byte(locked.Token))
+	_, status = list("")
+	utils.Equals(t, http.StatusUnauthorized, status)
+	utils.Equals(t, http.StatusUnauthorized, download("&id="+sub.ID).Code)
+	rr = unlockShare(shareToken, "secret")
+	utils.Equals(t, http.StatusOK, rr.Code)
+	req := httptest.NewRequest("GET", "/shares/files?token="+shareToken, nil)
+	req.AddCookie(rr.Result().Cookies()[0])
+	rr = httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+	utils.Equals(t, http.StatusOK, rr.Code)
+}
@@ -0,0 +1,106 @@
+package e2e
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/utils"
+)
+
+// TrashResponse save the response of trash list api
+type TrashResponse struct {
+	Status  int                  `json:"status"`
+	Message string               `json:"message"`
+	Data    []models.StorageFile `json:"data"`
+}
+
+func listTrash(t *testing.T, token string) []models.StorageFile {
+	rr := doRequest("GET", "/api/trash", token)
+	utils.Equals(t, http.StatusOK, rr.Code)
+	message := TrashResponse{}
+	utils.OK(t, json.NewDecoder(rr.Body).Decode(&message))
+	return message.Data
+}
+
+func TestTrashAndRestore(t *testing.T) {
+	app := GetTestApp()
+	userResponse, _ := signUpTestUser(app)
+	token := userResponse.Data.Token
+	defer func() {
+		tearDownUser(app)
+		tearDownStorages()
+	}()
+	folders, files := setUpRealFiles(token)
+
+	rr := doRequest("DELETE", "/api/files/"+files["2.file"].ID, token)
+	utils.Equals(t, http.StatusOK, rr.Code)
+	rr = doRequest("DELETE", "/api/files/"+folders["files"].ID, token)
+	utils.Equals(t, http.StatusOK, rr.Code)
+	// sub files are not listed in trash
+	trash := listTrash(t, token)
+	utils.Equals(t, 2, len(trash))
+	utils.Equals(t, "files", trash[0].FileName)
+	utils.Equals(t, "2.file", trash[1].FileName)
+	for _, name := range []string{"1.file", "2.file", "3.file"} {
+		rr = doRequest("GET", "/api/files/"+files[name].ID, token)
+		utils.Equals(t, http.StatusNotFound, rr.Code)
+	}
+
+	// parent is in trash, restore to root
+	rr = doRequest("POST", "/api/trash/"+files["2.file"].ID+"/restore", token)
+	utils.Equals(t, http.StatusOK, rr.Code)
+	file := models.StorageFile{}
+	models.GetDB().Where("id = ?", files["2.file"].ID).First(&file)
+	utils.Equals(t, "root", file.FolderID)
+
+	rr = doRequest("POST", "/api/trash/"+folders["files"].ID+"/restore", token)
+	utils.Equals(t, http.StatusOK, rr.Code)
+	for _, name := range []string{"1.file", "3.file"} {
+		rr = doRequest("GET", "/api/files/"+files[name].ID, token)
+		utils.Equals(t, http.StatusOK, rr.Code)
+	}
+	utils.Equals(t, 0, len(listTrash(t, token)))
+
+	// restore fail when same name exist in folder
+	rr = doRequest("DELETE", "/api/files/"+files["2.file"].ID, token)
+	utils.Equals(t, http.StatusOK, rr.Code)
+	body := `{"is_dir":true,"file_name":"2.file","folder_id":"root"}`
+	utils.Equals(t, http.StatusCreated, doJSON("POST", "/api/folders", token, body, nil))
+	rr = doRequest("POST", "/api/trash/"+files["2.file"].ID+"/restore", token)
+	utils.Equals(t, http.StatusBadRequest, rr.Code)
+
+	rr = doRequest("POST", "/api/trash/not-exist/restore", token)
+	utils.Equals(t, http.StatusNotFound, rr.Code)
+}
+
+func TestPurgeTrash(t *testing.T) {
+	app := GetTestApp()
+	userResponse, _ := signUpTestUser(app)
+	token := userResponse.Data.Token
+	defer func() {
+		tearDownUser(app)
+		tearDownStorages()
+	}()
+	folders, files := setUpRealFiles(token)
+	rr := doRequest("DELETE", "/api/files/"+folders["backup"].ID, token)
+	utils.Equals(t, http.StatusOK, rr.Code)
+
+	// not expired yet
+	app.PurgeTrash(time.Now().Add(-time.Hour))
+	utils.Equals(t, 1, len(listTrash(t, token)))
+
+	app.PurgeTrash(time.Now().Add(time.Second))
+	utils.Equals(t, 0, len(listTrash(t, token)))
+	var counter int
+	models.GetDB().Unscoped().Model(&models.StorageFile{}).Where("folder_id = ?", folders["backup"].ID).Count(&counter)
+	utils.Equals(t, 0, counter)
+	blob := models.Blob{}
+	models.GetDB().Where("hash = ?", files["1.file"].Hash).First(&blob)
+	utils.Equals(t, int64(1), blob.RefCount)
+	// content is still used by files/1.file
+	rr = doRequest("GET", "/api/download/files/"+files["1.file"].ID, token)
+	utils.Equals(t, http.StatusOK, rr.Code)
+}
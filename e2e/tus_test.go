@@ -0,0 +1,250 @@
+package e2e
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/utils"
+)
+
+func tusRequest(method, url, token string, headers map[string]string, body []byte) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, url, bytes.NewBuffer(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rr := httptest.NewRecorder()
+	app.Router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestTusUpload(t *testing.T) {
+	app := GetTestApp()
+	userResponse, _ := signUpTestUser(app)
+	token := userResponse.Data.Token
+	defer func() {
+		tearDownUser(app)
+		tearDownStorages()
+	}()
+	content := []byte("this is a resumable file")
+	metadata := "filename " + base64.StdEncoding.EncodeToString([]byte("tus.file"))
+	filePath := base64.StdEncoding.EncodeToString([]byte("/a/b/tus.file"))
+
+	rr := tusRequest("POST", "/api/tus/folders/root", token, map[string]string{
+		"Upload-Length":   "24",
+		"Upload-Metadata": metadata,
+		"X-FilePath":      filePath,
+		"Tus-Resumable":   "0.2.0",
+	}, nil)
+	utils.Equals(t, http.StatusPreconditionFailed, rr.Code)
+
+	// file name with path is not accepted
+	for _, name := range []string{"../x", "a/b", "a\\b", "..", "."} {
+		rr = tusRequest("POST", "/api/tus/folders/root", token, map[string]string{
+			"Upload-Length":   "24",
+			"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte(name)),
+		}, nil)
+		utils.Equals(t, http.StatusBadRequest, rr.Code)
+	}
+
+	rr = tusRequest("POST", "/api/tus/folders/root", token, map[string]string{
+		"Upload-Length":   "24",
+		"Upload-Metadata": metadata,
+		"X-FilePath":      filePath,
+	}, nil)
+	utils.Equals(t, http.StatusCreated, rr.Code)
+	location := rr.Header().Get("Location")
+	utils.Assert(t, location != "", "location of upload should not be empty")
+
+	rr = tusRequest("PATCH", location, token, map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": "0",
+	}, content[:10])
+	utils.Equals(t, http.StatusNoContent, rr.Code)
+	utils.Equals(t, "10", rr.Header().Get("Upload-Offset"))
+
+	// resume with wrong offset will fail
+	rr = tusRequest("PATCH", location, token, map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": "0",
+	}, content[10:])
+	utils.Equals(t, http.StatusConflict, rr.Code)
+
+	rr = tusRequest("HEAD", location, token, nil, nil)
+	utils.Equals(t, http.StatusOK, rr.Code)
+	utils.Equals(t, "10", rr.Header().Get("Upload-Offset"))
+	utils.Equals(t, "24", rr.Header().Get("Upload-Length"))
+
+	rr = tusRequest("PATCH", location, token, map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": "10",
+	}, content[10:])
+	utils.Equals(t, http.StatusNoContent, rr.Code)
+	utils.Equals(t, "24", rr.Header().Get("Upload-Offset"))
+	fileID := rr.Header().Get("X-FileID")
+	utils.Assert(t, fileID != "", "file id should return after upload complete")
+
+	// folders in X-FilePath are created
+	parentID := "root"
+	for _, folder := range []string{"a", "b"} {
+		s := &models.StorageFile{}
+		models.GetDB().Model(&models.StorageFile{}).Where("file_name = ? and user_id = ?", folder, userResponse.Data.ID).First(&s)
+		utils.Equals(t, parentID, s.FolderID)
+		parentID = s.ID
+	}
+	s := &models.StorageFile{}
+	models.GetDB().Model(&models.StorageFile{}).Where("id = ?", fileID).First(s)
+	utils.Equals(t, parentID, s.FolderID)
+	utils.Equals(t, "tus.file", s.FileName)
+	utils.Equals(t, int64(24), s.FileSize)
+
+	rr = doRequest("GET", "/api/download/files/"+fileID, token)
+	utils.Equals(t, http.StatusOK, rr.Code)
+	utils.Equals(t, string(content), rr.Body.String())
+
+	// upload same file name again will fail
+	rr = tusRequest("POST", "/api/tus/folders/root", token, map[string]string{
+		"Upload-Length":   "24",
+		"Upload-Metadata": metadata,
+		"X-FilePath":      filePath,
+	}, nil)
+	utils.Equals(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestTusTerminateUpload(t *testing.T) {
+	app := GetTestApp()
+	userResponse, _ := signUpTestUser(app)
+	token := userResponse.Data.Token
+	defer func() {
+		tearDownUser(app)
+		tearDownStorages()
+	}()
+	rr := tusRequest("POST", "/api/tus/folders/root", token, map[string]string{
+		"Upload-Length":   "24",
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("tus.file")),
+	}, nil)
+	utils.Equals(t, http.StatusCreated, rr.Code)
+	location := rr.Header().Get("Location")
+
+	rr = tusRequest("PATCH", location, token, map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": "0",
+	}, []byte("this is"))
+	utils.Equals(t, http.StatusNoContent, rr.Code)
+
+	rr = tusRequest("DELETE", location, token, nil, nil)
+	utils.Equals(t, http.StatusNoContent, rr.Code)
+
+	rr = tusRequest("HEAD", location, token, nil, nil)
+	utils.Equals(t, http.StatusNotFound, rr.Code)
+	var counter int
+	models.GetDB().Model(&models.StorageFile{}).Where("user_id = ?", userResponse.Data.ID).Count(&counter)
+	utils.Equals(t, 0, counter)
+}
+
+func TestTusConcurrentPatch(t *testing.T) {
+	app := GetTestApp()
+	userResponse, _ := signUpTestUser(app)
+	token := userResponse.Data.Token
+	defer func() {
+		tearDownUser(app)
+		tearDownStorages()
+	}()
+	rr := tusRequest("POST", "/api/tus/folders/root", token, map[string]string{
+		"Upload-Length":   "10",
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("tus.file")),
+	}, nil)
+	utils.Equals(t, http.StatusCreated, rr.Code)
+	location := rr.Header().Get("Location")
+
+	// requests with same offset, only one of them is accepted
+	contents := []string{"aaaaaaaaaa", "bbbbbbbbbb"}
+	results := make([]*httptest.ResponseRecorder, len(contents))
+	var wg sync.WaitGroup
+	for i := range contents {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = tusRequest("PATCH", location, token, map[string]string{
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "0",
+			}, []byte(contents[i]))
+		}(i)
+	}
+	wg.Wait()
+	winner := -1
+	for i, result := range results {
+		if result.Code == http.StatusNoContent {
+			utils.Assert(t, winner == -1, "only one request should be accepted")
+			winner = i
+		} else {
+			utils.Equals(t, http.StatusConflict, result.Code)
+		}
+	}
+	utils.Assert(t, winner != -1, "one request should be accepted")
+	fileID := results[winner].Header().Get("X-FileID")
+	utils.Assert(t, fileID != "", "file id should return after upload complete")
+
+	rr = doRequest("GET", "/api/download/files/"+fileID, token)
+	utils.Equals(t, http.StatusOK, rr.Code)
+	utils.Equals(t, contents[winner], rr.Body.String())
+	var counter int
+	models.GetDB().Model(&models.UploadChunk{}).Count(&counter)
+	utils.Equals(t, 0, counter)
+}
+
+func TestTusRetryComplete(t *testing.T) {
+	app := GetTestApp()
+	userResponse, _ := signUpTestUser(app)
+	token := userResponse.Data.Token
+	defer func() {
+		tearDownUser(app)
+		tearDownStorages()
+	}()
+	rr := tusRequest("POST", "/api/tus/folders/root", token, map[string]string{
+		"Upload-Length":   "5",
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("retry.file")),
+	}, nil)
+	utils.Equals(t, http.StatusCreated, rr.Code)
+	location := rr.Header().Get("Location")
+
+	// file with same name is created before upload complete
+	utils.Equals(t, http.StatusCreated, uploadFile("/api/upload/files/root", token, "retry.file", "other", nil).Code)
+	conflict := &models.StorageFile{}
+	utils.OK(t, app.DB.Where("file_name = ? and user_id = ?", "retry.file", userResponse.Data.ID).First(conflict).Error)
+	rr = tusRequest("PATCH", location, token, map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": "0",
+	}, []byte("hello"))
+	utils.Equals(t, http.StatusBadRequest, rr.Code)
+	rr = tusRequest("HEAD", location, token, nil, nil)
+	utils.Equals(t, http.StatusBadRequest, rr.Code)
+
+	// upload is completed with retry after conflict is removed
+	utils.Equals(t, http.StatusOK, doJSON("DELETE", "/api/files/"+conflict.ID, token, "", nil))
+	rr = tusRequest("PATCH", location, token, map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": "5",
+	}, nil)
+	utils.Equals(t, http.StatusNoContent, rr.Code)
+	utils.Equals(t, "5", rr.Header().Get("Upload-Offset"))
+	fileID := rr.Header().Get("X-FileID")
+	utils.Assert(t, fileID != "", "file id should return after upload complete")
+	rr = tusRequest("HEAD", location, token, nil, nil)
+	utils.Equals(t, http.StatusOK, rr.Code)
+	utils.Equals(t, fileID, rr.Header().Get("X-FileID"))
+	rr = tusRequest("PATCH", location, token, map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": "5",
+	}, nil)
+	utils.Equals(t, http.StatusConflict, rr.Code)
+
+	rr = doRequest("GET", "/api/download/files/"+fileID, token)
+	utils.Equals(t, "hello", rr.Body.String())
+}
@@ -0,0 +1,150 @@
+package e2e
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/utils"
+)
+
+// enableTwoFactor enroll and confirm two factor for user, return secret and recovery codes
+func enableTwoFactor(t *testing.T, token string) (string, []string) {
+	enrollment := models.TwoFactorEnrollment{}
+	utils.Equals(t, http.StatusOK, doJSON("POST", "/api/auth/2fa/enroll", token, "", &enrollment))
+	utils.Assert(t, strings.HasPrefix(enrollment.URI, "otpauth://totp/"), "provisioning uri not correct")
+	utils.Equals(t, http.StatusForbidden, doJSON("POST", "/api/auth/2fa/confirm", token, `{"code":"000000"}`, nil))
+	code, err := utils.TOTPCode(enrollment.Secret, utils.TOTPStep(time.Now()))
+	utils.OK(t, err)
+	codes := struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{}
+	utils.Equals(t, http.StatusOK, doJSON("POST", "/api/auth/2fa/confirm", token, `{"code":"`+code+`"}`, &codes))
+	utils.Equals(t, 10, len(codes.RecoveryCodes))
+	utils.Equals(t, http.StatusBadRequest, doJSON("POST", "/api/auth/2fa/enroll", token, "", nil))
+	return enrollment.Secret, codes.RecoveryCodes
+}
+
+// signInMFAToken login with password and return the mfa token
+func signInMFAToken(t *testing.T, user *models.User) string {
+	challenge := models.MFAChallengeResponse{}
+	utils.Equals(t, http.StatusOK, doJSON("POST", "/api/auth/signin", "", string(user.ToJSONBytes()), &challenge))
+	utils.Assert(t, challenge.MFARequired, "login should require two factor code")
+	return challenge.MFAToken
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	app := GetTestApp()
+	response, err := signUpTestUser(app)
+	utils.OK(t, err)
+	defer tearDownUser(app)
+	token := response.Data.Token
+	status := models.TwoFactorStatus{}
+	utils.Equals(t, http.StatusOK, doJSON("GET", "/api/auth/2fa", token, "", &status))
+	utils.Equals(t, false, status.Enabled)
+	secret, recoveryCodes := enableTwoFactor(t, token)
+	utils.Equals(t, http.StatusOK, doJSON("GET", "/api/auth/2fa", token, "", &status))
+	utils.Equals(t, models.TwoFactorStatus{Enabled: true, RecoveryCodesLeft: 10}, status)
+
+	mfaToken := signInMFAToken(t, testUser)
+	// code already used for confirm can not be used again
+	twoFactor := models.TwoFactor{}
+	models.GetDB().Where("user_id = ?", response.Data.ID).First(&twoFactor)
+	usedCode, _ := utils.TOTPCode(secret, twoFactor.LastUsedStep)
+	nextCode, _ := utils.TOTPCode(secret, twoFactor.LastUsedStep+1)
+	testCases := []struct {
+		body       string
+		statuscode int
+	}{
+		{body: `{"mfa_token":"` + mfaToken + `"}`, statuscode: http.StatusBadRequest},
+		{body: `{"mfa_token":"not-exist","code":"` + nextCode + `"}`, statuscode: http.StatusUnauthorized},
+		{body: `{"mfa_token":"` + mfaToken + `","code":"` + usedCode + `"}`, statuscode: http.StatusForbidden},
+		{body: `{"mfa_token":"` + mfaToken + `","code":"` + nextCode + `"}`, statuscode: http.StatusOK},
+		// mfa token can be used only once
+		{body: `{"mfa_token":"` + mfaToken + `","code":"` + recoveryCodes[0] + `"}`, statuscode: http.StatusUnauthorized},
+	}
+	for _, tc := range testCases {
+		login := UserResponse{}.Data
+		utils.Equals(t, tc.statuscode, doJSON("POST", "/api/auth/signin/2fa", "", tc.body, &login))
+		if tc.statuscode == http.StatusOK {
+			utils.Equals(t, http.StatusOK, getProfileWithToken(login.Token))
+		}
+	}
+
+	// recovery code can be used only once
+	for _, statuscode := range []int{http.StatusOK, http.StatusForbidden} {
+		mfaToken = signInMFAToken(t, testUser)
+		body := `{"mfa_token":"` + mfaToken + `","code":"` + strings.ToUpper(recoveryCodes[1]) + `"}`
+		utils.Equals(t, statuscode, doJSON("POST", "/api/auth/signin/2fa", "", body, nil))
+	}
+
+	// mfa token is not valid after too many wrong codes
+	mfaToken = signInMFAToken(t, testUser)
+	for i := 0; i < 5; i++ {
+		utils.Equals(t, http.StatusForbidden, doJSON("POST", "/api/auth/signin/2fa", "", `{"mfa_token":"`+mfaToken+`","code":"000000"}`, nil))
+	}
+	utils.Equals(t, http.StatusUnauthorized, doJSON("POST", "/api/auth/signin/2fa", "", `{"mfa_token":"`+mfaToken+`","code":"`+recoveryCodes[2]+`"}`, nil))
+
+	// wrong codes are counted for user in all mfa tokens
+	// 6 wrong codes after the last success before
+	mfaToken = signInMFAToken(t, testUser)
+	for _, statuscode := range []int{http.StatusForbidden, http.StatusForbidden, http.StatusForbidden, http.StatusTooManyRequests} {
+		utils.Equals(t, statuscode, doJSON("POST", "/api/auth/signin/2fa", "", `{"mfa_token":"`+mfaToken+`","code":"000000"}`, nil))
+	}
+	mfaToken = signInMFAToken(t, testUser)
+	body := `{"mfa_token":"` + mfaToken + `","code":"` + recoveryCodes[3] + `"}`
+	utils.Equals(t, http.StatusTooManyRequests, doJSON("POST", "/api/auth/signin/2fa", "", body, nil))
+	models.GetDB().Model(&models.TwoFactor{}).Where("user_id = ?", response.Data.ID).UpdateColumn(
+		"locked_until", time.Now().Add(-time.Minute),
+	)
+	utils.Equals(t, http.StatusOK, doJSON("POST", "/api/auth/signin/2fa", "", body, nil))
+
+	// disable need both password and code
+	utils.Equals(t, http.StatusForbidden, doJSON("POST", "/api/auth/2fa/disable", token, `{"password":"wrong","code":"`+recoveryCodes[2]+`"}`, nil))
+	utils.Equals(t, http.StatusForbidden, doJSON("POST", "/api/auth/2fa/disable", token, `{"password":"123456","code":"000000"}`, nil))
+	utils.Equals(t, http.StatusOK, doJSON("POST", "/api/auth/2fa/disable", token, `{"password":"123456","code":"`+recoveryCodes[2]+`"}`, nil))
+	login, err := signIn(testUser)
+	utils.OK(t, err)
+	utils.Assert(t, login.Data.Token != "", "login without two factor should return token")
+}
+
+func TestRoleRequireTwoFactor(t *testing.T) {
+	app := GetTestApp()
+	admin, err := signUpAdminUser(app)
+	utils.OK(t, err)
+	defer func() {
+		models.ChangeRoleRequireTwoFactor(models.AdminRoleID, false)
+		tearDownUser(app)
+	}()
+	utils.Equals(t, http.StatusBadRequest, doJSON("PUT", "/api/admin/roles/1/2fa", admin.Data.Token, `{}`, nil))
+	utils.Equals(t, http.StatusNotFound, doJSON("PUT", "/api/admin/roles/100/2fa", admin.Data.Token, `{"required":true}`, nil))
+	accessToken := createPersonalAccessToken(t, admin.Data.Token, `{"name":"files","scopes":["files:read"]}`)
+	utils.Equals(t, http.StatusOK, doJSON("PUT", "/api/admin/roles/1/2fa", admin.Data.Token, `{"required":true}`, nil))
+	// personal access token can not be used before two factor enabled
+	utils.Equals(t, http.StatusForbidden, doJSON("GET", "/api/folders/root", accessToken.Token, "", nil))
+
+	// admin without two factor can only enable it after login
+	login, err := signIn(testAdminUser)
+	utils.OK(t, err)
+	utils.Equals(t, http.StatusForbidden, getProfileWithToken(login.Data.Token))
+	utils.Equals(t, http.StatusForbidden, doJSON("GET", "/api/admin/users", login.Data.Token, "", nil))
+	status := models.TwoFactorStatus{}
+	utils.Equals(t, http.StatusOK, doJSON("GET", "/api/auth/2fa", login.Data.Token, "", &status))
+	utils.Equals(t, true, status.Required)
+	_, recoveryCodes := enableTwoFactor(t, login.Data.Token)
+	refreshed, code := refreshToken(login.Data.RefreshToken)
+	utils.Equals(t, http.StatusOK, code)
+	utils.Equals(t, http.StatusOK, getProfileWithToken(refreshed.Data.Token))
+	utils.Equals(t, http.StatusOK, doJSON("GET", "/api/folders/root", accessToken.Token, "", nil))
+
+	// two factor can not be disabled when role require it
+	body := `{"password":"123456","code":"` + recoveryCodes[0] + `"}`
+	utils.Equals(t, http.StatusForbidden, doJSON("POST", "/api/auth/2fa/disable", refreshed.Data.Token, body, nil))
+
+	// normal user is not affected
+	user, err := signUpTestUser(app)
+	utils.OK(t, err)
+	utils.Equals(t, http.StatusOK, getProfileWithToken(user.Data.Token))
+}
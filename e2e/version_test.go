@@ -0,0 +1,98 @@
+package e2e
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/utils"
+)
+
+// VersionsResponse save the response of file versions list api
+type VersionsResponse struct {
+	Data []models.FileVersion `json:"data"`
+}
+
+func TestFileVersions(t *testing.T) {
+	app := GetTestApp()
+	userResponse, _ := signUpTestUser(app)
+	token := userResponse.Data.Token
+	defer func() {
+		tearDownUser(app)
+		tearDownStorages()
+	}()
+	listVersions := func(fileID string) []models.FileVersion {
+		rr := doRequest("GET", "/api/files/"+fileID+"/versions", token)
+		utils.Equals(t, http.StatusOK, rr.Code)
+		versions := VersionsResponse{}
+		utils.OK(t, json.NewDecoder(rr.Body).Decode(&versions))
+		return versions.Data
+	}
+	rr := uploadFile("/api/upload/files/root", token, "v.file", "version one", nil)
+	utils.Equals(t, http.StatusCreated, rr.Code)
+	message := struct {
+		Data string `json:"data"`
+	}{}
+	utils.OK(t, json.NewDecoder(rr.Body).Decode(&message))
+	fileID := message.Data
+
+	// same name still fail without version mode
+	rr = uploadFile("/api/upload/files/root", token, "v.file", "version two", nil)
+	utils.Equals(t, http.StatusBadRequest, rr.Code)
+	rr = uploadFile("/api/upload/files/root?version=true", token, "v.file", "version two", nil)
+	utils.Equals(t, http.StatusCreated, rr.Code)
+	utils.OK(t, json.NewDecoder(rr.Body).Decode(&message))
+	utils.Equals(t, fileID, message.Data)
+
+	versions := listVersions(fileID)
+	utils.Equals(t, 1, len(versions))
+	utils.Equals(t, int64(11), versions[0].FileSize)
+	utils.Equals(t, userResponse.Data.ID, versions[0].UserID)
+	rr = doRequest("GET", "/api/download/files/"+fileID+"/versions/"+versions[0].ID, token)
+	utils.Equals(t, http.StatusOK, rr.Code)
+	utils.Equals(t, "version one", rr.Body.String())
+	rr = doRequest("GET", "/api/download/files/"+fileID, token)
+	utils.Equals(t, "version two", rr.Body.String())
+	// every version count in disk usage
+	utils.Equals(t, uint64(22), getUsageDiskSize(userResponse.Data.ID))
+
+	// restore keep the current content as a version
+	rr = doRequest("POST", "/api/files/"+fileID+"/versions/"+versions[0].ID+"/restore", token)
+	utils.Equals(t, http.StatusOK, rr.Code)
+	rr = doRequest("GET", "/api/download/files/"+fileID, token)
+	utils.Equals(t, "version one", rr.Body.String())
+	versions = listVersions(fileID)
+	utils.Equals(t, 1, len(versions))
+	rr = doRequest("GET", "/api/download/files/"+fileID+"/versions/"+versions[0].ID, token)
+	utils.Equals(t, "version two", rr.Body.String())
+	utils.Equals(t, uint64(22), getUsageDiskSize(userResponse.Data.ID))
+
+	// oldest versions over limit are deleted
+	models.GetDB().Model(&models.Profile{}).Where("user_id = ?", userResponse.Data.ID).Update("max_file_versions", 1)
+	rr = uploadFile("/api/upload/files/root?version=true", token, "v.file", "version three", nil)
+	utils.Equals(t, http.StatusCreated, rr.Code)
+	oldest := versions[0]
+	versions = listVersions(fileID)
+	utils.Equals(t, 1, len(versions))
+	utils.Assert(t, versions[0].ID != oldest.ID, "oldest version should be deleted")
+	rr = doRequest("GET", "/api/download/files/"+fileID+"/versions/"+versions[0].ID, token)
+	utils.Equals(t, "version one", rr.Body.String())
+	utils.Equals(t, uint64(24), getUsageDiskSize(userResponse.Data.ID))
+	_, err := app.Storage.Open(oldest.Path, oldest.Bucket)
+	utils.Assert(t, err != nil, "object of deleted version should be deleted from storage")
+
+	rr = doRequest("DELETE", "/api/files/"+fileID+"/versions/"+versions[0].ID, token)
+	utils.Equals(t, http.StatusOK, rr.Code)
+	utils.Equals(t, 0, len(listVersions(fileID)))
+	utils.Equals(t, uint64(13), getUsageDiskSize(userResponse.Data.ID))
+	rr = doRequest("DELETE", "/api/files/"+fileID+"/versions/"+versions[0].ID, token)
+	utils.Equals(t, http.StatusNotFound, rr.Code)
+
+	// versions are deleted with file
+	doRequest("DELETE", "/api/files/"+fileID, token)
+	doRequest("DELETE", "/api/trash", token)
+	var counter int
+	models.GetDB().Model(&models.FileVersion{}).Count(&counter)
+	utils.Equals(t, 0, counter)
+}
@@ -0,0 +1,44 @@
+package mail
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FileMailer append all mails to a local file
+// no mail is really sent, it is useful for test
+type FileMailer struct {
+	Path string
+	From string
+	lock sync.Mutex
+}
+
+// NewFileMailer create a new file mailer
+func NewFileMailer(path, from string) *FileMailer {
+	return &FileMailer{
+		Path: path,
+		From: from,
+	}
+}
+
+// Send append the message to the file
+func (m *FileMailer) Send(message *Message) error {
+	if strings.ContainsAny(message.To, "\r\n") {
+		return errors.New("receiver address not valid")
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if err := os.MkdirAll(filepath.Dir(m.Path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(m.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(message.format(m.From), "\r\n"...))
+	return err
+}
@@ -0,0 +1,32 @@
+package mail
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Dudobird/dudo-server/utils"
+)
+
+func TestFileMailer(t *testing.T) {
+	root, err := ioutil.TempDir("", "dudo-mail")
+	utils.OK(t, err)
+	defer os.RemoveAll(root)
+	path := filepath.Join(root, "mails", "mails.log")
+	mailer := NewFileMailer(path, "dudo@example.com")
+	for _, to := range []string{"a@example.com", "b@example.com"} {
+		err = mailer.Send(&Message{To: to, Subject: "hello", Body: "body of " + to})
+		utils.OK(t, err)
+	}
+	content, err := ioutil.ReadFile(path)
+	utils.OK(t, err)
+	mails := string(content)
+	utils.Assert(t, strings.Contains(mails, "From: dudo@example.com\r\n"), "sender not found")
+	utils.Assert(t, strings.Contains(mails, "To: a@example.com\r\n"), "first mail not found")
+	utils.Assert(t, strings.Contains(mails, "body of b@example.com"), "second mail not found")
+
+	err = mailer.Send(&Message{To: "a@example.com\r\nBcc: c@example.com", Subject: "hello"})
+	utils.Assert(t, err != nil, "receiver with new line should be rejected")
+}
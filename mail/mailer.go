@@ -0,0 +1,53 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"time"
+
+	"github.com/Dudobird/dudo-server/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// Message is a plain text mail
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer is a interface for send mails to users
+// it could be a smtp server or a local file for test
+type Mailer interface {
+	// Send the message to its receiver
+	Send(message *Message) error
+}
+
+// InitMailer create mailer based on the type of mail config
+func InitMailer() Mailer {
+	c := config.GetConfig()
+	switch c.Mail.Type {
+	case "smtp":
+		log.Infof("send mails with smtp server %s:%s", c.Mail.Host, c.Mail.Port)
+		return NewSMTPMailer(c.Mail.Host, c.Mail.Port, c.Mail.Username, c.Mail.Password, c.Mail.From)
+	default:
+		log.Infof("write mails to file %s", c.Mail.File)
+		return NewFileMailer(c.Mail.File, c.Mail.From)
+	}
+}
+
+// format return the message with mail headers
+func (m *Message) format(from string) []byte {
+	buffer := new(bytes.Buffer)
+	fmt.Fprintf(buffer, "From: %s\r\n", from)
+	fmt.Fprintf(buffer, "To: %s\r\n", m.To)
+	fmt.Fprintf(buffer, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(buffer, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buffer.WriteString("MIME-Version: 1.0\r\n")
+	buffer.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buffer.WriteString("\r\n")
+	buffer.WriteString(m.Body)
+	buffer.WriteString("\r\n")
+	return buffer.Bytes()
+}
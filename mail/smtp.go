@@ -0,0 +1,48 @@
+package mail
+
+import (
+	"errors"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+// SMTPMailer send mails with smtp server
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// NewSMTPMailer create a new smtp mailer
+// no authentication is used when username is empty
+func NewSMTPMailer(host, port, username, password, from string) *SMTPMailer {
+	return &SMTPMailer{
+		Host:     host,
+		Port:     port,
+		Username: username,
+		Password: password,
+		From:     from,
+	}
+}
+
+// Send the message with smtp server
+func (m *SMTPMailer) Send(message *Message) error {
+	// avoid header injection from receiver address
+	if strings.ContainsAny(message.To, "\r\n") {
+		return errors.New("receiver address not valid")
+	}
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	return smtp.SendMail(
+		net.JoinHostPort(m.Host, m.Port),
+		auth,
+		m.From,
+		[]string{message.To},
+		message.format(m.From),
+	)
+}
@@ -0,0 +1,128 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// tables before versioned migration, they were created by AutoMigrate
+// so this migration also works for database already has these tables
+
+type initialUser struct {
+	ID        string    `gorm:"primary_key"`
+	CreatedAt time.Time `gorm:"DEFAULT:current_timestamp"`
+	UpdatedAt time.Time `gorm:"DEFAULT:current_timestamp"`
+	DeletedAt *time.Time
+	Email     string `gorm:"not null;type:varchar(100);unique_index"`
+	Password  string `gorm:"not null"`
+	RoleID    uint
+}
+
+func (initialUser) TableName() string { return "users" }
+
+type initialProfile struct {
+	gorm.Model
+	UserID        string
+	Name          string `gorm:"unique_index:idx_profile_name"`
+	Phone         string
+	MobilePhone   string
+	Department    string
+	ProfileImage  string
+	DiskLimit     uint64
+	UsageDiskSize uint64
+}
+
+func (initialProfile) TableName() string { return "profiles" }
+
+type initialStorageFile struct {
+	ID        string `gorm:"primary_key"`
+	FileName  string `gorm:"not null;index:idx_file_name"`
+	Bucket    string `gorm:"not null;default:''"`
+	MIMEType  string
+	FileType  string
+	FileSize  int64     `gorm:"not null;default:0"`
+	FolderID  string    `gorm:"not null;default:''"`
+	IsDir     bool      `gorm:"not null;default:false"`
+	Path      string    `gorm:"not null;default:''"`
+	Hash      string    `gorm:"not null;default:'';index:idx_file_hash"`
+	CreatedAt time.Time `gorm:"DEFAULT:current_timestamp"`
+	UpdatedAt time.Time `gorm:"DEFAULT:current_timestamp"`
+	DeletedAt *time.Time
+	UserID    string
+}
+
+func (initialStorageFile) TableName() string { return "storage_files" }
+
+type initialShareFile struct {
+	ID          string    `gorm:"primary_key"`
+	CreatedAt   time.Time `gorm:"DEFAULT:current_timestamp"`
+	UpdatedAt   time.Time `gorm:"DEFAULT:current_timestamp"`
+	DeletedAt   *time.Time
+	FileID      string
+	Expire      time.Time
+	Description string `gorm:"not null;default:''"`
+	UserID      string
+}
+
+func (initialShareFile) TableName() string { return "share_files" }
+
+type initialRole struct {
+	ID          uint   `gorm:"primary_key"`
+	Name        string `gorm:"not null"`
+	Description string
+}
+
+func (initialRole) TableName() string { return "roles" }
+
+type initialUpload struct {
+	ID           string    `gorm:"primary_key"`
+	CreatedAt    time.Time `gorm:"DEFAULT:current_timestamp"`
+	UpdatedAt    time.Time `gorm:"DEFAULT:current_timestamp"`
+	UserID       string    `gorm:"not null;index:idx_upload_user"`
+	FolderID     string    `gorm:"not null;default:''"`
+	FileName     string    `gorm:"not null"`
+	Bucket       string    `gorm:"not null;default:''"`
+	UploadLength int64     `gorm:"not null;default:0"`
+	UploadOffset int64     `gorm:"not null;default:0"`
+	Chunks       int       `gorm:"not null;default:0"`
+	FileID       string    `gorm:"not null;default:''"`
+}
+
+func (initialUpload) TableName() string { return "uploads" }
+
+type initialBlob struct {
+	Hash      string    `gorm:"primary_key"`
+	CreatedAt time.Time `gorm:"DEFAULT:current_timestamp"`
+	UpdatedAt time.Time `gorm:"DEFAULT:current_timestamp"`
+	Bucket    string    `gorm:"not null;default:''"`
+	Path      string    `gorm:"not null;default:''"`
+	MIMEType  string
+	Size      int64 `gorm:"not null;default:0"`
+	RefCount  int64 `gorm:"not null;default:0"`
+}
+
+func (initialBlob) TableName() string { return "blobs" }
+
+var initialTables = []interface{}{
+	&initialUser{},
+	&initialProfile{},
+	&initialStorageFile{},
+	&initialShareFile{},
+	&initialRole{},
+	&initialUpload{},
+	&initialBlob{},
+}
+
+func init() {
+	register(Migration{
+		ID:   1,
+		Name: "initial_schema",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(initialTables...).Error
+		},
+		Down: func(db *gorm.DB) error {
+			return db.DropTableIfExists(initialTables...).Error
+		},
+	})
+}
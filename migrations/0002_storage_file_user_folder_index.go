@@ -0,0 +1,17 @@
+package migrations
+
+import "github.com/jinzhu/gorm"
+
+// files are always queried with user and folder for listing and name check
+func init() {
+	register(Migration{
+		ID:   2,
+		Name: "storage_file_user_folder_index",
+		Up: func(db *gorm.DB) error {
+			return db.Table("storage_files").AddIndex("idx_file_user_folder", "user_id", "folder_id").Error
+		},
+		Down: func(db *gorm.DB) error {
+			return db.Table("storage_files").RemoveIndex("idx_file_user_folder").Error
+		},
+	})
+}
@@ -0,0 +1,27 @@
+package migrations
+
+import "github.com/jinzhu/gorm"
+
+type trashStorageFile struct {
+	TrashID string `gorm:"not null;default:'';index:idx_file_trash"`
+}
+
+func (trashStorageFile) TableName() string { return "storage_files" }
+
+// deleted files are moved to trash with soft delete
+func init() {
+	register(Migration{
+		ID:   3,
+		Name: "storage_file_trash",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&trashStorageFile{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			err := db.Table("storage_files").RemoveIndex("idx_file_trash").Error
+			if err != nil {
+				return err
+			}
+			return dropColumns(db, "storage_files", "trash_id")
+		},
+	})
+}
@@ -0,0 +1,45 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type versionFileVersion struct {
+	ID        string    `gorm:"primary_key"`
+	CreatedAt time.Time `gorm:"DEFAULT:current_timestamp"`
+	FileID    string    `gorm:"not null;index:idx_version_file"`
+	UserID    string    `gorm:"not null;default:''"`
+	Bucket    string    `gorm:"not null;default:''"`
+	Path      string    `gorm:"not null;default:''"`
+	Hash      string    `gorm:"not null;default:''"`
+	MIMEType  string
+	FileSize  int64 `gorm:"not null;default:0"`
+}
+
+func (versionFileVersion) TableName() string { return "file_versions" }
+
+type versionProfile struct {
+	MaxFileVersions int `gorm:"not null;default:10"`
+}
+
+func (versionProfile) TableName() string { return "profiles" }
+
+// old contents of file are kept as versions
+func init() {
+	register(Migration{
+		ID:   4,
+		Name: "file_versions",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&versionFileVersion{}, &versionProfile{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			err := db.DropTableIfExists(&versionFileVersion{}).Error
+			if err != nil {
+				return err
+			}
+			return dropColumns(db, "profiles", "max_file_versions")
+		},
+	})
+}
@@ -0,0 +1,43 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type sessionSession struct {
+	ID               string    `gorm:"primary_key"`
+	CreatedAt        time.Time `gorm:"DEFAULT:current_timestamp"`
+	UpdatedAt        time.Time `gorm:"DEFAULT:current_timestamp"`
+	UserID           string    `gorm:"not null;index:idx_session_user"`
+	RefreshTokenHash string    `gorm:"not null;unique_index"`
+	AccessTokenID    string    `gorm:"not null;default:''"`
+	ExpiresAt        time.Time
+	RevokedAt        *time.Time
+}
+
+func (sessionSession) TableName() string { return "sessions" }
+
+type sessionRevokedToken struct {
+	ID        string    `gorm:"primary_key"`
+	CreatedAt time.Time `gorm:"DEFAULT:current_timestamp"`
+	UserID    string    `gorm:"not null;default:''"`
+	ExpiresAt time.Time `gorm:"index:idx_revoked_token_expires"`
+}
+
+func (sessionRevokedToken) TableName() string { return "revoked_tokens" }
+
+// login sessions with refresh tokens and the revoked access tokens
+func init() {
+	register(Migration{
+		ID:   5,
+		Name: "sessions",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&sessionSession{}, &sessionRevokedToken{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			return db.DropTableIfExists(&sessionSession{}, &sessionRevokedToken{}).Error
+		},
+	})
+}
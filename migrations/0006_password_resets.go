@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type resetPasswordReset struct {
+	ID        string    `gorm:"primary_key"`
+	CreatedAt time.Time `gorm:"DEFAULT:current_timestamp"`
+	UserID    string    `gorm:"not null;index:idx_password_reset_user"`
+	TokenHash string    `gorm:"not null;unique_index"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+func (resetPasswordReset) TableName() string { return "password_resets" }
+
+// single use tokens for reset password with email
+func init() {
+	register(Migration{
+		ID:   6,
+		Name: "password_resets",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&resetPasswordReset{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			return db.DropTableIfExists(&resetPasswordReset{}).Error
+		},
+	})
+}
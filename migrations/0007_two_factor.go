@@ -0,0 +1,73 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type twoFactorTwoFactor struct {
+	UserID       string `gorm:"primary_key"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Secret       string `gorm:"not null"`
+	EnabledAt    *time.Time
+	LastUsedStep int64 `gorm:"not null;default:0"`
+}
+
+func (twoFactorTwoFactor) TableName() string { return "two_factors" }
+
+type twoFactorRecoveryCode struct {
+	ID        string `gorm:"primary_key"`
+	CreatedAt time.Time
+	UserID    string `gorm:"not null;index:idx_recovery_code_user"`
+	CodeHash  string `gorm:"not null"`
+	UsedAt    *time.Time
+}
+
+func (twoFactorRecoveryCode) TableName() string { return "recovery_codes" }
+
+type twoFactorChallenge struct {
+	ID        string `gorm:"primary_key"`
+	CreatedAt time.Time
+	UserID    string `gorm:"not null"`
+	TokenHash string `gorm:"not null;unique_index"`
+	ExpiresAt time.Time
+	Attempts  int `gorm:"not null;default:0"`
+}
+
+func (twoFactorChallenge) TableName() string { return "mfa_challenges" }
+
+type twoFactorRole struct {
+	RequireTwoFactor bool `gorm:"not null;default:false"`
+}
+
+func (twoFactorRole) TableName() string { return "roles" }
+
+// totp two factor authentication with recovery codes,
+// roles can require users to enable it
+func init() {
+	register(Migration{
+		ID:   7,
+		Name: "two_factor",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(
+				&twoFactorTwoFactor{},
+				&twoFactorRecoveryCode{},
+				&twoFactorChallenge{},
+				&twoFactorRole{},
+			).Error
+		},
+		Down: func(db *gorm.DB) error {
+			err := db.DropTableIfExists(
+				&twoFactorTwoFactor{},
+				&twoFactorRecoveryCode{},
+				&twoFactorChallenge{},
+			).Error
+			if err != nil {
+				return err
+			}
+			return dropColumns(db, "roles", "require_two_factor")
+		},
+	})
+}
@@ -0,0 +1,36 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type patPersonalAccessToken struct {
+	ID         string `gorm:"primary_key"`
+	CreatedAt  time.Time
+	UserID     string `gorm:"not null;index:idx_personal_access_token_user"`
+	Name       string `gorm:"not null;type:varchar(100)"`
+	TokenHash  string `gorm:"not null;unique_index"`
+	Scopes     string `gorm:"not null"`
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	LastUsedIP string `gorm:"not null;default:''"`
+	RevokedAt  *time.Time
+}
+
+func (patPersonalAccessToken) TableName() string { return "personal_access_tokens" }
+
+// personal access tokens for scripts
+func init() {
+	register(Migration{
+		ID:   8,
+		Name: "personal_access_tokens",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&patPersonalAccessToken{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			return db.DropTableIfExists(&patPersonalAccessToken{}).Error
+		},
+	})
+}
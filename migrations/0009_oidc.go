@@ -0,0 +1,41 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type oidcLogin struct {
+	ID           string `gorm:"primary_key"`
+	CreatedAt    time.Time
+	Nonce        string `gorm:"not null"`
+	CodeVerifier string `gorm:"not null"`
+	ExpiresAt    time.Time
+}
+
+func (oidcLogin) TableName() string { return "oidc_logins" }
+
+type oidcIdentity struct {
+	ID        string `gorm:"primary_key"`
+	CreatedAt time.Time
+	Issuer    string `gorm:"not null;unique_index:idx_oidc_identity_subject"`
+	Subject   string `gorm:"not null;unique_index:idx_oidc_identity_subject"`
+	UserID    string `gorm:"not null;index:idx_oidc_identity_user"`
+}
+
+func (oidcIdentity) TableName() string { return "oidc_identities" }
+
+// single sign on with openid connect provider
+func init() {
+	register(Migration{
+		ID:   9,
+		Name: "oidc",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&oidcLogin{}, &oidcIdentity{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			return db.DropTableIfExists(&oidcLogin{}, &oidcIdentity{}).Error
+		},
+	})
+}
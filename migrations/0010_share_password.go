@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type passwordShareFile struct {
+	PasswordHash   string `gorm:"not null;default:''"`
+	FailedAttempts int    `gorm:"not null;default:0"`
+	LockedUntil    *time.Time
+}
+
+func (passwordShareFile) TableName() string { return "share_files" }
+
+// share files can be protected by password
+func init() {
+	register(Migration{
+		ID:   10,
+		Name: "share_password",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&passwordShareFile{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			return dropColumns(db, "share_files", "password_hash", "failed_attempts", "locked_until")
+		},
+	})
+}
@@ -0,0 +1,45 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type accessLogShareFile struct {
+	MaxDownloads  int `gorm:"not null;default:0"`
+	DownloadCount int `gorm:"not null;default:0"`
+}
+
+func (accessLogShareFile) TableName() string { return "share_files" }
+
+type accessLogShareAccessLog struct {
+	ID          string `gorm:"primary_key"`
+	CreatedAt   time.Time
+	ShareID     string `gorm:"not null;index:idx_share_access_log_share"`
+	IP          string `gorm:"not null;default:''"`
+	UserAgent   string `gorm:"not null;default:''"`
+	Status      int    `gorm:"not null;default:0"`
+	BytesServed int64  `gorm:"not null;default:0"`
+	Success     bool   `gorm:"not null;default:false"`
+}
+
+func (accessLogShareAccessLog) TableName() string { return "share_access_logs" }
+
+// share files can limit downloads and record every access
+func init() {
+	register(Migration{
+		ID:   11,
+		Name: "share_access_logs",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&accessLogShareFile{}, &accessLogShareAccessLog{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			err := db.DropTableIfExists(&accessLogShareAccessLog{}).Error
+			if err != nil {
+				return err
+			}
+			return dropColumns(db, "share_files", "max_downloads", "download_count")
+		},
+	})
+}
@@ -0,0 +1,23 @@
+package migrations
+
+import "github.com/jinzhu/gorm"
+
+type fileShareAccessLog struct {
+	FileID string `gorm:"not null;default:''"`
+}
+
+func (fileShareAccessLog) TableName() string { return "share_access_logs" }
+
+// files in shared folder can be downloaded one by one
+func init() {
+	register(Migration{
+		ID:   12,
+		Name: "share_access_log_file",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&fileShareAccessLog{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			return dropColumns(db, "share_access_logs", "file_id")
+		},
+	})
+}
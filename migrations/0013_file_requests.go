@@ -0,0 +1,55 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type fileRequestFileRequest struct {
+	ID                string `gorm:"primary_key"`
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	UserID            string `gorm:"not null;index:idx_file_request_user"`
+	FolderID          string `gorm:"not null"`
+	Title             string `gorm:"not null;default:''"`
+	Description       string `gorm:"not null;default:''"`
+	TokenHash         string `gorm:"not null;unique_index"`
+	ExpiresAt         time.Time
+	MaxFileSize       int64  `gorm:"not null;default:0"`
+	AllowedExtensions string `gorm:"not null;default:''"`
+	ShowUploads       bool   `gorm:"not null;default:false"`
+	PasswordHash      string `gorm:"not null;default:''"`
+	FailedAttempts    int    `gorm:"not null;default:0"`
+	LockedUntil       *time.Time
+	UploadCount       int `gorm:"not null;default:0"`
+}
+
+func (fileRequestFileRequest) TableName() string { return "file_requests" }
+
+type fileRequestUpload struct {
+	ID           string `gorm:"primary_key"`
+	CreatedAt    time.Time
+	RequestID    string `gorm:"not null;index:idx_file_request_upload_request"`
+	FileID       string `gorm:"not null"`
+	FileName     string `gorm:"not null"`
+	FileSize     int64  `gorm:"not null;default:0"`
+	UploaderHash string `gorm:"not null;default:''"`
+	IP           string `gorm:"not null;default:''"`
+}
+
+func (fileRequestUpload) TableName() string { return "file_request_uploads" }
+
+// upload only links for others send files to user
+func init() {
+	register(Migration{
+		ID:   13,
+		Name: "file_requests",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&fileRequestFileRequest{}, &fileRequestUpload{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			return db.DropTableIfExists(&fileRequestUpload{}, &fileRequestFileRequest{}).Error
+		},
+	})
+}
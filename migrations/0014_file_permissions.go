@@ -0,0 +1,67 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type permissionGroup struct {
+	ID        string `gorm:"primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	OwnerID   string `gorm:"not null;index:idx_group_owner"`
+	Name      string `gorm:"not null;type:varchar(100)"`
+}
+
+func (permissionGroup) TableName() string { return "user_groups" }
+
+type permissionGroupMember struct {
+	ID        string `gorm:"primary_key"`
+	CreatedAt time.Time
+	GroupID   string `gorm:"not null;unique_index:idx_group_member"`
+	UserID    string `gorm:"not null;unique_index:idx_group_member;index:idx_group_member_user"`
+}
+
+func (permissionGroupMember) TableName() string { return "group_members" }
+
+type permissionFilePermission struct {
+	ID          string `gorm:"primary_key"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	FileID      string `gorm:"not null;unique_index:idx_file_permission_grantee"`
+	OwnerID     string `gorm:"not null;index:idx_file_permission_owner"`
+	GranteeType string `gorm:"not null;unique_index:idx_file_permission_grantee"`
+	GranteeID   string `gorm:"not null;unique_index:idx_file_permission_grantee;index:idx_file_permission_target"`
+	Role        string `gorm:"not null"`
+	GrantedBy   string `gorm:"not null;default:''"`
+}
+
+func (permissionFilePermission) TableName() string { return "file_permissions" }
+
+type permissionUpload struct {
+	OwnerID string `gorm:"not null;default:''"`
+}
+
+func (permissionUpload) TableName() string { return "uploads" }
+
+// users share files and folders with other users and groups
+// resumable uploads into shared folder save the owner of folder
+func init() {
+	register(Migration{
+		ID:   14,
+		Name: "file_permissions",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(
+				&permissionGroup{}, &permissionGroupMember{}, &permissionFilePermission{}, &permissionUpload{},
+			).Error
+		},
+		Down: func(db *gorm.DB) error {
+			err := db.DropTableIfExists(&permissionFilePermission{}, &permissionGroupMember{}, &permissionGroup{}).Error
+			if err != nil {
+				return err
+			}
+			return dropColumns(db, "uploads", "owner_id")
+		},
+	})
+}
@@ -0,0 +1,57 @@
+package migrations
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type uploadChunkUpload struct {
+	ID     string `gorm:"primary_key"`
+	Chunks int
+	FileID string
+}
+
+func (uploadChunkUpload) TableName() string { return "uploads" }
+
+type uploadChunkUploadChunk struct {
+	ID         string `gorm:"primary_key"`
+	CreatedAt  time.Time
+	UploadID   string `gorm:"not null;unique_index:idx_upload_chunk"`
+	ChunkIndex int    `gorm:"not null;unique_index:idx_upload_chunk"`
+	Object     string `gorm:"not null"`
+}
+
+func (uploadChunkUploadChunk) TableName() string { return "upload_chunks" }
+
+// chunks of resumable upload are saved with unique object names
+// chunks of unfinished uploads were named by upload id and index
+func init() {
+	register(Migration{
+		ID:   15,
+		Name: "upload_chunks",
+		Up: func(db *gorm.DB) error {
+			if err := db.AutoMigrate(&uploadChunkUploadChunk{}).Error; err != nil {
+				return err
+			}
+			uploads := []uploadChunkUpload{}
+			if err := db.Where("chunks > 0 and file_id = ''").Find(&uploads).Error; err != nil {
+				return err
+			}
+			for _, u := range uploads {
+				for i := 0; i < u.Chunks; i++ {
+					object := fmt.Sprintf("%s_%d", u.ID, i)
+					chunk := &uploadChunkUploadChunk{ID: object, UploadID: u.ID, ChunkIndex: i, Object: object}
+					if err := db.Create(chunk).Error; err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+		Down: func(db *gorm.DB) error {
+			return db.DropTableIfExists(&uploadChunkUploadChunk{}).Error
+		},
+	})
+}
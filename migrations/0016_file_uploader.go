@@ -0,0 +1,24 @@
+package migrations
+
+import "github.com/jinzhu/gorm"
+
+type uploaderStorageFile struct {
+	UploadedBy string `gorm:"not null;default:''"`
+}
+
+func (uploaderStorageFile) TableName() string { return "storage_files" }
+
+// save who upload the current content of file
+// versions keep the uploader of old content
+func init() {
+	register(Migration{
+		ID:   16,
+		Name: "file_uploader",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&uploaderStorageFile{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			return dropColumns(db, "storage_files", "uploaded_by")
+		},
+	})
+}
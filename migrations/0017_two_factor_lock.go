@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type twoFactorLockTwoFactor struct {
+	FailedAttempts int `gorm:"not null;default:0"`
+	LockedUntil    *time.Time
+}
+
+func (twoFactorLockTwoFactor) TableName() string { return "two_factors" }
+
+// wrong two factor codes are limited for user, not only for a login challenge
+func init() {
+	register(Migration{
+		ID:   17,
+		Name: "two_factor_lock",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&twoFactorLockTwoFactor{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			return dropColumns(db, "two_factors", "failed_attempts", "locked_until")
+		},
+	})
+}
@@ -0,0 +1,101 @@
+package migrations
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+type uniqueNameStorageFile struct {
+	ID       string
+	UserID   string
+	FolderID string
+	FileName string
+	TrashID  string
+}
+
+func (uniqueNameStorageFile) TableName() string { return "storage_files" }
+
+// names of files in one folder are unique, trash id is part of the index
+// so the same name can be deleted to trash many times,
+// exist duplicate names are renamed to "name (n).ext" before create the index
+func init() {
+	register(Migration{
+		ID:   18,
+		Name: "storage_file_unique_name",
+		Up: func(db *gorm.DB) error {
+			// files deleted by old versions without trash id are put into trash
+			err := db.Table("storage_files").Where("deleted_at is not null and trash_id = ''").UpdateColumn(
+				"trash_id", gorm.Expr("id"),
+			).Error
+			if err != nil {
+				return err
+			}
+			if err := renameDuplicateFileNames(db); err != nil {
+				return err
+			}
+			if db.Dialect().GetName() == "mysql" {
+				// index of mysql is limited to 3072 bytes, use prefix of columns
+				return db.Exec(
+					"CREATE UNIQUE INDEX idx_file_unique_name ON storage_files " +
+						"(user_id(64), folder_id(64), file_name(191), trash_id(64))",
+				).Error
+			}
+			return db.Table("storage_files").AddUniqueIndex(
+				"idx_file_unique_name", "user_id", "folder_id", "file_name", "trash_id",
+			).Error
+		},
+		Down: func(db *gorm.DB) error {
+			return db.Table("storage_files").RemoveIndex("idx_file_unique_name").Error
+		},
+	})
+}
+
+// renameDuplicateFileNames keep the name of oldest file and rename others
+func renameDuplicateFileNames(db *gorm.DB) error {
+	duplicates := []uniqueNameStorageFile{}
+	err := db.Table("storage_files").Select("user_id, folder_id, file_name, trash_id").Group(
+		"user_id, folder_id, file_name, trash_id",
+	).Having("count(*) > 1").Scan(&duplicates).Error
+	if err != nil {
+		return err
+	}
+	for _, duplicate := range duplicates {
+		files := []uniqueNameStorageFile{}
+		err := db.Where(
+			"user_id = ? and folder_id = ? and file_name = ? and trash_id = ?",
+			duplicate.UserID, duplicate.FolderID, duplicate.FileName, duplicate.TrashID,
+		).Order("created_at, id").Find(&files).Error
+		if err != nil {
+			return err
+		}
+		extension := filepath.Ext(duplicate.FileName)
+		base := strings.TrimSuffix(duplicate.FileName, extension)
+		n := 1
+		for _, file := range files[1:] {
+			for {
+				name := fmt.Sprintf("%s (%d)%s", base, n, extension)
+				n++
+				exist := 0
+				err := db.Model(&uniqueNameStorageFile{}).Where(
+					"user_id = ? and folder_id = ? and file_name = ? and trash_id = ?",
+					file.UserID, file.FolderID, name, file.TrashID,
+				).Count(&exist).Error
+				if err != nil {
+					return err
+				}
+				if exist > 0 {
+					continue
+				}
+				err = db.Model(&uniqueNameStorageFile{}).Where("id = ?", file.ID).UpdateColumn("file_name", name).Error
+				if err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
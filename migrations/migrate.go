@@ -0,0 +1,196 @@
+package migrations
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+)
+
+// Migration is one version of database schema change
+// migrations are applied by the order of id and never changed after release,
+// so it should use its own struct definitions instead of models
+type Migration struct {
+	ID   uint
+	Name string
+	Up   func(db *gorm.DB) error
+	Down func(db *gorm.DB) error
+}
+
+// SchemaMigration record one applied migration in database
+type SchemaMigration struct {
+	ID        uint      `json:"id" gorm:"primary_key;auto_increment:false"`
+	Name      string    `json:"name" gorm:"not null;default:''"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// TableName of applied migrations
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Status show a migration is applied or not
+type Status struct {
+	ID        uint       `json:"id"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+var migrations []Migration
+
+// register add a migration, it should be called in init of migration file
+func register(m Migration) {
+	migrations = append(migrations, m)
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].ID < migrations[j].ID
+	})
+}
+
+// All return all migrations ordered by id
+func All() []Migration {
+	return migrations
+}
+
+// applied return the applied migration records with id as key
+func applied(db *gorm.DB) (map[uint]SchemaMigration, error) {
+	err := db.AutoMigrate(&SchemaMigration{}).Error
+	if err != nil {
+		return nil, err
+	}
+	records := []SchemaMigration{}
+	err = db.Order("id").Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[uint]SchemaMigration)
+	for _, record := range records {
+		result[record.ID] = record
+	}
+	return result, nil
+}
+
+// GetStatus return the status of all migrations
+func GetStatus(db *gorm.DB) ([]Status, error) {
+	records, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+	status := []Status{}
+	for _, m := range migrations {
+		s := Status{ID: m.ID, Name: m.Name}
+		if record, ok := records[m.ID]; ok {
+			s.Applied = true
+			s.AppliedAt = &record.AppliedAt
+		}
+		status = append(status, s)
+	}
+	return status, nil
+}
+
+// Pending return the migrations not applied yet
+func Pending(db *gorm.DB) ([]Migration, error) {
+	records, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+	pending := []Migration{}
+	for _, m := range migrations {
+		if _, ok := records[m.ID]; !ok {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// Up apply the pending migrations, apply all when steps <= 0
+// return the applied migrations
+func Up(db *gorm.DB, steps int) ([]Migration, error) {
+	pending, err := Pending(db)
+	if err != nil {
+		return nil, err
+	}
+	if steps > 0 && steps < len(pending) {
+		pending = pending[:steps]
+	}
+	done := []Migration{}
+	for _, m := range pending {
+		err := run(db, m, true)
+		if err != nil {
+			return done, err
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// Down rollback the last applied migrations, rollback one when steps <= 0
+// return the rollbacked migrations
+func Down(db *gorm.DB, steps int) ([]Migration, error) {
+	records, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+	if steps <= 0 {
+		steps = 1
+	}
+	done := []Migration{}
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		m := migrations[i]
+		if _, ok := records[m.ID]; !ok {
+			continue
+		}
+		err := run(db, m, false)
+		if err != nil {
+			return done, err
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// dropColumns remove columns from table
+// sqlite before 3.35 not support drop column, columns are kept for sqlite
+// and they will be reused when migration applied again
+func dropColumns(db *gorm.DB, table string, columns ...string) error {
+	if db.Dialect().GetName() == "sqlite3" {
+		log.Warnf("sqlite3 not support drop column, keep columns %v in %s", columns, table)
+		return nil
+	}
+	for _, column := range columns {
+		err := db.Table(table).DropColumn(column).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// run one migration and save the record in a transaction
+func run(db *gorm.DB, m Migration, up bool) error {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	var err error
+	if up {
+		log.Infof("apply migration %04d %s", m.ID, m.Name)
+		err = m.Up(tx)
+		if err == nil {
+			err = tx.Create(&SchemaMigration{ID: m.ID, Name: m.Name, AppliedAt: time.Now()}).Error
+		}
+	} else {
+		log.Infof("rollback migration %04d %s", m.ID, m.Name)
+		err = m.Down(tx)
+		if err == nil {
+			err = tx.Where("id = ?", m.ID).Delete(&SchemaMigration{}).Error
+		}
+	}
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("migration %04d %s fail: %s", m.ID, m.Name, err)
+	}
+	return tx.Commit().Error
+}
@@ -0,0 +1,107 @@
+package migrations
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Dudobird/dudo-server/utils"
+	"github.com/jinzhu/gorm"
+
+	// sqlite3 driver init
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	utils.OK(t, err)
+	db.DB().SetMaxOpenConns(1)
+	return db
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	db := openTestDB(t)
+	defer db.Close()
+	total := len(All())
+	utils.Assert(t, total >= 2, "migrations should be registered")
+	for i, m := range All() {
+		utils.Equals(t, uint(i+1), m.ID)
+	}
+
+	pending, err := Pending(db)
+	utils.OK(t, err)
+	utils.Equals(t, total, len(pending))
+
+	done, err := Up(db, 1)
+	utils.OK(t, err)
+	utils.Equals(t, 1, len(done))
+	utils.Assert(t, db.HasTable("storage_files"), "table should be created")
+
+	done, err = Up(db, 0)
+	utils.OK(t, err)
+	utils.Equals(t, total-1, len(done))
+	status, err := GetStatus(db)
+	utils.OK(t, err)
+	for _, s := range status {
+		utils.Assert(t, s.Applied, "all migrations should be applied")
+	}
+
+	// nothing to do when up to date
+	done, err = Up(db, 0)
+	utils.OK(t, err)
+	utils.Equals(t, 0, len(done))
+
+	done, err = Down(db, 0)
+	utils.OK(t, err)
+	utils.Equals(t, 1, len(done))
+	utils.Equals(t, All()[total-1].ID, done[0].ID)
+	pending, err = Pending(db)
+	utils.OK(t, err)
+	utils.Equals(t, 1, len(pending))
+
+	done, err = Down(db, total)
+	utils.OK(t, err)
+	utils.Equals(t, total-1, len(done))
+	utils.Assert(t, !db.HasTable("storage_files"), "table should be dropped")
+}
+
+func TestMigrateExistDatabase(t *testing.T) {
+	db := openTestDB(t)
+	defer db.Close()
+	// database created by AutoMigrate before versioned migrations
+	utils.OK(t, db.AutoMigrate(&initialUser{}, &initialStorageFile{}).Error)
+	utils.OK(t, db.Create(&initialUser{ID: "user_1", Email: "test@example.com", Password: "123456"}).Error)
+
+	_, err := Up(db, 0)
+	utils.OK(t, err)
+	var counter int
+	db.Table("users").Count(&counter)
+	utils.Equals(t, 1, counter)
+}
+
+func TestMigrateDuplicateFileNames(t *testing.T) {
+	db := openTestDB(t)
+	defer db.Close()
+	_, err := Up(db, 17)
+	utils.OK(t, err)
+	insert := "INSERT INTO storage_files (id, user_id, folder_id, file_name, created_at, deleted_at) VALUES (?, ?, ?, ?, ?, ?)"
+	now := time.Now()
+	utils.OK(t, db.Exec(insert, "file_1", "user_1", "root", "a.txt", now, nil).Error)
+	utils.OK(t, db.Exec(insert, "file_2", "user_1", "root", "a.txt", now.Add(time.Second), nil).Error)
+	utils.OK(t, db.Exec(insert, "file_3", "user_1", "root", "a (1).txt", now, nil).Error)
+	utils.OK(t, db.Exec(insert, "file_4", "user_1", "root", "a.txt", now, now).Error)
+	utils.OK(t, db.Exec(insert, "file_5", "user_2", "root", "a.txt", now, nil).Error)
+
+	_, err = Up(db, 0)
+	utils.OK(t, err)
+	files := []uniqueNameStorageFile{}
+	utils.OK(t, db.Order("id").Find(&files).Error)
+	utils.Equals(t, []uniqueNameStorageFile{
+		{ID: "file_1", UserID: "user_1", FolderID: "root", FileName: "a.txt"},
+		{ID: "file_2", UserID: "user_1", FolderID: "root", FileName: "a (2).txt"},
+		{ID: "file_3", UserID: "user_1", FolderID: "root", FileName: "a (1).txt"},
+		{ID: "file_4", UserID: "user_1", FolderID: "root", FileName: "a.txt", TrashID: "file_4"},
+		{ID: "file_5", UserID: "user_2", FolderID: "root", FileName: "a.txt"},
+	}, files)
+	err = db.Exec(insert, "file_6", "user_1", "root", "a.txt", now, nil).Error
+	utils.Assert(t, err != nil, "same name should not be created in folder")
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Blob is one unique file content in storage, keyed by the sha256 of content
+// storage files with same content share one blob and only one object
+// saved in storage, the object is deleted when no file reference it
+type Blob struct {
+	Hash      string    `json:"hash" gorm:"primary_key"`
+	CreatedAt time.Time `json:"created_at" gorm:"DEFAULT:current_timestamp"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"DEFAULT:current_timestamp"`
+
+	Bucket   string `json:"bucket" gorm:"not null;default:''"`
+	Path     string `json:"path" gorm:"not null;default:''"`
+	MIMEType string `json:"mime_type"`
+	Size     int64  `json:"size" gorm:"not null;default:0"`
+	RefCount int64  `json:"ref_count" gorm:"not null;default:0"`
+}
@@ -2,11 +2,16 @@ package models
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/Dudobird/dudo-server/config"
+	"github.com/go-sql-driver/mysql"
 	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
 
 	// mysql driver init
 	_ "github.com/jinzhu/gorm/dialects/mysql"
@@ -18,33 +23,57 @@ var db *gorm.DB
 func InitDBConnection() (*gorm.DB, error) {
 	var err error
 	config := config.GetConfig()
+	dbType := config.Database.Type
 	username := config.Database.Username
 	password := config.Database.Password
 	dbName := config.Database.DBName
 	dbHost := config.Database.Host
 	dbPort := config.Database.Port
-	dbURI := fmt.Sprintf(
-		"%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		username,
-		password,
-		dbHost,
-		dbPort,
-		dbName,
-	)
-	log.Infof("try to connect database : %s:%s", dbHost, dbPort)
-	db, err = gorm.Open("mysql", dbURI)
+	var dbURI string
+	switch dbType {
+	case "sqlite3":
+		// dbname is the database file path, use ":memory:" for test
+		dbURI = dbName
+		log.Infof("try to connect database : %s", dbName)
+	case "postgres":
+		sslMode := config.Database.SSLMode
+		if sslMode == "" {
+			sslMode = "disable"
+		}
+		// url format will escape the special characters in password
+		dbURL := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(username, password),
+			Host:     net.JoinHostPort(dbHost, dbPort),
+			Path:     "/" + dbName,
+			RawQuery: url.Values{"sslmode": []string{sslMode}}.Encode(),
+		}
+		dbURI = dbURL.String()
+		log.Infof("try to connect database : %s:%s", dbHost, dbPort)
+	default:
+		dbType = "mysql"
+		dbURI = fmt.Sprintf(
+			"%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+			username,
+			password,
+			dbHost,
+			dbPort,
+			dbName,
+		)
+		log.Infof("try to connect database : %s:%s", dbHost, dbPort)
+	}
+	db, err = gorm.Open(dbType, dbURI)
 	if err != nil {
 		log.Errorf("connect database error:%s", err)
 		return nil, err
 	}
+	if dbType == "sqlite3" {
+		// sqlite memory database only live in one connection
+		// and sqlite do not support concurrent write
+		db.DB().SetMaxOpenConns(1)
+	}
 	log.Infoln("connect database success")
-	log.Infoln("start database automigrate")
-	db.AutoMigrate(&User{}, &Profile{}, &StorageFile{}, &ShareFiles{}, &Role{})
-	log.Infoln("database auto migrate success")
-
-	// insert default data
-	InsertDefaultRoles(db)
-
+	// tables are created by versioned migrations, see package migrations
 	return db, db.DB().Ping()
 }
 
@@ -58,6 +87,19 @@ func InsertDefaultData(db *gorm.DB) error {
 	return nil
 }
 
+// IsUniqueViolation return true when err is caused by an unique index of database
+func IsUniqueViolation(err error) bool {
+	switch e := err.(type) {
+	case sqlite3.Error:
+		return e.ExtendedCode == sqlite3.ErrConstraintUnique
+	case *pq.Error:
+		return e.Code == "23505"
+	case *mysql.MySQLError:
+		return e.Number == 1062
+	}
+	return false
+}
+
 // GetDB will return a local db variable which init before
 func GetDB() *gorm.DB {
 	if db == nil {
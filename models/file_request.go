@@ -0,0 +1,126 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/Dudobird/dudo-server/utils"
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+)
+
+// FileRequest is a public link for others upload files to folder of user
+// only the sha256 hash of link token is saved, allowed extensions are saved
+// as comma separated string, all extensions are allowed when it is empty
+type FileRequest struct {
+	ID                string     `json:"id" gorm:"primary_key"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+	UserID            string     `json:"user_id" gorm:"not null;index:idx_file_request_user"`
+	FolderID          string     `json:"folder_id" gorm:"not null"`
+	Title             string     `json:"title" gorm:"not null;default:''"`
+	Description       string     `json:"description" gorm:"not null;default:''"`
+	TokenHash         string     `json:"-" gorm:"not null;unique_index"`
+	ExpiresAt         time.Time  `json:"expires_at"`
+	MaxFileSize       int64      `json:"max_file_size" gorm:"not null;default:0"`
+	AllowedExtensions string     `json:"-" gorm:"not null;default:''"`
+	ShowUploads       bool       `json:"show_uploads" gorm:"not null;default:false"`
+	PasswordHash      string     `json:"-" gorm:"not null;default:''"`
+	FailedAttempts    int        `json:"-" gorm:"not null;default:0"`
+	LockedUntil       *time.Time `json:"-"`
+	UploadCount       int        `json:"upload_count" gorm:"not null;default:0"`
+	// Token is only returned when it is created
+	Token string `json:"token,omitempty" sql:"-"`
+}
+
+// TableName of FileRequest
+func (FileRequest) TableName() string { return "file_requests" }
+
+// MarshalJSON for transfer allowed extensions to list
+func (f *FileRequest) MarshalJSON() ([]byte, error) {
+	type AliasStruct FileRequest
+	return json.Marshal(&struct {
+		AllowedExtensions []string `json:"allowed_extensions"`
+		PasswordProtected bool     `json:"password_protected"`
+		*AliasStruct
+	}{
+		AllowedExtensions: f.ExtensionList(),
+		PasswordProtected: f.HasPassword(),
+		AliasStruct:       (*AliasStruct)(f),
+	})
+}
+
+// ExtensionList return the allowed extensions of file request
+func (f *FileRequest) ExtensionList() []string {
+	if f.AllowedExtensions == "" {
+		return []string{}
+	}
+	return strings.Split(f.AllowedExtensions, ",")
+}
+
+// AllowFile return true if the file name has an allowed extension
+func (f *FileRequest) AllowFile(fileName string) bool {
+	if f.AllowedExtensions == "" {
+		return true
+	}
+	name := strings.ToLower(fileName)
+	for _, extension := range f.ExtensionList() {
+		if strings.HasSuffix(name, "."+extension) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPassword return true if file request is protected by password
+func (f *FileRequest) HasPassword() bool {
+	return f.PasswordHash != ""
+}
+
+// GenerateToken create the token of public link, only its hash is saved
+func (f *FileRequest) GenerateToken() {
+	f.Token = utils.GenRandomID("", 40)
+	f.TokenHash = hashToken(f.Token)
+}
+
+// GetFileRequestWithToken return the file request of public link token
+func GetFileRequestWithToken(token string) (*FileRequest, error) {
+	if token == "" {
+		return nil, &utils.ErrTokenIsNotValid
+	}
+	request := &FileRequest{}
+	err := GetDB().Where("token_hash = ?", hashToken(token)).First(request).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, &utils.ErrResourceNotFound
+		}
+		log.Errorf("query file request fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	if request.ExpiresAt.Before(time.Now()) {
+		return nil, &utils.ErrFileRequestExpired
+	}
+	return request, nil
+}
+
+// FileRequestUploaderHash return the hash of uploader cookie
+func FileRequestUploaderHash(uploader string) string {
+	return hashToken(uploader)
+}
+
+// FileRequestUpload record the file uploaded with file request
+// uploader is identified by the hash of a random cookie
+type FileRequestUpload struct {
+	ID           string    `json:"id" gorm:"primary_key"`
+	CreatedAt    time.Time `json:"created_at"`
+	RequestID    string    `json:"request_id" gorm:"not null;index:idx_file_request_upload_request"`
+	FileID       string    `json:"file_id" gorm:"not null"`
+	FileName     string    `json:"file_name" gorm:"not null"`
+	FileSize     int64     `json:"file_size" gorm:"not null;default:0"`
+	UploaderHash string    `json:"-" gorm:"not null;default:''"`
+	IP           string    `json:"ip" gorm:"not null;default:''"`
+}
+
+// TableName of FileRequestUpload
+func (FileRequestUpload) TableName() string { return "file_request_uploads" }
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/Dudobird/dudo-server/utils"
+)
+
+func TestFileRequestAllowFile(t *testing.T) {
+	request := &FileRequest{}
+	utils.Assert(t, request.AllowFile("any.exe"), "all files should be allowed without extensions")
+	request.AllowedExtensions = "pdf,tar.gz"
+	tests := []struct {
+		fileName string
+		expect   bool
+	}{
+		{fileName: "contract.pdf", expect: true},
+		{fileName: "CONTRACT.PDF", expect: true},
+		{fileName: "backup.tar.gz", expect: true},
+		{fileName: "backup.gz", expect: false},
+		{fileName: "pdf", expect: false},
+		{fileName: "contract.pdf.exe", expect: false},
+	}
+	for _, test := range tests {
+		utils.Equals(t, test.expect, request.AllowFile(test.fileName))
+	}
+}
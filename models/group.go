@@ -0,0 +1,225 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Dudobird/dudo-server/utils"
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+)
+
+// Group is a list of users created by its owner for share files together
+// owner is always a member of group
+type Group struct {
+	ID        string        `json:"id" gorm:"primary_key"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+	OwnerID   string        `json:"owner_id" gorm:"not null;index:idx_group_owner"`
+	Name      string        `json:"name" gorm:"not null;type:varchar(100)"`
+	Members   []GroupMember `json:"members" gorm:"-"`
+}
+
+// TableName of Group
+func (Group) TableName() string { return "user_groups" }
+
+// GroupMember is the user in group
+type GroupMember struct {
+	ID        string    `json:"-" gorm:"primary_key"`
+	CreatedAt time.Time `json:"created_at"`
+	GroupID   string    `json:"-" gorm:"not null;unique_index:idx_group_member"`
+	UserID    string    `json:"user_id" gorm:"not null;unique_index:idx_group_member;index:idx_group_member_user"`
+	Email     string    `json:"email" gorm:"-"`
+}
+
+// TableName of GroupMember
+func (GroupMember) TableName() string { return "group_members" }
+
+// CreateGroup create a new group owned by user
+func CreateGroup(userID, name string) (*Group, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return nil, &utils.ErrPostDataNotCorrect
+	}
+	group := &Group{
+		ID:      utils.GenRandomID("group", 15),
+		OwnerID: userID,
+		Name:    name,
+	}
+	tx := GetDB().Begin()
+	err := tx.Create(group).Error
+	if err == nil {
+		err = tx.Create(&GroupMember{
+			ID:      utils.GenRandomID("member", 15),
+			GroupID: group.ID,
+			UserID:  userID,
+		}).Error
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		log.Errorf("create group fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	return group, getGroupMembers(group)
+}
+
+// GetGroups return the groups which user is a member of, with all members
+func GetGroups(userID string) ([]Group, error) {
+	groups := []Group{}
+	err := GetDB().Where(
+		"id in (?)", GetDB().Table("group_members").Select("group_id").Where("user_id = ?", userID).QueryExpr(),
+	).Order("name").Find(&groups).Error
+	if err != nil {
+		log.Errorf("query groups fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	for i := range groups {
+		if err := getGroupMembers(&groups[i]); err != nil {
+			return nil, err
+		}
+	}
+	return groups, nil
+}
+
+// GetGroup return the group with id when user is a member of it
+func GetGroup(userID, id string) (*Group, error) {
+	if IsGroupMember(userID, id) == false {
+		return nil, &utils.ErrResourceNotFound
+	}
+	group := &Group{}
+	err := GetDB().Where("id = ?", id).First(group).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, &utils.ErrResourceNotFound
+		}
+		log.Errorf("query group fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	return group, nil
+}
+
+// getGroupMembers fill the members of group with their emails
+func getGroupMembers(group *Group) error {
+	group.Members = []GroupMember{}
+	rows, err := GetDB().Table("group_members").Select(
+		"group_members.user_id, group_members.created_at, users.email",
+	).Joins("join users on users.id = group_members.user_id").Where(
+		"group_members.group_id = ?", group.ID,
+	).Order("users.email").Rows()
+	if err != nil {
+		log.Errorf("query group members fail: %s", err)
+		return &utils.ErrInternalServerError
+	}
+	defer rows.Close()
+	for rows.Next() {
+		member := GroupMember{}
+		if err := rows.Scan(&member.UserID, &member.CreatedAt, &member.Email); err != nil {
+			log.Errorf("scan group member fail: %s", err)
+			return &utils.ErrInternalServerError
+		}
+		group.Members = append(group.Members, member)
+	}
+	return nil
+}
+
+// IsGroupMember return true if user is a member of group
+func IsGroupMember(userID, groupID string) bool {
+	count := 0
+	err := GetDB().Model(&GroupMember{}).Where("group_id = ? and user_id = ?", groupID, userID).Count(&count).Error
+	if err != nil {
+		log.Errorf("query group member fail: %s", err)
+		return false
+	}
+	return count > 0
+}
+
+// getOwnedGroup return the group with id owned by user
+func getOwnedGroup(userID, id string) (*Group, error) {
+	group, err := GetGroup(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if group.OwnerID != userID {
+		return nil, &utils.ErrForbidden
+	}
+	return group, nil
+}
+
+// AddGroupMember add the user with email to group, only owner can add members
+func AddGroupMember(userID, id, email string) (*Group, error) {
+	group, err := getOwnedGroup(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	account, customErr := GetUserWithEmail(email)
+	if customErr != nil {
+		return nil, customErr
+	}
+	if IsGroupMember(account.ID, group.ID) {
+		return nil, &utils.ErrResourceAlreadyExist
+	}
+	err = GetDB().Create(&GroupMember{
+		ID:      utils.GenRandomID("member", 15),
+		GroupID: group.ID,
+		UserID:  account.ID,
+	}).Error
+	if err != nil {
+		log.Errorf("add group member fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	return group, getGroupMembers(group)
+}
+
+// RemoveGroupMember remove member from group, owner can remove others
+// and members can leave group, owner can not leave its own group
+func RemoveGroupMember(userID, id, memberID string) error {
+	group, err := GetGroup(userID, id)
+	if err != nil {
+		return err
+	}
+	if memberID == group.OwnerID {
+		return &utils.ErrPostDataNotCorrect
+	}
+	if group.OwnerID != userID && memberID != userID {
+		return &utils.ErrForbidden
+	}
+	result := GetDB().Where("group_id = ? and user_id = ?", group.ID, memberID).Delete(&GroupMember{})
+	if result.Error != nil {
+		log.Errorf("remove group member fail: %s", result.Error)
+		return &utils.ErrInternalServerError
+	}
+	if result.RowsAffected == 0 {
+		return &utils.ErrResourceNotFound
+	}
+	return nil
+}
+
+// DeleteGroup delete the group with all its members and file permissions
+func DeleteGroup(userID, id string) error {
+	group, err := getOwnedGroup(userID, id)
+	if err != nil {
+		return err
+	}
+	tx := GetDB().Begin()
+	err = tx.Where("group_id = ?", group.ID).Delete(&GroupMember{}).Error
+	if err == nil {
+		err = tx.Where("grantee_type = ? and grantee_id = ?", GranteeGroup, group.ID).Delete(&FilePermission{}).Error
+	}
+	if err == nil {
+		err = tx.Delete(group).Error
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		log.Errorf("delete group fail: %s", err)
+		return &utils.ErrInternalServerError
+	}
+	return nil
+}
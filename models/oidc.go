@@ -0,0 +1,194 @@
+package models
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Dudobird/dudo-server/utils"
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+const oidcLoginLifetime = 10 * time.Minute
+
+// OIDCLogin is a pending login with identity provider
+// the id is the hash of state sent to provider
+type OIDCLogin struct {
+	ID           string    `json:"id" gorm:"primary_key"`
+	CreatedAt    time.Time `json:"created_at"`
+	Nonce        string    `json:"-" gorm:"not null"`
+	CodeVerifier string    `json:"-" gorm:"not null"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// TableName of OIDCLogin
+func (OIDCLogin) TableName() string { return "oidc_logins" }
+
+// OIDCIdentity link the user of identity provider to dudo user
+type OIDCIdentity struct {
+	ID        string    `json:"id" gorm:"primary_key"`
+	CreatedAt time.Time `json:"created_at"`
+	Issuer    string    `json:"issuer" gorm:"not null;unique_index:idx_oidc_identity_subject"`
+	Subject   string    `json:"subject" gorm:"not null;unique_index:idx_oidc_identity_subject"`
+	UserID    string    `json:"user_id" gorm:"not null;index:idx_oidc_identity_user"`
+}
+
+// TableName of OIDCIdentity
+func (OIDCIdentity) TableName() string { return "oidc_identities" }
+
+// CreateOIDCLogin save the nonce and code verifier of login with state
+func CreateOIDCLogin(state, nonce, codeVerifier string) error {
+	now := time.Now()
+	// expired logins are not needed any more
+	GetDB().Where("expires_at < ?", now).Delete(&OIDCLogin{})
+	err := GetDB().Create(&OIDCLogin{
+		ID:           hashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    now.Add(oidcLoginLifetime),
+	}).Error
+	if err != nil {
+		log.Errorf("create oidc login fail: %s", err)
+		return &utils.ErrInternalServerError
+	}
+	return nil
+}
+
+// TakeOIDCLogin return the pending login with state and delete it
+// so each state can be used only once
+func TakeOIDCLogin(state string) (*OIDCLogin, error) {
+	login := &OIDCLogin{}
+	err := GetDB().Where("id = ? and expires_at > ?", hashToken(state), time.Now()).First(login).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, &utils.ErrSSOStateNotValid
+		}
+		log.Errorf("query oidc login fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	result := GetDB().Where("id = ?", login.ID).Delete(&OIDCLogin{})
+	if result.Error != nil {
+		log.Errorf("delete oidc login fail: %s", result.Error)
+		return nil, &utils.ErrInternalServerError
+	}
+	if result.RowsAffected == 0 {
+		return nil, &utils.ErrSSOStateNotValid
+	}
+	return login, nil
+}
+
+// findOIDCUser return the user linked to identity, or the user with same email
+// which is linked to identity now, return nil if not found
+// user is linked by email only when provider verified the email
+func findOIDCUser(issuer, subject, email string, emailVerified bool) (*User, error) {
+	identity := &OIDCIdentity{}
+	err := GetDB().Where("issuer = ? and subject = ?", issuer, subject).First(identity).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	account := &User{}
+	if err == nil {
+		err = GetDB().Unscoped().Where("id = ?", identity.UserID).First(account).Error
+		if err == nil {
+			return account, nil
+		}
+		if err != gorm.ErrRecordNotFound {
+			return nil, err
+		}
+		// linked user is deleted
+		if err := GetDB().Delete(identity).Error; err != nil {
+			return nil, err
+		}
+	}
+	err = GetDB().Unscoped().Where("email = ?", email).First(account).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if emailVerified == false {
+		return nil, &utils.ErrSSOEmailNotVerified
+	}
+	return account, linkOIDCIdentity(issuer, subject, account.ID)
+}
+
+func linkOIDCIdentity(issuer, subject, userID string) error {
+	return GetDB().Create(&OIDCIdentity{
+		ID:      utils.GenRandomID("identity", 15),
+		Issuer:  issuer,
+		Subject: subject,
+		UserID:  userID,
+	}).Error
+}
+
+// LoginWithOIDC login the user of identity provider and create the user when first login
+// role of user is changed to admin or normal user when isAdmin is not nil,
+// user with two factor must still send the code with mfa token for finish login
+func LoginWithOIDC(issuer, subject, email string, emailVerified bool, isAdmin *bool) *utils.Message {
+	validate := validator.New()
+	if err := accountValidate(validate, "email", email); err != nil {
+		return utils.NewMessage(http.StatusBadRequest, "email of identity is required")
+	}
+	account, err := findOIDCUser(issuer, subject, email, emailVerified)
+	if customErr, ok := err.(*utils.CustomError); ok {
+		return utils.NewMessage(customErr.Code(), customErr.Error())
+	}
+	if err != nil {
+		log.Errorf("query oidc user fail: %s", err)
+		return utils.NewMessage(http.StatusInternalServerError, "server unavailable")
+	}
+	if account == nil {
+		// user can only login with identity provider before reset password
+		account = &User{
+			Email:    email,
+			Password: utils.GenRandomID("", 32),
+		}
+		if isAdmin != nil && *isAdmin {
+			account.RoleID = AdminRoleID
+		}
+		if err := createUser(account); err != nil {
+			log.Errorf("create oidc user fail for %s: %s", email, err)
+			return utils.NewMessage(http.StatusInternalServerError, "server create account fail")
+		}
+		if err := linkOIDCIdentity(issuer, subject, account.ID); err != nil {
+			log.Errorf("link oidc identity fail for %s: %s", email, err)
+			return utils.NewMessage(http.StatusInternalServerError, "server create account fail")
+		}
+	}
+	if account.DeletedAt != nil {
+		return utils.NewMessage(http.StatusForbidden, "user is disabled")
+	}
+	if isAdmin != nil {
+		roleID := uint(UserRoleID)
+		if *isAdmin {
+			roleID = AdminRoleID
+		}
+		// other roles are not managed by identity provider
+		if account.RoleID != roleID && (account.RoleID == AdminRoleID || account.RoleID == UserRoleID) {
+			err := GetDB().Model(account).UpdateColumn("role_id", roleID).Error
+			if err != nil {
+				log.Errorf("update role of oidc user fail: %s", err)
+				return utils.NewMessage(http.StatusInternalServerError, "server unavailable")
+			}
+			account.RoleID = roleID
+		}
+	}
+	account.Password = ""
+	twoFactor, err := getEnabledTwoFactor(account.ID)
+	if err != nil {
+		log.Errorf("query two factor fail for %s: %s", email, err)
+		return utils.NewMessage(http.StatusInternalServerError, "server unavailable")
+	}
+	if twoFactor != nil {
+		return account.createMFAChallenge()
+	}
+	if err := account.createSession(); err != nil {
+		log.Errorf("create user session fail for %s: %s", email, err)
+		return utils.NewMessage(http.StatusInternalServerError, "server unavailable")
+	}
+	message := utils.NewMessage(http.StatusOK, "login success")
+	message.Data = account
+	return message
+}
@@ -0,0 +1,130 @@
+package models
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Dudobird/dudo-server/config"
+	"github.com/Dudobird/dudo-server/utils"
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+// PasswordReset is a token sent to user email for reset password
+// only the sha256 hash of token is saved and it can be used only once
+type PasswordReset struct {
+	ID        string     `json:"id" gorm:"primary_key"`
+	CreatedAt time.Time  `json:"created_at" gorm:"DEFAULT:current_timestamp"`
+	UserID    string     `json:"user_id" gorm:"not null;index:idx_password_reset_user"`
+	TokenHash string     `json:"-" gorm:"not null;unique_index"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+}
+
+// ResetTokenLifetime return how long the reset password token is valid
+func ResetTokenLifetime() time.Duration {
+	minutes := config.GetConfig().Mail.ResetTokenMinutes
+	if minutes <= 0 {
+		minutes = 30
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// CreatePasswordReset create a reset token for user with email
+// tokens created before for this user are not valid any more
+func CreatePasswordReset(email string) (*User, string, error) {
+	account, customErr := GetUserWithEmail(email)
+	if customErr != nil {
+		return nil, "", customErr
+	}
+	token := utils.GenRandomID("", 48)
+	now := time.Now()
+	tx := GetDB().Begin()
+	err := tx.Model(&PasswordReset{}).Where("user_id = ? and used_at is null", account.ID).UpdateColumn(
+		"used_at", &now,
+	).Error
+	if err == nil {
+		err = tx.Create(&PasswordReset{
+			ID:        utils.GenRandomID("reset", 15),
+			UserID:    account.ID,
+			TokenHash: hashToken(token),
+			ExpiresAt: now.Add(ResetTokenLifetime()),
+		}).Error
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		log.Errorf("create password reset fail: %s", err)
+		return nil, "", &utils.ErrInternalServerError
+	}
+	return account, token, nil
+}
+
+// ResetPassword set the new password of user with reset token
+// all sessions of user are revoked after password changed
+func ResetPassword(token, newPassword string) *utils.Message {
+	validate := validator.New()
+	if err := accountValidate(validate, "password", newPassword); err != nil {
+		return utils.NewMessage(http.StatusBadRequest, "new password format error")
+	}
+	reset := &PasswordReset{}
+	err := GetDB().Where(
+		"token_hash = ? and used_at is null and expires_at > ?",
+		hashToken(token),
+		time.Now(),
+	).First(reset).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return utils.NewMessage(http.StatusBadRequest, "reset token is not valid")
+		}
+		log.Errorf("query password reset fail: %s", err)
+		return utils.NewMessage(http.StatusInternalServerError, "server unavailable")
+	}
+	hashedPasswd, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return utils.NewMessage(http.StatusInternalServerError, "server unavailable")
+	}
+	now := time.Now()
+	tx := GetDB().Begin()
+	// token can be used only once even with concurrent requests
+	result := tx.Model(&PasswordReset{}).Where("id = ? and used_at is null", reset.ID).UpdateColumn(
+		"used_at", &now,
+	)
+	err = result.Error
+	if err == nil && result.RowsAffected == 0 {
+		tx.Rollback()
+		return utils.NewMessage(http.StatusBadRequest, "reset token is not valid")
+	}
+	if err == nil {
+		result = tx.Model(&User{}).Where("id = ?", reset.UserID).UpdateColumns(map[string]interface{}{
+			"password":   string(hashedPasswd),
+			"updated_at": now,
+		})
+		err = result.Error
+		if err == nil && result.RowsAffected == 0 {
+			tx.Rollback()
+			return utils.NewMessage(http.StatusNotFound, "user not found")
+		}
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		log.Errorf("reset password fail: %s", err)
+		return utils.NewMessage(http.StatusInternalServerError, "server unavailable")
+	}
+	if err := RevokeUserSessions(reset.UserID); err != nil {
+		return utils.NewMessage(http.StatusInternalServerError, "server unavailable")
+	}
+	if err := RevokeUserPersonalAccessTokens(reset.UserID); err != nil {
+		return utils.NewMessage(http.StatusInternalServerError, "server unavailable")
+	}
+	return utils.NewMessage(http.StatusOK, "reset password success")
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+)
+
+// roles of file permission, each role include all rights of the roles before it
+const (
+	PermissionViewer  = "viewer"
+	PermissionEditor  = "editor"
+	PermissionCoOwner = "co-owner"
+)
+
+var permissionLevels = map[string]int{
+	PermissionViewer:  1,
+	PermissionEditor:  2,
+	PermissionCoOwner: 3,
+}
+
+// grantee types of file permission
+const (
+	GranteeUser  = "user"
+	GranteeGroup = "group"
+)
+
+// PermissionLevel return the level of role, 0 for not valid role
+func PermissionLevel(role string) int {
+	return permissionLevels[role]
+}
+
+// FilePermission grant a user or group the role on file or folder of owner
+// the role is inherited by all sub files of folder
+type FilePermission struct {
+	ID          string    `json:"id" gorm:"primary_key"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	FileID      string    `json:"file_id" gorm:"not null;unique_index:idx_file_permission_grantee"`
+	OwnerID     string    `json:"owner_id" gorm:"not null;index:idx_file_permission_owner"`
+	GranteeType string    `json:"grantee_type" gorm:"not null;unique_index:idx_file_permission_grantee"`
+	GranteeID   string    `json:"grantee_id" gorm:"not null;unique_index:idx_file_permission_grantee;index:idx_file_permission_target"`
+	Role        string    `json:"role" gorm:"not null"`
+	GrantedBy   string    `json:"granted_by" gorm:"not null;default:''"`
+	// GranteeName is the email of user or the name of group
+	GranteeName string `json:"grantee_name" gorm:"-"`
+}
+
+// TableName of FilePermission
+func (FilePermission) TableName() string { return "file_permissions" }
@@ -0,0 +1,207 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/Dudobird/dudo-server/utils"
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+)
+
+// PersonalAccessTokenPrefix is the prefix of all personal access tokens
+// it is used for tell them from jwt tokens
+const PersonalAccessTokenPrefix = "dudo_pat_"
+
+// scopes of personal access token
+const (
+	ScopeFilesRead  = "files:read"
+	ScopeFilesWrite = "files:write"
+	ScopeShares     = "shares"
+	ScopeAdmin      = "admin"
+)
+
+var validScopes = map[string]bool{
+	ScopeFilesRead:  true,
+	ScopeFilesWrite: true,
+	ScopeShares:     true,
+	ScopeAdmin:      true,
+}
+
+// PersonalAccessToken is a long lived token for scripts
+// only the sha256 hash of token is saved, scopes are saved as comma separated string
+type PersonalAccessToken struct {
+	ID         string     `json:"id" gorm:"primary_key"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UserID     string     `json:"user_id" gorm:"not null;index:idx_personal_access_token_user"`
+	Name       string     `json:"name" gorm:"not null;type:varchar(100)"`
+	TokenHash  string     `json:"-" gorm:"not null;unique_index"`
+	Scopes     string     `json:"-" gorm:"not null"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip" gorm:"not null;default:''"`
+	RevokedAt  *time.Time `json:"-"`
+	// Token is only returned when it is created
+	Token string `json:"token,omitempty" sql:"-"`
+}
+
+// MarshalJSON for transfer scopes to list
+func (t *PersonalAccessToken) MarshalJSON() ([]byte, error) {
+	type AliasStruct PersonalAccessToken
+	return json.Marshal(&struct {
+		Scopes []string `json:"scopes"`
+		*AliasStruct
+	}{
+		Scopes:      t.ScopeList(),
+		AliasStruct: (*AliasStruct)(t),
+	})
+}
+
+// ScopeList return the scopes of token
+func (t *PersonalAccessToken) ScopeList() []string {
+	if t.Scopes == "" {
+		return []string{}
+	}
+	return strings.Split(t.Scopes, ",")
+}
+
+// HasScope return true if token has the scope
+func (t *PersonalAccessToken) HasScope(scope string) bool {
+	for _, s := range t.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// CreatePersonalAccessToken create a new token for user
+// token never expire when expiresInDays is 0
+func CreatePersonalAccessToken(userID, name string, scopes []string, expiresInDays int) (*PersonalAccessToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 || len(scopes) == 0 || expiresInDays < 0 {
+		return nil, &utils.ErrPostDataNotCorrect
+	}
+	account, customErr := GetUser(userID)
+	if customErr != nil {
+		return nil, customErr
+	}
+	unique := map[string]bool{}
+	list := []string{}
+	for _, scope := range scopes {
+		if validScopes[scope] == false {
+			return nil, &utils.ErrPostDataNotCorrect
+		}
+		if scope == ScopeAdmin && account.IsAdmin() == false {
+			return nil, &utils.ErrForbidden
+		}
+		if unique[scope] == false {
+			unique[scope] = true
+			list = append(list, scope)
+		}
+	}
+	token := PersonalAccessTokenPrefix + utils.GenRandomID("", 40)
+	accessToken := &PersonalAccessToken{
+		ID:        utils.GenRandomID("pat", 15),
+		UserID:    userID,
+		Name:      name,
+		TokenHash: hashToken(token),
+		Scopes:    strings.Join(list, ","),
+	}
+	if expiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, expiresInDays)
+		accessToken.ExpiresAt = &expiresAt
+	}
+	if err := GetDB().Create(accessToken).Error; err != nil {
+		log.Errorf("create personal access token fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	accessToken.Token = token
+	return accessToken, nil
+}
+
+// GetPersonalAccessTokens return all tokens of user which are not revoked
+func GetPersonalAccessTokens(userID string) ([]PersonalAccessToken, error) {
+	tokens := []PersonalAccessToken{}
+	err := GetDB().Where("user_id = ? and revoked_at is null", userID).Order("created_at desc").Find(&tokens).Error
+	if err != nil {
+		log.Errorf("query personal access tokens fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	return tokens, nil
+}
+
+// RevokePersonalAccessToken revoke the token of user with id
+func RevokePersonalAccessToken(userID, id string) error {
+	now := time.Now()
+	result := GetDB().Model(&PersonalAccessToken{}).Where(
+		"id = ? and user_id = ? and revoked_at is null", id, userID,
+	).UpdateColumn("revoked_at", &now)
+	if result.Error != nil {
+		log.Errorf("revoke personal access token fail: %s", result.Error)
+		return &utils.ErrInternalServerError
+	}
+	if result.RowsAffected == 0 {
+		return &utils.ErrResourceNotFound
+	}
+	return nil
+}
+
+// RevokeUserPersonalAccessTokens revoke all tokens of user
+// tokens are revoked when password is reset because they may be
+// created by others who know the old password
+func RevokeUserPersonalAccessTokens(userID string) error {
+	now := time.Now()
+	err := GetDB().Model(&PersonalAccessToken{}).Where(
+		"user_id = ? and revoked_at is null", userID,
+	).UpdateColumn("revoked_at", &now).Error
+	if err != nil {
+		log.Errorf("revoke personal access tokens fail: %s", err)
+		return &utils.ErrInternalServerError
+	}
+	return nil
+}
+
+// AuthenticatePersonalAccessToken return the token and its owner
+// the last used time and ip of token are updated
+func AuthenticatePersonalAccessToken(token, ip string) (*PersonalAccessToken, *User, error) {
+	accessToken := &PersonalAccessToken{}
+	now := time.Now()
+	err := GetDB().Where(
+		"token_hash = ? and revoked_at is null and (expires_at is null or expires_at > ?)",
+		hashToken(token),
+		now,
+	).First(accessToken).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil, &utils.ErrAuthorizationRequired
+		}
+		log.Errorf("query personal access token fail: %s", err)
+		return nil, nil, &utils.ErrInternalServerError
+	}
+	account, customErr := GetUser(accessToken.UserID)
+	if customErr != nil {
+		if customErr == &utils.ErrUserNotFound {
+			return nil, nil, &utils.ErrAuthorizationRequired
+		}
+		return nil, nil, customErr
+	}
+	// token can not be used before user enable the two factor required by role
+	needSetup, err := account.needTwoFactorSetup()
+	if err != nil {
+		log.Errorf("query two factor fail: %s", err)
+		return nil, nil, &utils.ErrInternalServerError
+	}
+	if needSetup {
+		return nil, nil, &utils.ErrTwoFactorRequired
+	}
+	err = GetDB().Model(accessToken).UpdateColumns(map[string]interface{}{
+		"last_used_at": &now,
+		"last_used_ip": ip,
+	}).Error
+	if err != nil {
+		log.Errorf("update personal access token fail: %s", err)
+	}
+	return accessToken, account, nil
+}
@@ -19,6 +19,9 @@ type Profile struct {
 
 	DiskLimit     uint64 `json:"disk_limit"`
 	UsageDiskSize uint64 `json:"usage_disk_size"`
+	// MaxFileVersions is the number of old versions kept for each file
+	// negative value means no limit
+	MaxFileVersions int `json:"max_file_versions" gorm:"not null;default:10"`
 }
 
 // MarshalJSON for transfer user to readable json
@@ -78,6 +81,21 @@ func ChangeUserStorageSize(id, readableSize string) error {
 
 }
 
+// ChangeUserMaxFileVersions change the max versions kept for each file of user
+func ChangeUserMaxFileVersions(id string, maxVersions int) error {
+	if id == "" {
+		return &utils.ErrPostDataNotCorrect
+	}
+	result := GetDB().Model(&Profile{}).Where("user_id = ?", id).Update("max_file_versions", maxVersions)
+	if result.Error != nil {
+		return &utils.ErrInternalServerError
+	}
+	if result.RowsAffected == 0 {
+		return &utils.ErrResourceNotFound
+	}
+	return nil
+}
+
 // GetUserProfile return user profile struct
 func GetUserProfile(accountID string) (*Profile, *utils.CustomError) {
 	profile := &Profile{}
@@ -7,7 +7,9 @@ type Role struct {
 	ID          uint   `json:"id" gorm:"primary_key"`
 	Name        string `json:"name" gorm:"not null"`
 	Description string `json:"description"`
-	Users       []User
+	// users of role must enable two factor authentication
+	RequireTwoFactor bool `json:"require_two_factor" gorm:"not null;default:false"`
+	Users            []User
 }
 
 // RoleID const defination
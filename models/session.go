@@ -0,0 +1,217 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/Dudobird/dudo-server/config"
+	"github.com/Dudobird/dudo-server/utils"
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+)
+
+// Session is a login session of user
+// the refresh token is saved as sha256 hash and changed each time it is used,
+// only the last access token issued for session is valid
+type Session struct {
+	ID               string     `json:"id" gorm:"primary_key"`
+	CreatedAt        time.Time  `json:"created_at" gorm:"DEFAULT:current_timestamp"`
+	UpdatedAt        time.Time  `json:"updated_at" gorm:"DEFAULT:current_timestamp"`
+	UserID           string     `json:"user_id" gorm:"not null;index:idx_session_user"`
+	RefreshTokenHash string     `json:"-" gorm:"not null;unique_index"`
+	AccessTokenID    string     `json:"-" gorm:"not null;default:''"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	RevokedAt        *time.Time `json:"revoked_at"`
+}
+
+// RevokedToken is the id of access token revoked before it expire
+// it is deleted after the access token expire
+type RevokedToken struct {
+	ID        string    `json:"id" gorm:"primary_key"`
+	CreatedAt time.Time `json:"created_at" gorm:"DEFAULT:current_timestamp"`
+	UserID    string    `json:"user_id" gorm:"not null;default:''"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index:idx_revoked_token_expires"`
+}
+
+// accessTokenLifetime return how long the access token is valid
+func accessTokenLifetime() time.Duration {
+	minutes := config.GetConfig().Application.AccessTokenMinutes
+	if minutes <= 0 {
+		minutes = 15
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// refreshTokenLifetime return how long the session is kept without refresh
+func refreshTokenLifetime() time.Duration {
+	days := config.GetConfig().Application.RefreshTokenDays
+	if days <= 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// hashToken return the sha256 of token, only the hash is saved in database
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// createSession create a new login session for user
+// and set the access token and refresh token of user
+func (u *User) createSession() error {
+	refreshToken := utils.GenRandomID("", 48)
+	session := &Session{
+		ID:               utils.GenRandomID("session", 15),
+		UserID:           u.ID,
+		RefreshTokenHash: hashToken(refreshToken),
+		ExpiresAt:        time.Now().Add(refreshTokenLifetime()),
+	}
+	token, tokenID, err := u.createToken(session.ID)
+	if err != nil {
+		return err
+	}
+	session.AccessTokenID = tokenID
+	if err := GetDB().Create(session).Error; err != nil {
+		return err
+	}
+	u.Token = token
+	u.RefreshToken = refreshToken
+	return nil
+}
+
+// RefreshSession issue a new access token and refresh token with the refresh token
+// the old refresh token and access token are not valid any more
+func RefreshSession(refreshToken string) *utils.Message {
+	session := &Session{}
+	err := GetDB().Where(
+		"refresh_token_hash = ? and revoked_at is null and expires_at > ?",
+		hashToken(refreshToken),
+		time.Now(),
+	).First(session).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return utils.NewMessage(http.StatusUnauthorized, "refresh token is not valid")
+		}
+		log.Errorf("query session fail: %s", err)
+		return utils.NewMessage(http.StatusInternalServerError, "server unavailable")
+	}
+	account := &User{}
+	err = GetDB().Where("id = ?", session.UserID).First(account).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			revokeSession(session)
+			return utils.NewMessage(http.StatusUnauthorized, "user not found")
+		}
+		log.Errorf("query user fail: %s", err)
+		return utils.NewMessage(http.StatusInternalServerError, "server unavailable")
+	}
+	newRefreshToken := utils.GenRandomID("", 48)
+	token, tokenID, err := account.createToken(session.ID)
+	if err != nil {
+		log.Errorf("create user token fail: %s", err)
+		return utils.NewMessage(http.StatusInternalServerError, "server unavailable")
+	}
+	// refresh token can be used only once even with concurrent requests
+	result := GetDB().Model(&Session{}).Where(
+		"id = ? and refresh_token_hash = ?",
+		session.ID,
+		session.RefreshTokenHash,
+	).UpdateColumns(map[string]interface{}{
+		"refresh_token_hash": hashToken(newRefreshToken),
+		"access_token_id":    tokenID,
+		"expires_at":         time.Now().Add(refreshTokenLifetime()),
+		"updated_at":         time.Now(),
+	})
+	if result.Error != nil {
+		log.Errorf("update session fail: %s", result.Error)
+		return utils.NewMessage(http.StatusInternalServerError, "server unavailable")
+	}
+	if result.RowsAffected == 0 {
+		return utils.NewMessage(http.StatusUnauthorized, "refresh token is not valid")
+	}
+	revokeAccessToken(session.AccessTokenID, session.UserID)
+	account.Password = ""
+	account.Token = token
+	account.RefreshToken = newRefreshToken
+	message := utils.NewMessage(http.StatusOK, "refresh token success")
+	message.Data = account
+	return message
+}
+
+// revokeAccessToken add the access token to revoked list
+func revokeAccessToken(tokenID, userID string) error {
+	if tokenID == "" {
+		return nil
+	}
+	now := time.Now()
+	// revoked tokens already expired are not needed any more
+	GetDB().Where("expires_at < ?", now).Delete(&RevokedToken{})
+	return GetDB().FirstOrCreate(&RevokedToken{
+		ID:        tokenID,
+		UserID:    userID,
+		ExpiresAt: now.Add(accessTokenLifetime()),
+	}, "id = ?", tokenID).Error
+}
+
+// revokeSession revoke the session and its access token
+func revokeSession(session *Session) error {
+	now := time.Now()
+	err := GetDB().Model(session).UpdateColumn("revoked_at", &now).Error
+	if err != nil {
+		return err
+	}
+	return revokeAccessToken(session.AccessTokenID, session.UserID)
+}
+
+// RevokeSession revoke the session of user with id
+func RevokeSession(userID, sessionID string) error {
+	session := &Session{}
+	err := GetDB().Where("id = ? and user_id = ? and revoked_at is null", sessionID, userID).First(session).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return &utils.ErrResourceNotFound
+		}
+		return &utils.ErrInternalServerError
+	}
+	if err := revokeSession(session); err != nil {
+		log.Errorf("revoke session fail: %s", err)
+		return &utils.ErrInternalServerError
+	}
+	return nil
+}
+
+// RevokeUserSessions revoke all sessions of user
+// user must login again on all devices
+func RevokeUserSessions(userID string) error {
+	sessions := []Session{}
+	err := GetDB().Where("user_id = ? and revoked_at is null", userID).Find(&sessions).Error
+	if err != nil {
+		log.Errorf("query sessions fail: %s", err)
+		return &utils.ErrInternalServerError
+	}
+	for i := range sessions {
+		if err := revokeSession(&sessions[i]); err != nil {
+			log.Errorf("revoke session fail: %s", err)
+			return &utils.ErrInternalServerError
+		}
+	}
+	return nil
+}
+
+// IsTokenRevoked return true when the access token is revoked
+// token without id is issued by old version and always revoked
+func IsTokenRevoked(tokenID string) bool {
+	if tokenID == "" {
+		return true
+	}
+	var counter int
+	err := GetDB().Model(&RevokedToken{}).Where("id = ?", tokenID).Count(&counter).Error
+	if err != nil {
+		log.Errorf("query revoked token fail: %s", err)
+		return true
+	}
+	return counter > 0
+}
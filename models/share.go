@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -16,4 +17,42 @@ type ShareFiles struct {
 	Expire      time.Time   `json:"expire"`
 	Description string      `json:"description" gorm:"not null;default:''"`
 	UserID      string      `json:"user_id"`
+	// PasswordHash is the bcrypt hash of share password, empty when not protected
+	PasswordHash   string     `json:"-" gorm:"not null;default:''"`
+	FailedAttempts int        `json:"-" gorm:"not null;default:0"`
+	LockedUntil    *time.Time `json:"-"`
+	// MaxDownloads is the limit of downloads, 0 means no limit
+	MaxDownloads  int `json:"max_downloads" gorm:"not null;default:0"`
+	DownloadCount int `json:"download_count" gorm:"not null;default:0"`
+}
+
+// ShareAccessLog record each access of share file from public link
+type ShareAccessLog struct {
+	ID        string    `json:"id" gorm:"primary_key"`
+	CreatedAt time.Time `json:"created_at"`
+	ShareID   string    `json:"share_id" gorm:"not null;index:idx_share_access_log_share"`
+	// FileID is the file downloaded, it is under the shared folder for folder share
+	FileID      string `json:"file_id" gorm:"not null;default:''"`
+	IP          string `json:"ip" gorm:"not null;default:''"`
+	UserAgent   string `json:"user_agent" gorm:"not null;default:''"`
+	Status      int    `json:"status" gorm:"not null;default:0"`
+	BytesServed int64  `json:"bytes_served" gorm:"not null;default:0"`
+	Success     bool   `json:"success" gorm:"not null;default:false"`
+}
+
+// MarshalJSON for show if share is protected by password
+func (s *ShareFiles) MarshalJSON() ([]byte, error) {
+	type AliasStruct ShareFiles
+	return json.Marshal(&struct {
+		PasswordProtected bool `json:"password_protected"`
+		*AliasStruct
+	}{
+		PasswordProtected: s.HasPassword(),
+		AliasStruct:       (*AliasStruct)(s),
+	})
+}
+
+// HasPassword return true if share is protected by password
+func (s *ShareFiles) HasPassword() bool {
+	return s.PasswordHash != ""
 }
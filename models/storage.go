@@ -16,6 +16,9 @@ type StorageFile struct {
 	UpdatedAt time.Time `gorm:"DEFAULT:current_timestamp"`
 	DeletedAt *time.Time
 	UserID    string `json:"user_id"`
+	// UploadedBy is the user who upload the current content
+	// it is different from owner for files in shared folders
+	UploadedBy string `json:"uploaded_by" gorm:"not null;default:''"`
 }
 
 // MarshalJSON custom json response
@@ -40,8 +43,32 @@ type RawStorageFileInfo struct {
 	FileType string `json:"file_type"`
 	FileSize int64  `json:"file_size"  gorm:"not null;default:0"`
 	FolderID string `json:"folder_id" gorm:"not null;default:''"`
-	IsDir    bool   `json:"is_dir" gorm:"not null;default:0"`
-	Path     string `json:"path" gorm:"not null;default:''"`
+	IsDir    bool   `json:"is_dir" gorm:"not null;default:false"`
+	// Path is the object name in storage bucket
+	Path string `json:"path" gorm:"not null;default:''"`
+	// Hash is the sha256 of file content, it point to the blob of file
+	Hash string `json:"hash" gorm:"not null;default:'';index:idx_file_hash"`
+	// TrashID is the id of item deleted by user, all sub files
+	// deleted together have the same trash id and restore together
+	TrashID string `json:"trash_id" gorm:"not null;default:'';index:idx_file_trash"`
+}
+
+// Uploader return the user who upload the current content
+// owner is the uploader of old files
+func (s *StorageFile) Uploader() string {
+	if s.UploadedBy != "" {
+		return s.UploadedBy
+	}
+	return s.UserID
+}
+
+// ObjectName return the object name of file in storage
+// old files without path are saved with file id as object name
+func (s *StorageFile) ObjectName() string {
+	if s.Path != "" {
+		return s.Path
+	}
+	return s.ID
 }
 
 func (s *StorageFile) validationFileName(name string) *utils.CustomError {
@@ -97,6 +124,9 @@ func (s *StorageFile) CreateFolder(uid string) *utils.CustomError {
 	}
 	s.ID = utils.GenRandomID("folder", 15)
 	err := GetDB().Model(&StorageFile{}).Create(s).Error
+	if IsUniqueViolation(err) {
+		return &utils.ErrResourceAlreadyExist
+	}
 	if err != nil {
 		return &utils.ErrInternalServerError
 	}
@@ -104,6 +134,7 @@ func (s *StorageFile) CreateFolder(uid string) *utils.CustomError {
 }
 
 // StorageFilesWithUser for controller
+// files are listed from OwnerID, which is not the user for shared files
 type StorageFilesWithUser struct {
 	Owner   *User
 	OwnerID string
@@ -113,7 +144,7 @@ type StorageFilesWithUser struct {
 // ListCurrentFile list the file with id
 func (swu *StorageFilesWithUser) ListCurrentFile(id string) (*StorageFile, *utils.CustomError) {
 	file := StorageFile{}
-	err := GetDB().Model(&StorageFile{}).Where("id=? and user_id=?", id, swu.Owner.ID).Find(&file).Error
+	err := GetDB().Model(&StorageFile{}).Where("id=? and user_id=?", id, swu.OwnerID).Find(&file).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, &utils.ErrResourceNotFound
@@ -126,7 +157,7 @@ func (swu *StorageFilesWithUser) ListCurrentFile(id string) (*StorageFile, *util
 // ListChildren list the file and all subfiles
 func (swu *StorageFilesWithUser) ListChildren(folderID string) ([]StorageFile, *utils.CustomError) {
 	files := []StorageFile{}
-	err := GetDB().Model(&StorageFile{}).Where("folder_id=? and user_id=?", folderID, swu.Owner.ID).Find(&files).Error
+	err := GetDB().Model(&StorageFile{}).Where("folder_id=? and user_id=?", folderID, swu.OwnerID).Find(&files).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, &utils.ErrResourceNotFound
@@ -0,0 +1,460 @@
+package models
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Dudobird/dudo-server/utils"
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// twoFactorIssuer is the name shown in authenticator apps
+	twoFactorIssuer      = "dudo"
+	recoveryCodeCount    = 10
+	mfaChallengeLifetime = 5 * time.Minute
+	mfaChallengeAttempts = 5
+	// twoFactorAttempts is wrong codes allowed for user before two factor is locked
+	twoFactorAttempts     = 10
+	twoFactorLockDuration = 15 * time.Minute
+)
+
+// TwoFactor is the TOTP secret of user
+// it is enabled only after user confirm it with a valid code
+type TwoFactor struct {
+	UserID    string     `json:"user_id" gorm:"primary_key"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Secret    string     `json:"-" gorm:"not null"`
+	EnabledAt *time.Time `json:"enabled_at"`
+	// LastUsedStep is the time step of last accepted code, a code can not be used twice
+	LastUsedStep int64 `json:"-" gorm:"not null;default:0"`
+	// FailedAttempts is wrong codes of user in all login challenges
+	FailedAttempts int        `json:"-" gorm:"not null;default:0"`
+	LockedUntil    *time.Time `json:"-"`
+}
+
+// RecoveryCode is a one time code for login when user lost the authenticator
+type RecoveryCode struct {
+	ID        string     `json:"id" gorm:"primary_key"`
+	CreatedAt time.Time  `json:"created_at"`
+	UserID    string     `json:"user_id" gorm:"not null;index:idx_recovery_code_user"`
+	CodeHash  string     `json:"-" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+}
+
+// MFAChallenge is the pending login after password is checked
+// user exchange its token and a two factor code for login session
+type MFAChallenge struct {
+	ID        string    `json:"id" gorm:"primary_key"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    string    `json:"user_id" gorm:"not null"`
+	TokenHash string    `json:"-" gorm:"not null;unique_index"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Attempts  int       `json:"attempts" gorm:"not null;default:0"`
+}
+
+// TableName of MFAChallenge
+func (MFAChallenge) TableName() string { return "mfa_challenges" }
+
+// MFAChallengeResponse is sent back when login need two factor code
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+// TwoFactorEnrollment is the new secret for user to add into authenticator
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// TwoFactorStatus is the two factor authentication setting of user
+type TwoFactorStatus struct {
+	Enabled           bool `json:"enabled"`
+	Required          bool `json:"required"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+// normalizeRecoveryCode make recovery code case insensitive
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(code), "-", "", -1))
+}
+
+// roleRequireTwoFactor return true when users of role must enable two factor authentication
+func roleRequireTwoFactor(roleID uint) (bool, error) {
+	role := Role{}
+	err := GetDB().Where("id = ?", roleID).First(&role).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return role.RequireTwoFactor, nil
+}
+
+// getEnabledTwoFactor return the enabled two factor setting of user or nil
+func getEnabledTwoFactor(userID string) (*TwoFactor, error) {
+	twoFactor := &TwoFactor{}
+	err := GetDB().Where("user_id = ? and enabled_at is not null", userID).First(twoFactor).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return twoFactor, nil
+}
+
+// needTwoFactorSetup return true when the role of user require two factor
+// authentication but user not enable it yet
+func (u *User) needTwoFactorSetup() (bool, error) {
+	required, err := roleRequireTwoFactor(u.RoleID)
+	if err != nil || required == false {
+		return false, err
+	}
+	twoFactor, err := getEnabledTwoFactor(u.ID)
+	if err != nil {
+		return false, err
+	}
+	return twoFactor == nil, nil
+}
+
+// createMFAChallenge return the message with mfa token for the second login step
+func (u *User) createMFAChallenge() *utils.Message {
+	token := utils.GenRandomID("", 48)
+	err := GetDB().Create(&MFAChallenge{
+		ID:        utils.GenRandomID("mfa", 15),
+		UserID:    u.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(mfaChallengeLifetime),
+	}).Error
+	if err != nil {
+		log.Errorf("create mfa challenge fail: %s", err)
+		return utils.NewMessage(http.StatusInternalServerError, "server unavailable")
+	}
+	message := utils.NewMessage(http.StatusOK, "two factor code required")
+	message.Data = &MFAChallengeResponse{MFARequired: true, MFAToken: token}
+	return message
+}
+
+// verifyTwoFactorCode check the TOTP code or recovery code of user
+// each code can be used only once, wrong codes are counted for user
+// and two factor is locked for a while after too many wrong codes
+func verifyTwoFactorCode(twoFactor *TwoFactor, code string) error {
+	if twoFactor.LockedUntil != nil && twoFactor.LockedUntil.After(time.Now()) {
+		return &utils.ErrTwoFactorTooManyAttempts
+	}
+	ok, err := checkTwoFactorCode(twoFactor, code)
+	if err != nil {
+		log.Errorf("verify two factor code fail: %s", err)
+		return &utils.ErrInternalServerError
+	}
+	if ok == false {
+		return twoFactorFail(twoFactor)
+	}
+	if twoFactor.FailedAttempts > 0 {
+		err := GetDB().Model(&TwoFactor{}).Where("user_id = ?", twoFactor.UserID).UpdateColumn("failed_attempts", 0).Error
+		if err != nil {
+			log.Errorf("reset two factor failed attempts fail: %s", err)
+		}
+	}
+	return nil
+}
+
+// checkTwoFactorCode return true and mark the code used when it is correct
+func checkTwoFactorCode(twoFactor *TwoFactor, code string) (bool, error) {
+	if step, ok := utils.ValidateTOTP(twoFactor.Secret, code, time.Now()); ok {
+		result := GetDB().Model(&TwoFactor{}).Where(
+			"user_id = ? and last_used_step < ?", twoFactor.UserID, step,
+		).UpdateColumn("last_used_step", step)
+		return result.RowsAffected == 1, result.Error
+	}
+	recovery := &RecoveryCode{}
+	err := GetDB().Where(
+		"user_id = ? and code_hash = ? and used_at is null",
+		twoFactor.UserID,
+		hashToken(normalizeRecoveryCode(code)),
+	).First(recovery).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	now := time.Now()
+	result := GetDB().Model(&RecoveryCode{}).Where("id = ? and used_at is null", recovery.ID).UpdateColumn(
+		"used_at", &now,
+	)
+	return result.RowsAffected == 1, result.Error
+}
+
+// twoFactorFail record a wrong code of user and lock two factor when too many
+func twoFactorFail(twoFactor *TwoFactor) error {
+	attempts := 0
+	query := GetDB().Model(&TwoFactor{}).Where("user_id = ?", twoFactor.UserID)
+	err := query.UpdateColumn("failed_attempts", gorm.Expr("failed_attempts + 1")).Error
+	if err == nil {
+		err = query.Select("failed_attempts").Row().Scan(&attempts)
+	}
+	if err != nil {
+		log.Errorf("update two factor failed attempts fail: %s", err)
+		return &utils.ErrInternalServerError
+	}
+	if attempts < twoFactorAttempts {
+		return &utils.ErrTwoFactorCodeNotCorrect
+	}
+	lockedUntil := time.Now().Add(twoFactorLockDuration)
+	err = query.UpdateColumns(map[string]interface{}{
+		"failed_attempts": 0,
+		"locked_until":    &lockedUntil,
+	}).Error
+	if err != nil {
+		log.Errorf("lock two factor of %s fail: %s", twoFactor.UserID, err)
+	}
+	log.Warnf("two factor of %s is locked for too many wrong codes", twoFactor.UserID)
+	return &utils.ErrTwoFactorTooManyAttempts
+}
+
+// LoginWithTwoFactor finish the login with mfa token and two factor code
+// the mfa token is not valid after too many wrong codes
+func LoginWithTwoFactor(mfaToken, code string) *utils.Message {
+	challenge := &MFAChallenge{}
+	err := GetDB().Where("token_hash = ? and expires_at > ?", hashToken(mfaToken), time.Now()).First(challenge).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return utils.NewMessage(http.StatusUnauthorized, "mfa token is not valid")
+		}
+		log.Errorf("query mfa challenge fail: %s", err)
+		return utils.NewMessage(http.StatusInternalServerError, "server unavailable")
+	}
+	result := GetDB().Model(&MFAChallenge{}).Where(
+		"id = ? and attempts < ?", challenge.ID, mfaChallengeAttempts,
+	).UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		log.Errorf("update mfa challenge fail: %s", result.Error)
+		return utils.NewMessage(http.StatusInternalServerError, "server unavailable")
+	}
+	if result.RowsAffected == 0 {
+		GetDB().Delete(challenge)
+		return utils.NewMessage(http.StatusUnauthorized, "too many wrong codes, please login again")
+	}
+	account := &User{}
+	err = GetDB().Where("id = ?", challenge.UserID).First(account).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return utils.NewMessage(http.StatusUnauthorized, "user not found")
+		}
+		log.Errorf("query user fail: %s", err)
+		return utils.NewMessage(http.StatusInternalServerError, "server unavailable")
+	}
+	twoFactor, err := getEnabledTwoFactor(account.ID)
+	if err != nil {
+		log.Errorf("query two factor fail: %s", err)
+		return utils.NewMessage(http.StatusInternalServerError, "server unavailable")
+	}
+	if twoFactor != nil {
+		if customErr, ok := verifyTwoFactorCode(twoFactor, code).(*utils.CustomError); ok {
+			return utils.NewMessage(customErr.Code(), customErr.Error())
+		}
+	}
+	GetDB().Delete(challenge)
+	account.Password = ""
+	if err := account.createSession(); err != nil {
+		log.Errorf("create user session fail for %s: %s", account.Email, err)
+		return utils.NewMessage(http.StatusInternalServerError, "server unavailable")
+	}
+	message := utils.NewMessage(http.StatusOK, "login success")
+	message.Data = account
+	return message
+}
+
+// GetTwoFactorStatus return the two factor authentication setting of user
+func GetTwoFactorStatus(userID string) (*TwoFactorStatus, error) {
+	account, customErr := GetUser(userID)
+	if customErr != nil {
+		return nil, customErr
+	}
+	status := &TwoFactorStatus{}
+	var err error
+	if status.Required, err = roleRequireTwoFactor(account.RoleID); err != nil {
+		log.Errorf("query role fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	twoFactor, err := getEnabledTwoFactor(userID)
+	if err != nil {
+		log.Errorf("query two factor fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	if twoFactor != nil {
+		status.Enabled = true
+		err = GetDB().Model(&RecoveryCode{}).Where(
+			"user_id = ? and used_at is null", userID,
+		).Count(&status.RecoveryCodesLeft).Error
+		if err != nil {
+			log.Errorf("query recovery codes fail: %s", err)
+			return nil, &utils.ErrInternalServerError
+		}
+	}
+	return status, nil
+}
+
+// EnrollTwoFactor create a new TOTP secret for user
+// it is not enabled until user confirm it with a valid code
+func EnrollTwoFactor(userID string) (*TwoFactorEnrollment, error) {
+	account, customErr := GetUser(userID)
+	if customErr != nil {
+		return nil, customErr
+	}
+	twoFactor, err := getEnabledTwoFactor(userID)
+	if err != nil {
+		log.Errorf("query two factor fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	if twoFactor != nil {
+		return nil, &utils.ErrTwoFactorAlreadyEnabled
+	}
+	secret := utils.GenTOTPSecret()
+	tx := GetDB().Begin()
+	err = tx.Where("user_id = ?", userID).Delete(&TwoFactor{}).Error
+	if err == nil {
+		err = tx.Create(&TwoFactor{UserID: userID, Secret: secret}).Error
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		log.Errorf("save two factor fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	return &TwoFactorEnrollment{
+		Secret: secret,
+		URI:    utils.TOTPProvisioningURI(secret, twoFactorIssuer, account.Email),
+	}, nil
+}
+
+// ConfirmTwoFactor enable two factor authentication after code is checked
+// return the recovery codes which are only shown once
+func ConfirmTwoFactor(userID, code string) ([]string, error) {
+	twoFactor := &TwoFactor{}
+	err := GetDB().Where("user_id = ?", userID).First(twoFactor).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, &utils.ErrTwoFactorNotEnabled
+		}
+		log.Errorf("query two factor fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	if twoFactor.EnabledAt != nil {
+		return nil, &utils.ErrTwoFactorAlreadyEnabled
+	}
+	step, ok := utils.ValidateTOTP(twoFactor.Secret, code, time.Now())
+	if ok == false {
+		return nil, &utils.ErrTwoFactorCodeNotCorrect
+	}
+	now := time.Now()
+	codes := []string{}
+	tx := GetDB().Begin()
+	err = tx.Model(twoFactor).UpdateColumns(map[string]interface{}{
+		"enabled_at":     &now,
+		"last_used_step": step,
+		"updated_at":     now,
+	}).Error
+	if err == nil {
+		err = tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error
+	}
+	for i := 0; err == nil && i < recoveryCodeCount; i++ {
+		code := strings.ToLower(utils.GenRandomID("", 10))
+		err = tx.Create(&RecoveryCode{
+			ID:       utils.GenRandomID("recovery", 15),
+			UserID:   userID,
+			CodeHash: hashToken(code),
+		}).Error
+		codes = append(codes, code[:5]+"-"+code[5:])
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		log.Errorf("enable two factor fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	return codes, nil
+}
+
+// DisableTwoFactor disable two factor authentication with password and code
+// it is not allowed when the role of user require two factor authentication
+func DisableTwoFactor(userID, password, code string) error {
+	account := &User{}
+	err := GetDB().Where("id = ?", userID).First(account).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return &utils.ErrUserNotFound
+		}
+		return &utils.ErrInternalServerError
+	}
+	if bcrypt.CompareHashAndPassword([]byte(account.Password), []byte(password)) != nil {
+		return &utils.ErrPasswordNotCorrect
+	}
+	required, err := roleRequireTwoFactor(account.RoleID)
+	if err != nil {
+		log.Errorf("query role fail: %s", err)
+		return &utils.ErrInternalServerError
+	}
+	if required {
+		return &utils.ErrTwoFactorRequired
+	}
+	twoFactor, err := getEnabledTwoFactor(userID)
+	if err != nil {
+		log.Errorf("query two factor fail: %s", err)
+		return &utils.ErrInternalServerError
+	}
+	if twoFactor == nil {
+		return &utils.ErrTwoFactorNotEnabled
+	}
+	if err := verifyTwoFactorCode(twoFactor, code); err != nil {
+		return err
+	}
+	tx := GetDB().Begin()
+	err = tx.Where("user_id = ?", userID).Delete(&TwoFactor{}).Error
+	if err == nil {
+		err = tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		log.Errorf("disable two factor fail: %s", err)
+		return &utils.ErrInternalServerError
+	}
+	return nil
+}
+
+// ChangeRoleRequireTwoFactor set if users of role must enable two factor authentication
+// users without two factor can only enable it after login
+func ChangeRoleRequireTwoFactor(roleID uint, required bool) error {
+	role := Role{}
+	err := GetDB().Where("id = ?", roleID).First(&role).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return &utils.ErrResourceNotFound
+		}
+		return &utils.ErrInternalServerError
+	}
+	err = GetDB().Model(&role).UpdateColumn("require_two_factor", required).Error
+	if err != nil {
+		log.Errorf("update role fail: %s", err)
+		return &utils.ErrInternalServerError
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Dudobird/dudo-server/utils"
+)
+
+// Upload save the state of a resumable upload
+// each received chunk is saved in storage as a temp object
+// and all chunks will be merged when upload complete
+type Upload struct {
+	ID        string    `json:"id" gorm:"primary_key"`
+	CreatedAt time.Time `json:"created_at" gorm:"DEFAULT:current_timestamp"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"DEFAULT:current_timestamp"`
+
+	UserID       string `json:"user_id" gorm:"not null;index:idx_upload_user"`
+	FolderID     string `json:"folder_id" gorm:"not null;default:''"`
+	FileName     string `json:"file_name" gorm:"not null"`
+	Bucket       string `json:"bucket" gorm:"not null;default:''"`
+	UploadLength int64  `json:"upload_length" gorm:"not null;default:0"`
+	UploadOffset int64  `json:"upload_offset" gorm:"not null;default:0"`
+	Chunks       int    `json:"chunks" gorm:"not null;default:0"`
+	// OwnerID is the owner of shared folder which file is uploaded to
+	OwnerID string `json:"owner_id" gorm:"not null;default:''"`
+	// FileID is the storage file id after upload complete
+	FileID string `json:"file_id" gorm:"not null;default:''"`
+}
+
+// NewChunkName return a unique storage object name for a new chunk
+// concurrent requests never write to the same object
+func (u *Upload) NewChunkName() string {
+	return utils.GenRandomID(u.ID, 10)
+}
+
+// FileOwnerID return the user who own the file after upload complete
+func (u *Upload) FileOwnerID() string {
+	if u.OwnerID != "" {
+		return u.OwnerID
+	}
+	return u.UserID
+}
+
+// IsComplete return true when all data received
+func (u *Upload) IsComplete() bool {
+	return u.UploadOffset == u.UploadLength
+}
+
+// UploadChunk is a received chunk of upload saved as a storage object
+// chunks are merged in the order of index
+type UploadChunk struct {
+	ID         string    `json:"id" gorm:"primary_key"`
+	CreatedAt  time.Time `json:"created_at" gorm:"DEFAULT:current_timestamp"`
+	UploadID   string    `json:"upload_id" gorm:"not null;unique_index:idx_upload_chunk"`
+	ChunkIndex int       `json:"chunk_index" gorm:"not null;unique_index:idx_upload_chunk"`
+	Object     string    `json:"object" gorm:"not null"`
+}
@@ -19,9 +19,13 @@ import (
 )
 
 // Token contains the user authenticate information
+// the id of token is checked with revoked tokens for each request
 type Token struct {
-	UserID  string
-	IsAdmin bool
+	UserID    string
+	IsAdmin   bool
+	SessionID string
+	// TwoFactorSetup token can only be used for enable two factor authentication
+	TwoFactorSetup bool
 	jwt.StandardClaims
 }
 
@@ -35,6 +39,8 @@ type User struct {
 	Password  string     `json:"-" gorm:"not null"`
 	RoleID    uint       `json:"roleid"`
 	Token     string     `json:"token" sql:"-"`
+	// RefreshToken is only returned when login or refresh token
+	RefreshToken string `json:"refresh_token,omitempty" sql:"-"`
 	// some relation to other modals
 	Files   []StorageFile `json:"-"`
 	Profile Profile       `json:"profiles"`
@@ -108,19 +114,49 @@ func (u *User) Validate() (bool, string) {
 	return true, "validate success"
 }
 
-func (u *User) createToken() (string, error) {
+// createToken return a short lived access token for session and the id of token
+func (u *User) createToken(sessionID string) (string, string, error) {
 	tokenSecret := config.GetConfig().Application.Token
+	tokenID := utils.GenRandomID("token", 15)
+	setup, err := u.needTwoFactorSetup()
+	if err != nil {
+		return "", "", err
+	}
 	token := jwt.NewWithClaims(
 		jwt.GetSigningMethod("HS256"),
 		&Token{
-			UserID:  u.ID,
-			IsAdmin: u.RoleID == AdminRoleID,
+			UserID:         u.ID,
+			IsAdmin:        u.RoleID == AdminRoleID,
+			SessionID:      sessionID,
+			TwoFactorSetup: setup,
 			StandardClaims: jwt.StandardClaims{
-				ExpiresAt: time.Now().Add(time.Hour * 24).Unix(),
+				Id:        tokenID,
+				ExpiresAt: time.Now().Add(accessTokenLifetime()).Unix(),
 			},
 		},
 	)
-	return token.SignedString([]byte(tokenSecret))
+	signed, err := token.SignedString([]byte(tokenSecret))
+	return signed, tokenID, err
+}
+
+// createUser hash the password and save user with default profile
+func createUser(u *User) error {
+	// default user level
+	if u.RoleID == 0 {
+		u.RoleID = UserRoleID
+	}
+	hashedPasswd, _ := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+	u.Password = string(hashedPasswd)
+	u.ID = utils.GenRandomID("user", 12)
+	// set defaute for profile
+	u.Profile = Profile{
+		DiskLimit:       utils.GetFileSizeFromReadable(config.GetConfig().Application.DefaultDiskLimit),
+		ProfileImage:    config.GetConfig().Application.DefaultProfileImage,
+		UsageDiskSize:   uint64(0),
+		MaxFileVersions: config.GetConfig().Application.DefaultMaxFileVersions,
+		Name:            u.ID,
+	}
+	return GetDB().Create(u).Error
 }
 
 // SignUp will valid user infomation and create it
@@ -128,6 +164,7 @@ func SignUp(email, password string, roleID int) *utils.Message {
 	u := User{
 		Email:    email,
 		Password: password,
+		RoleID:   uint(roleID),
 	}
 	if status, message := u.Validate(); status != true {
 		return utils.NewMessage(http.StatusBadRequest, message)
@@ -135,32 +172,16 @@ func SignUp(email, password string, roleID int) *utils.Message {
 	if status, err := u.CheckIfEmailExist(); status == true || err != nil {
 		return utils.NewMessage(http.StatusBadRequest, err.Error())
 	}
-	// default user level
-	if u.RoleID == 0 {
-		u.RoleID = UserRoleID
-	}
-	hashedPasswd, _ := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
-	u.Password = string(hashedPasswd)
-	u.ID = utils.GenRandomID("user", 12)
-	// set defaute for profile
-	u.Profile = Profile{
-		DiskLimit:     utils.GetFileSizeFromReadable(config.GetConfig().Application.DefaultDiskLimit),
-		ProfileImage:  config.GetConfig().Application.DefaultProfileImage,
-		UsageDiskSize: uint64(0),
-		Name:          u.ID,
-	}
-	err := GetDB().Create(u).Error
+	err := createUser(&u)
 	if err != nil {
 		log.Errorf("server sql fail for %+v:%s", u, err)
 		return utils.NewMessage(http.StatusInternalServerError, "server create account fail")
 	}
 
-	token, err := u.createToken()
-	if err != nil {
-		log.Errorf("create user token fail for %+v:%s", u, err)
+	if err := u.createSession(); err != nil {
+		log.Errorf("create user session fail for %+v:%s", u, err)
 		return utils.NewMessage(http.StatusInternalServerError, "server create account fail")
 	}
-	u.Token = token
 	message := utils.NewMessage(http.StatusCreated, "account create success")
 	message.Data = u
 	return message
@@ -195,23 +216,35 @@ func Login(email, password string) *utils.Message {
 
 	account.Password = ""
 
-	// token := jwt.NewWithClaims(jwt.GetSigningMethod("HS256"), &Token{UserID: account.ID,IsAdmin:account.RoleID == AdminRoleID})
-	// tokenString, _ := token.SignedString([]byte(tokenSecret))
-	token, _ := account.createToken()
-	account.Token = token
+	// user with two factor must send the code with mfa token for finish login
+	twoFactor, err := getEnabledTwoFactor(account.ID)
+	if err != nil {
+		log.Errorf("query two factor fail for %s: %s", email, err)
+		return utils.NewMessage(http.StatusInternalServerError, "server unavailable")
+	}
+	if twoFactor != nil {
+		return account.createMFAChallenge()
+	}
+	if err := account.createSession(); err != nil {
+		log.Errorf("create user session fail for %s: %s", email, err)
+		return utils.NewMessage(http.StatusInternalServerError, "server unavailable")
+	}
 	message := utils.NewMessage(http.StatusOK, "login success")
 	message.Data = account
 	return message
 }
 
-// Logout user will delete the user token from database
-func Logout(userID string) *utils.Message {
+// Logout user will revoke the current session
+// both access token and refresh token can not be used any more
+func Logout(userID, sessionID string) *utils.Message {
 	account := &User{}
 	err := GetDB().Table("users").Where("id = ?", userID).First(account).Error
 	if err == gorm.ErrRecordNotFound {
 		return utils.NewMessage(http.StatusNotFound, "user not found")
 	}
-	account.Token = ""
+	if err := RevokeSession(userID, sessionID); err != nil && err != &utils.ErrResourceNotFound {
+		return utils.NewMessage(http.StatusInternalServerError, "server unavailable")
+	}
 	return utils.NewMessage(http.StatusOK, "logout user success")
 }
 
@@ -243,6 +276,10 @@ func UpdatePassword(userID string, password, newPassword string) *utils.Message
 		log.Errorf("update password fail: %v", err)
 		return utils.NewMessage(http.StatusInternalServerError, "server unavailable")
 	}
+	// user must login again with new password on all devices
+	if err := RevokeUserSessions(userID); err != nil {
+		return utils.NewMessage(http.StatusInternalServerError, "server unavailable")
+	}
 	return utils.NewMessage(http.StatusOK, "update password success")
 }
 
@@ -324,9 +361,15 @@ func DeleteUserWithID(id string, isSoft bool) error {
 			now := time.Now()
 			user.DeletedAt = &now
 		}
-		return db.Unscoped().Where("id = ?", id).Save(&user).Error
+		if err := db.Unscoped().Where("id = ?", id).Save(&user).Error; err != nil {
+			return err
+		}
+		return RevokeUserSessions(id)
 	}
-	return db.Unscoped().Where("id = ?", id).Delete(&User{}).Error
+	if err := db.Unscoped().Where("id = ?", id).Delete(&User{}).Error; err != nil {
+		return err
+	}
+	return RevokeUserSessions(id)
 }
 
 // ChangeUserPassword  change user password
@@ -344,5 +387,8 @@ func ChangeUserPassword(id string, password string) error {
 		return utils.ErrInternalServerError
 	}
 	user.Password = string(hashedPasswd)
-	return db.Unscoped().Where("id = ?", id).Save(&user).Error
+	if err := db.Unscoped().Where("id = ?", id).Save(&user).Error; err != nil {
+		return err
+	}
+	return RevokeUserSessions(id)
 }
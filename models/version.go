@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// FileVersion is an old content of storage file
+// the current content is always saved in storage file
+type FileVersion struct {
+	ID string `json:"id" gorm:"primary_key"`
+	// CreatedAt is the time when this content uploaded
+	CreatedAt time.Time `json:"created_at" gorm:"DEFAULT:current_timestamp"`
+	FileID    string    `json:"file_id" gorm:"not null;index:idx_version_file"`
+	// UserID is the uploader of this version
+	UserID   string `json:"user_id" gorm:"not null;default:''"`
+	Bucket   string `json:"bucket" gorm:"not null;default:''"`
+	Path     string `json:"path" gorm:"not null;default:''"`
+	Hash     string `json:"hash" gorm:"not null;default:''"`
+	MIMEType string `json:"mime_type"`
+	FileSize int64  `json:"file_size" gorm:"not null;default:0"`
+}
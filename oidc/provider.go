@@ -0,0 +1,290 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Dudobird/dudo-server/config"
+	jwt "github.com/dgrijalva/jwt-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrIDTokenNotValid is returned when the id token from provider is not correct
+var ErrIDTokenNotValid = errors.New("id token is not valid")
+
+// discovery is the provider metadata from /.well-known/openid-configuration
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// Claims is the verified claims of id token
+type Claims map[string]interface{}
+
+// String return the claim as string, empty if not exist
+func (c Claims) String(name string) string {
+	value, _ := c[name].(string)
+	return value
+}
+
+// Contains return true when the claim is equal to value or
+// it is a list which contains value, bool claim is compared as "true" or "false"
+func (c Claims) Contains(name, value string) bool {
+	switch claim := c[name].(type) {
+	case string:
+		return claim == value
+	case bool:
+		return fmt.Sprintf("%t", claim) == value
+	case []interface{}:
+		for _, item := range claim {
+			if s, ok := item.(string); ok && s == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Provider is a openid connect provider for single sign on
+// the metadata and signing keys of provider are fetched when first used
+type Provider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// AdminClaim and AdminValue map users to admin role, empty AdminClaim disable the mapping
+	AdminClaim string
+	AdminValue string
+	Client     *http.Client
+
+	lock      sync.Mutex
+	discovery *discovery
+	keys      map[string]*rsa.PublicKey
+}
+
+// NewProvider create a new openid connect provider
+func NewProvider(issuer, clientID, clientSecret, redirectURL string, scopes []string) *Provider {
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+	return &Provider{
+		Issuer:       strings.TrimRight(issuer, "/"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       scopes,
+		Client:       &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// InitProvider create provider from the oidc config, return nil when it is not enabled
+func InitProvider() *Provider {
+	c := config.GetConfig().OIDC
+	if c.Enabled == false {
+		return nil
+	}
+	log.Infof("use openid connect provider %s for single sign on", c.Issuer)
+	provider := NewProvider(c.Issuer, c.ClientID, c.ClientSecret, c.RedirectURL, c.Scopes)
+	provider.AdminClaim = c.AdminClaim
+	provider.AdminValue = c.AdminValue
+	return provider
+}
+
+// IsAdmin return if user should have admin role, nil when mapping is disabled
+func (p *Provider) IsAdmin(claims Claims) *bool {
+	if p.AdminClaim == "" {
+		return nil
+	}
+	isAdmin := claims.Contains(p.AdminClaim, p.AdminValue)
+	return &isAdmin
+}
+
+// RandomString return a url safe random string for state, nonce and code verifier
+func RandomString() string {
+	data := make([]byte, 32)
+	rand.Read(data)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// CodeChallenge return the S256 PKCE challenge of code verifier
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (p *Provider) getJSON(url string, value interface{}) error {
+	resp, err := p.Client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("get %s fail with status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(value)
+}
+
+// getDiscovery return the metadata of provider
+func (p *Provider) getDiscovery() (*discovery, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+	meta := &discovery{}
+	if err := p.getJSON(p.Issuer+"/.well-known/openid-configuration", meta); err != nil {
+		return nil, err
+	}
+	if strings.TrimRight(meta.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("issuer %s not match %s", meta.Issuer, p.Issuer)
+	}
+	p.discovery = meta
+	return meta, nil
+}
+
+// getKey return the signing key with id, keys are fetched again for unknown key id
+func (p *Provider) getKey(kid string) (*rsa.PublicKey, error) {
+	meta, err := p.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	set := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+	if err := p.getJSON(meta.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+	p.keys = map[string]*rsa.PublicKey{}
+	for _, key := range set.Keys {
+		if key.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(key.N)
+		e, errE := base64.RawURLEncoding.DecodeString(key.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		p.keys[key.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("signing key %s not found", kid)
+}
+
+// AuthCodeURL return the url of provider for user login
+func (p *Provider) AuthCodeURL(state, nonce, codeVerifier string) (string, error) {
+	meta, err := p.getDiscovery()
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.ClientID)
+	query.Set("redirect_uri", p.RedirectURL)
+	query.Set("scope", strings.Join(p.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", CodeChallenge(codeVerifier))
+	query.Set("code_challenge_method", "S256")
+	separator := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return meta.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange get the id token with authorization code and return its verified claims
+func (p *Provider) Exchange(code, codeVerifier, nonce string) (Claims, error) {
+	meta, err := p.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("code_verifier", codeVerifier)
+	req, err := http.NewRequest("POST", meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	token := struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK || token.IDToken == "" {
+		return nil, fmt.Errorf("exchange code fail with status %d: %s", resp.StatusCode, token.Error)
+	}
+	return p.verifyIDToken(token.IDToken, nonce)
+}
+
+// verifyIDToken check the signature, issuer, audience, expiry and nonce of id token
+func (p *Provider) verifyIDToken(raw, nonce string) (Claims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodRS256 {
+			return nil, ErrIDTokenNotValid
+		}
+		kid, _ := token.Header["kid"].(string)
+		return p.getKey(kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := Claims(claims)
+	if strings.TrimRight(result.String("iss"), "/") != p.Issuer {
+		return nil, ErrIDTokenNotValid
+	}
+	if !result.Contains("aud", p.ClientID) {
+		return nil, ErrIDTokenNotValid
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, ErrIDTokenNotValid
+	}
+	if result.String("nonce") != nonce || result.String("sub") == "" {
+		return nil, ErrIDTokenNotValid
+	}
+	return result, nil
+}
@@ -0,0 +1,45 @@
+package oidc
+
+import (
+	"testing"
+
+	"github.com/Dudobird/dudo-server/utils"
+)
+
+func TestCodeChallenge(t *testing.T) {
+	// example from RFC 7636 appendix B
+	utils.Equals(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", CodeChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"))
+}
+
+func TestClaimsContains(t *testing.T) {
+	claims := Claims{
+		"groups":   []interface{}{"staff", "dudo-admins"},
+		"role":     "admin",
+		"is_admin": true,
+		"level":    float64(3),
+	}
+	testCases := []struct {
+		name   string
+		value  string
+		expect bool
+	}{
+		{name: "groups", value: "dudo-admins", expect: true},
+		{name: "groups", value: "admins", expect: false},
+		{name: "role", value: "admin", expect: true},
+		{name: "role", value: "user", expect: false},
+		{name: "is_admin", value: "true", expect: true},
+		{name: "is_admin", value: "false", expect: false},
+		{name: "level", value: "3", expect: false},
+		{name: "not_exist", value: "", expect: false},
+	}
+	for _, tc := range testCases {
+		utils.Equals(t, tc.expect, claims.Contains(tc.name, tc.value))
+	}
+
+	provider := NewProvider("https://idp.example.com/", "dudo", "", "", nil)
+	utils.Equals(t, "https://idp.example.com", provider.Issuer)
+	utils.Assert(t, provider.IsAdmin(claims) == nil, "admin mapping should be disabled")
+	provider.AdminClaim = "groups"
+	provider.AdminValue = "dudo-admins"
+	utils.Equals(t, true, *provider.IsAdmin(claims))
+}
@@ -15,7 +15,19 @@ var (
 	guestURL = []string{
 		"/api/auth/signup",
 		"/api/auth/signin",
+		"/api/auth/signin/2fa",
+		"/api/auth/refresh",
+		"/api/auth/password/forgot",
+		"/api/auth/password/reset",
+		"/api/auth/oidc/login",
+		"/api/auth/oidc/callback",
 		"/shares",
+		"/shares/unlock",
+		"/shares/files",
+		"/shares/download",
+		"/requests",
+		"/requests/unlock",
+		"/requests/upload",
 	}
 )
 
@@ -43,6 +55,10 @@ func jwtAuthenticationMiddleware(next http.Handler) http.Handler {
 			return
 		}
 		tokenFromHeader := splitted[1]
+		if strings.HasPrefix(tokenFromHeader, models.PersonalAccessTokenPrefix) {
+			personalAccessTokenAuthentication(next, w, r, tokenFromHeader)
+			return
+		}
 
 		userToken := &models.Token{}
 		token, err := jwt.ParseWithClaims(tokenFromHeader, userToken, func(token *jwt.Token) (interface{}, error) {
@@ -57,8 +73,25 @@ func jwtAuthenticationMiddleware(next http.Handler) http.Handler {
 			utils.JSONRespnseWithTextMessage(w, http.StatusUnauthorized, "token valid fail")
 			return
 		}
+		// token is revoked after logout or password changed
+		if models.IsTokenRevoked(userToken.Id) {
+			utils.JSONRespnseWithTextMessage(w, http.StatusUnauthorized, "token is revoked")
+			return
+		}
+		// user must enable two factor authentication before use other apis
+		if userToken.TwoFactorSetup && !isTwoFactorSetupURL(requestPath) {
+			utils.JSONRespnseWithTextMessage(w, http.StatusForbidden, "two factor authentication is required")
+			return
+		}
 		r = r.WithContext(context.WithValue(r.Context(), utils.TokenContextKey, userToken.UserID))
 		r = r.WithContext(context.WithValue(r.Context(), utils.AdminContextKey, userToken.IsAdmin))
+		r = r.WithContext(context.WithValue(r.Context(), utils.SessionContextKey, userToken.SessionID))
 		next.ServeHTTP(w, r)
 	})
 }
+
+// isTwoFactorSetupURL return true for the apis allowed before
+// user enable the required two factor authentication
+func isTwoFactorSetupURL(path string) bool {
+	return strings.HasPrefix(path, "/api/auth/2fa") || path == "/api/auth/logout"
+}
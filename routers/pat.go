@@ -0,0 +1,55 @@
+package routers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/utils"
+)
+
+// personalAccessTokenScope return the scope required for request with personal access token
+// it return empty string for the apis which can only be used after login,
+// like change password or manage tokens
+func personalAccessTokenScope(r *http.Request) string {
+	path := r.URL.Path
+	switch {
+	case strings.HasPrefix(path, "/api/auth/"), strings.HasPrefix(path, "/api/tokens"):
+		return ""
+	case strings.HasPrefix(path, "/api/admin/"):
+		return models.ScopeAdmin
+	case strings.HasPrefix(path, "/api/shares"), strings.HasPrefix(path, "/api/share/"), strings.HasPrefix(path, "/api/requests"),
+		strings.HasPrefix(path, "/api/groups"), strings.HasPrefix(path, "/api/files/") && strings.Contains(path, "/permissions"):
+		return models.ScopeShares
+	case path == "/api/search/files":
+		return models.ScopeFilesRead
+	case r.Method == "GET" || r.Method == "HEAD" || r.Method == "OPTIONS":
+		return models.ScopeFilesRead
+	default:
+		return models.ScopeFilesWrite
+	}
+}
+
+// personalAccessTokenAuthentication authenticate request with personal access token
+// request is stopped when token not valid or without the required scope
+func personalAccessTokenAuthentication(next http.Handler, w http.ResponseWriter, r *http.Request, token string) {
+	accessToken, account, err := models.AuthenticatePersonalAccessToken(token, utils.GetRequestIP(r))
+	if err != nil {
+		if err == &utils.ErrAuthorizationRequired {
+			utils.JSONRespnseWithTextMessage(w, http.StatusUnauthorized, "token valid fail")
+			return
+		}
+		utils.JSONRespnseWithErr(w, err)
+		return
+	}
+	scope := personalAccessTokenScope(r)
+	if scope == "" || !accessToken.HasScope(scope) {
+		utils.JSONRespnseWithTextMessage(w, http.StatusForbidden, "token scope not allowed")
+		return
+	}
+	r = r.WithContext(context.WithValue(r.Context(), utils.TokenContextKey, account.ID))
+	r = r.WithContext(context.WithValue(r.Context(), utils.AdminContextKey, account.IsAdmin() && accessToken.HasScope(models.ScopeAdmin)))
+	r = r.WithContext(context.WithValue(r.Context(), utils.SessionContextKey, ""))
+	next.ServeHTTP(w, r)
+}
@@ -32,8 +32,22 @@ func LoadRouters() (router *mux.Router, err error) {
 	router.Use(appBindMiddleware)
 	router.HandleFunc("/api/auth/signup", controllers.CreateUser).Methods("POST")
 	router.HandleFunc("/api/auth/signin", controllers.Login).Methods("POST")
+	router.HandleFunc("/api/auth/signin/2fa", controllers.LoginWithTwoFactor).Methods("POST")
+	router.HandleFunc("/api/auth/oidc/login", controllers.OIDCLogin).Methods("GET")
+	router.HandleFunc("/api/auth/oidc/callback", controllers.OIDCCallback).Methods("GET")
+	router.HandleFunc("/api/auth/refresh", controllers.RefreshToken).Methods("POST")
 	router.HandleFunc("/api/auth/logout", controllers.Logout).Methods("GET")
 	router.HandleFunc("/api/auth/password", controllers.UpdatePassword).Methods("POST")
+	router.HandleFunc("/api/auth/password/forgot", controllers.ForgotPassword).Methods("POST")
+	router.HandleFunc("/api/auth/password/reset", controllers.ResetPassword).Methods("POST")
+	router.HandleFunc("/api/auth/2fa", controllers.GetTwoFactorStatus).Methods("GET")
+	router.HandleFunc("/api/auth/2fa/enroll", controllers.EnrollTwoFactor).Methods("POST")
+	router.HandleFunc("/api/auth/2fa/confirm", controllers.ConfirmTwoFactor).Methods("POST")
+	router.HandleFunc("/api/auth/2fa/disable", controllers.DisableTwoFactor).Methods("POST")
+
+	router.HandleFunc("/api/tokens", controllers.GetPersonalAccessTokens).Methods("GET")
+	router.HandleFunc("/api/tokens", controllers.CreatePersonalAccessToken).Methods("POST")
+	router.HandleFunc("/api/tokens/{id}", controllers.RevokePersonalAccessToken).Methods("DELETE")
 
 	router.HandleFunc("/api/folders", controllers.CreateFolder).Methods("POST")
 	router.HandleFunc("/api/folders/{id}", controllers.ListFolderFiles).Methods("GET")
@@ -42,9 +56,40 @@ func LoadRouters() (router *mux.Router, err error) {
 	router.HandleFunc("/api/files/{id}", controllers.UpdateFileInfo).Methods("PUT")
 	// delete files
 	router.HandleFunc("/api/files/{id}", controllers.DeleteFiles).Methods("DELETE")
+	router.HandleFunc("/api/files/{id}/move", controllers.MoveFile).Methods("POST")
+	router.HandleFunc("/api/files/{id}/copy", controllers.CopyFile).Methods("POST")
+
+	router.HandleFunc("/api/files/{id}/permissions", controllers.GetFilePermissions).Methods("GET")
+	router.HandleFunc("/api/files/{id}/permissions", controllers.GrantFilePermission).Methods("POST")
+	router.HandleFunc("/api/files/{id}/permissions/{permissionID}", controllers.RevokeFilePermission).Methods("DELETE")
+	// files and folders shared with user by others
+	router.HandleFunc("/api/shared", controllers.GetSharedWithMe).Methods("GET")
+
+	router.HandleFunc("/api/groups", controllers.GetGroups).Methods("GET")
+	router.HandleFunc("/api/groups", controllers.CreateGroup).Methods("POST")
+	router.HandleFunc("/api/groups/{id}", controllers.DeleteGroup).Methods("DELETE")
+	router.HandleFunc("/api/groups/{id}/members", controllers.AddGroupMember).Methods("POST")
+	router.HandleFunc("/api/groups/{id}/members/{userID}", controllers.RemoveGroupMember).Methods("DELETE")
+
+	router.HandleFunc("/api/files/{id}/versions", controllers.ListFileVersions).Methods("GET")
+	router.HandleFunc("/api/files/{id}/versions/{versionID}", controllers.DeleteFileVersion).Methods("DELETE")
+	router.HandleFunc("/api/files/{id}/versions/{versionID}/restore", controllers.RestoreFileVersion).Methods("POST")
+
+	router.HandleFunc("/api/trash", controllers.ListTrash).Methods("GET")
+	router.HandleFunc("/api/trash", controllers.EmptyTrash).Methods("DELETE")
+	router.HandleFunc("/api/trash/{id}/restore", controllers.RestoreTrash).Methods("POST")
+
 	// for top level becouse no folder just set it to `root`
 	router.HandleFunc("/api/upload/files/{folderID}", controllers.UploadFiles).Methods("POST")
+	router.HandleFunc("/api/upload/hash/{folderID}", controllers.UploadFilesWithHash).Methods("POST")
 	router.HandleFunc("/api/download/files/{id}", controllers.DownloadFiles).Methods("GET")
+	router.HandleFunc("/api/download/files/{id}/versions/{versionID}", controllers.DownloadFileVersion).Methods("GET")
+	// resumable upload with tus protocol
+	router.HandleFunc("/api/tus/folders/{folderID}", controllers.TusOptions).Methods("OPTIONS")
+	router.HandleFunc("/api/tus/folders/{folderID}", controllers.TusCreateUpload).Methods("POST")
+	router.HandleFunc("/api/tus/uploads/{id}", controllers.TusGetUploadOffset).Methods("HEAD")
+	router.HandleFunc("/api/tus/uploads/{id}", controllers.TusPatchUpload).Methods("PATCH")
+	router.HandleFunc("/api/tus/uploads/{id}", controllers.TusDeleteUpload).Methods("DELETE")
 
 	router.HandleFunc("/api/profile", controllers.GetProfile).Methods("GET")
 	router.HandleFunc("/api/profile", controllers.UpdateProfile).Methods("PUT")
@@ -52,14 +97,27 @@ func LoadRouters() (router *mux.Router, err error) {
 	router.HandleFunc("/api/shares", controllers.GetShareFiles).Methods("GET")
 	router.HandleFunc("/api/shares", controllers.CreateShareFile).Methods("POST")
 	router.HandleFunc("/api/share/{id}", controllers.DeleteShareFile).Methods("DELETE")
+	router.HandleFunc("/api/share/{id}/logs", controllers.GetShareAccessLogs).Methods("GET")
 	router.HandleFunc("/shares", controllers.GetShareFileFromToken).Methods("GET")
+	router.HandleFunc("/shares/unlock", controllers.UnlockShareFile).Methods("POST")
+	router.HandleFunc("/shares/files", controllers.ListShareFolder).Methods("GET")
+	router.HandleFunc("/shares/download", controllers.DownloadShareFolderFile).Methods("GET")
+
+	router.HandleFunc("/api/requests", controllers.GetFileRequests).Methods("GET")
+	router.HandleFunc("/api/requests", controllers.CreateFileRequest).Methods("POST")
+	router.HandleFunc("/api/requests/{id}", controllers.DeleteFileRequest).Methods("DELETE")
+	router.HandleFunc("/requests", controllers.GetFileRequestInfo).Methods("GET")
+	router.HandleFunc("/requests/unlock", controllers.UnlockFileRequest).Methods("POST")
+	router.HandleFunc("/requests/upload", controllers.UploadFileRequest).Methods("POST")
 
 	adminRouter := router.PathPrefix("/api/admin").Subrouter()
 	adminRouter.Use(adminMiddleware)
 	adminRouter.HandleFunc("/users", controllers.AdminGetUsers).Methods("GET")
 	adminRouter.HandleFunc("/users/{id}", controllers.AdminDeleteUser).Methods("DELETE")
 	adminRouter.HandleFunc("/users/{id}/limit", controllers.AdminChangeUserStorageLimit).Methods("PUT")
+	adminRouter.HandleFunc("/users/{id}/versions", controllers.AdminChangeUserMaxFileVersions).Methods("PUT")
 	adminRouter.HandleFunc("/users/{id}/password", controllers.AdminChangeUserPassword).Methods("PUT")
+	adminRouter.HandleFunc("/roles/{id}/2fa", controllers.AdminChangeRoleTwoFactor).Methods("PUT")
 	// router.HandleFunc("/api/admin/shares", controllers.GetAdminShares).Methods("GET")
 	// router.HandleFunc("/api/admin/files", controllers.GetAdminFiles).Methods("GET")
 
@@ -1,17 +1,33 @@
 package storage
 
 import (
+	"os"
+	"path/filepath"
+
 	"github.com/Dudobird/dudo-server/config"
 	minio "github.com/minio/minio-go"
 	log "github.com/sirupsen/logrus"
 )
 
-var storageManager *MinioManager
+var storageManager Storage
 
 // InitStorageManager create storage manager
+// based on the type of storage config
 func InitStorageManager() Storage {
-	var err error
 	c := config.GetConfig()
+	switch c.Storage.Type {
+	case "local":
+		storageManager = initLocalFSManager(c)
+	case "memory":
+		log.Infoln("use memory storage, all files will lose after restart")
+		storageManager = NewMemoryManager()
+	default:
+		storageManager = initMinioManager(c)
+	}
+	return storageManager
+}
+
+func initMinioManager(c *config.Config) *MinioManager {
 	server := c.Storage.Server
 	port := c.Storage.Port
 	accessKey := c.Storage.AccessKey
@@ -23,11 +39,23 @@ func InitStorageManager() Storage {
 		log.Panicf("connect storage fail: %s", err)
 	}
 	log.Infoln("connect object storage success")
-	storageManager = NewMinioManager(storageConnect)
-	return storageManager
+	return NewMinioManager(storageConnect)
+}
+
+func initLocalFSManager(c *config.Config) *LocalFSManager {
+	root, err := filepath.Abs(c.Storage.Root)
+	if err != nil {
+		log.Panicf("get local storage path fail: %s", err)
+	}
+	log.Infof("use local storage at : %s", root)
+	err = os.MkdirAll(root, 0755)
+	if err != nil {
+		log.Panicf("create local storage folder fail: %s", err)
+	}
+	return NewLocalFSManager(root)
 }
 
 // GetStorageManager get storage manager object
-func GetStorageManager() *MinioManager {
+func GetStorageManager() Storage {
 	return storageManager
 }
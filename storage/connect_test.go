@@ -8,5 +8,5 @@ import (
 
 func TestGetStorageManager(t *testing.T) {
 	storageManager = nil
-	utils.Equals(t, (*MinioManager)(nil), GetStorageManager())
+	utils.Equals(t, nil, GetStorageManager())
 }
@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/Dudobird/dudo-server/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// LocalFSManager save all files in local file system
+// each bucket will be a folder under the root path
+type LocalFSManager struct {
+	Root string
+}
+
+// NewLocalFSManager create a new local storage manager
+func NewLocalFSManager(root string) *LocalFSManager {
+	if root == "" {
+		return nil
+	}
+	return &LocalFSManager{
+		Root: root,
+	}
+}
+
+func (m *LocalFSManager) bucketPath(bucketName string) string {
+	return filepath.Join(m.Root, filepath.Base(bucketName))
+}
+
+func (m *LocalFSManager) objectPath(fileName string, bucketName string) string {
+	return filepath.Join(m.bucketPath(bucketName), filepath.Base(fileName))
+}
+
+func (m *LocalFSManager) checkBucket(bucketName string) error {
+	info, err := os.Stat(m.bucketPath(bucketName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return errors.New("bucket not exist")
+		}
+		return err
+	}
+	if info.IsDir() == false {
+		return errors.New("bucket not exist")
+	}
+	return nil
+}
+
+func copyFile(dst string, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return writeFile(dst, in)
+}
+
+func writeFile(dst string, reader io.Reader) error {
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, reader)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Upload will write the reader into bucket folder
+func (m *LocalFSManager) Upload(reader io.Reader, size int64, fileName string, bucketName string) (path string, err error) {
+	err = os.MkdirAll(m.bucketPath(bucketName), 0755)
+	if err != nil {
+		return
+	}
+	objectPath := m.objectPath(fileName, bucketName)
+	err = writeFile(objectPath, reader)
+	if err != nil {
+		// do not keep the broken file
+		os.Remove(objectPath)
+	}
+	return
+}
+
+// Download copy file from bucket folder to filePath
+func (m *LocalFSManager) Download(filePath string, fileName string, bucketName string) error {
+	if err := m.checkBucket(bucketName); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	return copyFile(filePath, m.objectPath(fileName, bucketName))
+}
+
+// Open the file in bucket folder for read
+func (m *LocalFSManager) Open(fileName string, bucketName string) (ObjectReader, error) {
+	if err := m.checkBucket(bucketName); err != nil {
+		return nil, err
+	}
+	return os.Open(m.objectPath(fileName, bucketName))
+}
+
+// Copy copy file to another bucket folder
+func (m *LocalFSManager) Copy(srcFileName, srcBucket, dstFileName, dstBucket string) error {
+	if err := m.checkBucket(srcBucket); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.bucketPath(dstBucket), 0755); err != nil {
+		return err
+	}
+	return copyFile(m.objectPath(dstFileName, dstBucket), m.objectPath(srcFileName, srcBucket))
+}
+
+// Delete remove file from bucket folder
+func (m *LocalFSManager) Delete(fileName string, bucketName string) error {
+	if err := m.checkBucket(bucketName); err != nil {
+		return err
+	}
+	return os.Remove(m.objectPath(fileName, bucketName))
+}
+
+// ListObjects return the names of all files in bucket folder
+func (m *LocalFSManager) ListObjects(bucketName string) ([]string, error) {
+	if err := m.checkBucket(bucketName); err != nil {
+		return []string{}, nil
+	}
+	files, err := ioutil.ReadDir(m.bucketPath(bucketName))
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, f := range files {
+		if f.IsDir() == false {
+			names = append(names, f.Name())
+		}
+	}
+	return names, nil
+}
+
+// CleanBucket delete all files in one bucket folder
+func (m *LocalFSManager) CleanBucket(bucketName string) []error {
+	if err := m.checkBucket(bucketName); err != nil {
+		return []error{err}
+	}
+	errs := []error{}
+	files, err := ioutil.ReadDir(m.bucketPath(bucketName))
+	if err != nil {
+		return []error{err}
+	}
+	for _, f := range files {
+		err := os.RemoveAll(m.objectPath(f.Name(), bucketName))
+		if err != nil {
+			log.Errorf("Delete from bucket %s error : %s", bucketName, err)
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// RemoveBucket delete a bucket folder and all files in it if force = true
+func (m *LocalFSManager) RemoveBucket(bucketName string, force bool) error {
+	if err := m.checkBucket(bucketName); err != nil {
+		return err
+	}
+	if force == true {
+		m.CleanBucket(bucketName)
+	}
+	return os.Remove(m.bucketPath(bucketName))
+}
+
+// DownloadFolder will write all files as a zip stream to writer
+func (m *LocalFSManager) DownloadFolder(writer io.Writer, files map[string][]models.StorageFile) []error {
+	return zipFolder(m, writer, files)
+}
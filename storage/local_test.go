@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Dudobird/dudo-server/utils"
+)
+
+func TestLocalFSManager(t *testing.T) {
+	root, err := ioutil.TempDir("", "dudo-local")
+	utils.OK(t, err)
+	defer os.RemoveAll(root)
+	manager := NewLocalFSManager(root)
+
+	content := "this is upload.file"
+	_, err = manager.Upload(strings.NewReader(content), int64(len(content)), "file_1", "dudotest-user")
+	utils.OK(t, err)
+	_, err = manager.Upload(strings.NewReader(content), -1, "file_2", "dudotest-user")
+	utils.OK(t, err)
+
+	dst := filepath.Join(root, "download", "download.file")
+	utils.OK(t, manager.Download(dst, "file_1", "dudotest-user"))
+	data, err := ioutil.ReadFile(dst)
+	utils.OK(t, err)
+	utils.Equals(t, "this is upload.file", string(data))
+
+	utils.OK(t, manager.Copy("file_1", "dudotest-user", "file_3", "dudotest-copy"))
+	utils.OK(t, manager.Download(dst, "file_3", "dudotest-copy"))
+	data, err = ioutil.ReadFile(dst)
+	utils.OK(t, err)
+	utils.Equals(t, "this is upload.file", string(data))
+	names, err := manager.ListObjects("dudotest-copy")
+	utils.OK(t, err)
+	utils.Equals(t, []string{"file_3"}, names)
+	utils.OK(t, manager.RemoveBucket("dudotest-copy", true))
+	names, err = manager.ListObjects("dudotest-copy")
+	utils.OK(t, err)
+	utils.Equals(t, 0, len(names))
+
+	err = manager.Download(dst, "file_1", "notexist")
+	utils.Assert(t, err != nil, "download from not exist bucket should fail")
+
+	utils.OK(t, manager.Delete("file_1", "dudotest-user"))
+	err = manager.Download(dst, "file_1", "dudotest-user")
+	utils.Assert(t, err != nil, "download deleted file should fail")
+
+	err = manager.RemoveBucket("dudotest-user", false)
+	utils.Assert(t, err != nil, "remove bucket with files should fail without force")
+	utils.Equals(t, 0, len(manager.CleanBucket("dudotest-user")))
+	utils.OK(t, manager.RemoveBucket("dudotest-user", false))
+	_, err = os.Stat(filepath.Join(root, "dudotest-user"))
+	utils.Assert(t, os.IsNotExist(err), "bucket folder should be removed")
+}
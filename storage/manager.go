@@ -2,11 +2,9 @@ package storage
 
 import (
 	"errors"
-	"os"
-	"path/filepath"
+	"io"
 
 	"github.com/Dudobird/dudo-server/models"
-	"github.com/Dudobird/dudo-server/utils"
 	minio "github.com/minio/minio-go"
 	log "github.com/sirupsen/logrus"
 )
@@ -47,13 +45,13 @@ func (m *MinioManager) checkOrCreateBucket(bucket string) error {
 	return nil
 }
 
-// Upload will upload file
-func (m *MinioManager) Upload(filePath string, fileName string, bucketName string) (path string, err error) {
+// Upload will stream the reader to minio
+func (m *MinioManager) Upload(reader io.Reader, size int64, fileName string, bucketName string) (path string, err error) {
 	err = m.checkOrCreateBucket(bucketName)
 	if err != nil {
 		return
 	}
-	_, err = m.Handler.FPutObject(bucketName, fileName, filePath, minio.PutObjectOptions{})
+	_, err = m.Handler.PutObject(bucketName, fileName, reader, size, minio.PutObjectOptions{})
 	if err != nil {
 		return
 	}
@@ -72,6 +70,35 @@ func (m *MinioManager) Download(filePath string, fileName string, bucketName str
 	return m.Handler.FGetObject(bucketName, fileName, filePath, minio.GetObjectOptions{})
 }
 
+// Open return the minio object for read
+// object is checked first because GetObject report errors only when read
+func (m *MinioManager) Open(fileName string, bucketName string) (ObjectReader, error) {
+	exist, err := m.Handler.BucketExists(bucketName)
+	if err != nil {
+		return nil, err
+	}
+	if exist == false {
+		return nil, errors.New("bucket not exist")
+	}
+	if _, err := m.Handler.StatObject(bucketName, fileName, minio.StatObjectOptions{}); err != nil {
+		return nil, err
+	}
+	return m.Handler.GetObject(bucketName, fileName, minio.GetObjectOptions{})
+}
+
+// Copy use server side copy of minio for copy the object
+func (m *MinioManager) Copy(srcFileName, srcBucket, dstFileName, dstBucket string) error {
+	err := m.checkOrCreateBucket(dstBucket)
+	if err != nil {
+		return err
+	}
+	dst, err := minio.NewDestinationInfo(dstBucket, dstFileName, nil, nil)
+	if err != nil {
+		return err
+	}
+	return m.Handler.CopyObject(dst, minio.NewSourceInfo(srcBucket, srcFileName, nil))
+}
+
 // Delete download files from minio
 func (m *MinioManager) Delete(fileName string, bucketName string) error {
 	exist, err := m.Handler.BucketExists(bucketName)
@@ -84,6 +111,24 @@ func (m *MinioManager) Delete(fileName string, bucketName string) error {
 	return m.Handler.RemoveObject(bucketName, fileName)
 }
 
+// ListObjects return all object names in one bucket from minio
+func (m *MinioManager) ListObjects(bucketName string) ([]string, error) {
+	exist, err := m.Handler.BucketExists(bucketName)
+	if err != nil || exist == false {
+		return []string{}, err
+	}
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+	names := []string{}
+	for object := range m.Handler.ListObjectsV2(bucketName, "", true, doneCh) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		names = append(names, object.Key)
+	}
+	return names, nil
+}
+
 // CleanBucket delete  all files in one bucket from minio
 func (m *MinioManager) CleanBucket(bucketName string) []error {
 	exist, err := m.Handler.BucketExists(bucketName)
@@ -128,35 +173,7 @@ func (m *MinioManager) RemoveBucket(bucketName string, force bool) error {
 	return m.Handler.RemoveBucket(bucketName)
 }
 
-// DownloadFolder will download all files based on files
-func (m *MinioManager) DownloadFolder(tempFolderPath, folderName string, files map[string][]models.StorageFile) (string, []error) {
-	errors := []error{}
-	folderPath := filepath.Join(tempFolderPath, folderName)
-	zipFilePath := folderPath + ".zip"
-	filePathList := []string{}
-	for path, fileList := range files {
-		for _, file := range fileList {
-			filePath := filepath.Join(tempFolderPath, path, file.FileName)
-			if file.IsDir == true {
-				// create folder
-				os.MkdirAll(filePath, os.ModePerm)
-				continue
-			}
-			err := m.Download(filePath, file.ID, file.Bucket)
-			if err != nil {
-				log.Errorf("download file %s error: %s", file.FileName, err)
-				errors = append(errors, err)
-			}
-			filePathList = append(filePathList, filePath)
-		}
-	}
-	if len(errors) > 0 {
-		return zipFilePath, errors
-	}
-	// compress file
-	err := utils.ZipFiles(zipFilePath, filePathList, tempFolderPath)
-	if err != nil {
-		return "", append(errors, err)
-	}
-	return zipFilePath, nil
+// DownloadFolder will write all files as a zip stream to writer
+func (m *MinioManager) DownloadFolder(writer io.Writer, files map[string][]models.StorageFile) []error {
+	return zipFolder(m, writer, files)
 }
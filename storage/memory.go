@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/Dudobird/dudo-server/models"
+)
+
+// MemoryManager keep all files in memory
+// it is only useful for test and will lose all files after restart
+type MemoryManager struct {
+	mu      sync.RWMutex
+	buckets map[string]map[string][]byte
+}
+
+// NewMemoryManager create a new memory storage manager
+func NewMemoryManager() *MemoryManager {
+	return &MemoryManager{
+		buckets: make(map[string]map[string][]byte),
+	}
+}
+
+// Upload read all content from reader and save it to bucket
+func (m *MemoryManager) Upload(reader io.Reader, size int64, fileName string, bucketName string) (path string, err error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	bucket, ok := m.buckets[bucketName]
+	if !ok {
+		bucket = make(map[string][]byte)
+		m.buckets[bucketName] = bucket
+	}
+	bucket[fileName] = data
+	return
+}
+
+// Download write file content in bucket to filePath
+func (m *MemoryManager) Download(filePath string, fileName string, bucketName string) error {
+	m.mu.RLock()
+	bucket, ok := m.buckets[bucketName]
+	if !ok {
+		m.mu.RUnlock()
+		return errors.New("bucket not exist")
+	}
+	data, ok := bucket[fileName]
+	m.mu.RUnlock()
+	if !ok {
+		return errors.New("file not exist")
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filePath, data, 0644)
+}
+
+// memoryObject is a file content in memory with a nop Close
+type memoryObject struct {
+	*bytes.Reader
+}
+
+func (o memoryObject) Close() error {
+	return nil
+}
+
+// Open return a reader of file content in bucket
+func (m *MemoryManager) Open(fileName string, bucketName string) (ObjectReader, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	bucket, ok := m.buckets[bucketName]
+	if !ok {
+		return nil, errors.New("bucket not exist")
+	}
+	data, ok := bucket[fileName]
+	if !ok {
+		return nil, errors.New("file not exist")
+	}
+	return memoryObject{bytes.NewReader(data)}, nil
+}
+
+// Copy save the content of file to another bucket
+func (m *MemoryManager) Copy(srcFileName, srcBucket, dstFileName, dstBucket string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	bucket, ok := m.buckets[srcBucket]
+	if !ok {
+		return errors.New("bucket not exist")
+	}
+	data, ok := bucket[srcFileName]
+	if !ok {
+		return errors.New("file not exist")
+	}
+	dst, ok := m.buckets[dstBucket]
+	if !ok {
+		dst = make(map[string][]byte)
+		m.buckets[dstBucket] = dst
+	}
+	// content is never changed after upload so it can be shared
+	dst[dstFileName] = data
+	return nil
+}
+
+// Delete remove file from bucket
+func (m *MemoryManager) Delete(fileName string, bucketName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	bucket, ok := m.buckets[bucketName]
+	if !ok {
+		return errors.New("bucket not exist")
+	}
+	delete(bucket, fileName)
+	return nil
+}
+
+// ListObjects return the names of all files in bucket
+func (m *MemoryManager) ListObjects(bucketName string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := []string{}
+	for name := range m.buckets[bucketName] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// CleanBucket delete all files in one bucket
+func (m *MemoryManager) CleanBucket(bucketName string) []error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.buckets[bucketName]; !ok {
+		return []error{errors.New("bucket not exist")}
+	}
+	m.buckets[bucketName] = make(map[string][]byte)
+	return []error{}
+}
+
+// RemoveBucket delete a bucket and all files in it if force = true
+func (m *MemoryManager) RemoveBucket(bucketName string, force bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	bucket, ok := m.buckets[bucketName]
+	if !ok {
+		return errors.New("bucket not exist")
+	}
+	if force == false && len(bucket) > 0 {
+		return errors.New("bucket is not empty")
+	}
+	delete(m.buckets, bucketName)
+	return nil
+}
+
+// DownloadFolder will write all files as a zip stream to writer
+func (m *MemoryManager) DownloadFolder(writer io.Writer, files map[string][]models.StorageFile) []error {
+	return zipFolder(m, writer, files)
+}
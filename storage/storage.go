@@ -1,29 +1,147 @@
 package storage
 
 import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
 	"github.com/Dudobird/dudo-server/models"
+	log "github.com/sirupsen/logrus"
 )
 
+// ObjectReader is the file content read from storage
+// it support seek for serve http range request
+type ObjectReader interface {
+	io.ReadSeeker
+	io.Closer
+}
+
 // Storage is a interface for upload and get files
 // it could be local storage or object storage like s3
 type Storage interface {
 	// Upload file to storage
-	// filepath is the temp upload file path for upload to storage
-	Upload(filePath, fileName, bucket string) (path string, err error)
+	// reader is the file content and size is its length, -1 if unknown
+	Upload(reader io.Reader, size int64, fileName, bucket string) (path string, err error)
 
 	// Download file from storage
 	// filePath is the temp file path for download from storage
 	Download(filePath, fileName, bucket string) error
 
-	// download folder as a zip file
-	DownloadFolder(tempFolderPath, folderName string, files map[string][]models.StorageFile) (string, []error)
+	// Open file from storage for read, caller must close it after use
+	Open(fileName, bucket string) (ObjectReader, error)
+
+	// DownloadFolder write all files as a zip stream to writer
+	DownloadFolder(writer io.Writer, files map[string][]models.StorageFile) []error
+
+	// Copy file to another object inside storage
+	// content is copied by storage without pass through server
+	Copy(srcFileName, srcBucket, dstFileName, dstBucket string) error
 
 	// Delete file from storage
 	Delete(fileName, bucket string) error
 
+	// ListObjects return the names of all files in bucket
+	// it return empty list when the bucket not exist
+	ListObjects(bucket string) ([]string, error)
+
 	// CleanBucket remove all files from a bucket
 	CleanBucket(bucket string) []error
 
 	// Remove a bucker if force == true ,remove it even some file in this bucket
 	RemoveBucket(bucket string, force bool) error
 }
+
+// zipErrorsFileName is the manifest of files which fail to add into the zip
+const zipErrorsFileName = "dudo-download-errors.txt"
+
+// zipNameReplacer replace path separators in names of files
+var zipNameReplacer = strings.NewReplacer("/", "_", "\\", "_")
+
+// cleanZipSegment return the name which can be used as one segment of zip entry
+func cleanZipSegment(name string) string {
+	name = zipNameReplacer.Replace(name)
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return name
+}
+
+// zipEntryName join the folder path and file name to the name of zip entry,
+// entries can not be extracted to the outside of the zip folder
+func zipEntryName(folder, fileName string) string {
+	segments := []string{}
+	for _, segment := range strings.Split(filepath.ToSlash(folder), "/") {
+		if segment != "" {
+			segments = append(segments, cleanZipSegment(segment))
+		}
+	}
+	return strings.Join(append(segments, cleanZipSegment(fileName)), "/")
+}
+
+// zipFolder write all files into writer as a zip stream, the content
+// of each file is read from storage directly without temp files
+// files fail to read will be recorded in a error manifest in the zip
+func zipFolder(s Storage, writer io.Writer, files map[string][]models.StorageFile) []error {
+	errs := []error{}
+	manifest := []string{}
+	zipWriter := zip.NewWriter(writer)
+	paths := []string{}
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		for _, file := range files[path] {
+			name := zipEntryName(path, file.FileName)
+			var err error
+			if file.IsDir == true {
+				// keep empty folders in zip
+				_, err = zipWriter.CreateHeader(&zip.FileHeader{
+					Name:     name + "/",
+					Modified: file.UpdatedAt,
+				})
+			} else {
+				err = addObjectToZip(s, zipWriter, name, file)
+			}
+			if err != nil {
+				log.Errorf("download file %s error: %s", file.FileName, err)
+				errs = append(errs, err)
+				manifest = append(manifest, fmt.Sprintf("%s: %s", name, err))
+			}
+		}
+	}
+	if len(manifest) > 0 {
+		w, err := zipWriter.Create(zipErrorsFileName)
+		if err == nil {
+			_, err = io.WriteString(w, strings.Join(manifest, "\n")+"\n")
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := zipWriter.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+func addObjectToZip(s Storage, zipWriter *zip.Writer, name string, file models.StorageFile) error {
+	object, err := s.Open(file.ObjectName(), file.Bucket)
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+	writer, err := zipWriter.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: file.UpdatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, object)
+	return err
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/utils"
+)
+
+func newStorageFile(id, name string, isDir bool) models.StorageFile {
+	return models.StorageFile{
+		RawStorageFileInfo: models.RawStorageFileInfo{
+			ID:       id,
+			FileName: name,
+			Bucket:   "dudotest-user",
+			IsDir:    isDir,
+		},
+	}
+}
+
+func TestDownloadFolder(t *testing.T) {
+	manager := NewMemoryManager()
+	content := "this is 1.file"
+	_, err := manager.Upload(strings.NewReader(content), int64(len(content)), "file_1", "dudotest-user")
+	utils.OK(t, err)
+
+	files := map[string][]models.StorageFile{
+		"/files": []models.StorageFile{
+			newStorageFile("file_1", "1.file", false),
+			newStorageFile("folder_1", "empty", true),
+			newStorageFile("file_2", "2.file", false),
+		},
+	}
+	buff := &bytes.Buffer{}
+	errs := manager.DownloadFolder(buff, files)
+	utils.Equals(t, 1, len(errs))
+
+	reader, err := zip.NewReader(bytes.NewReader(buff.Bytes()), int64(buff.Len()))
+	utils.OK(t, err)
+	contents := make(map[string]string)
+	for _, f := range reader.File {
+		r, err := f.Open()
+		utils.OK(t, err)
+		data, err := ioutil.ReadAll(r)
+		utils.OK(t, err)
+		r.Close()
+		contents[f.Name] = string(data)
+	}
+	utils.Equals(t, 3, len(contents))
+	utils.Equals(t, content, contents["files/1.file"])
+	_, ok := contents["files/empty/"]
+	utils.Assert(t, ok, "empty folder should be in zip")
+	utils.Assert(t, strings.HasPrefix(contents[zipErrorsFileName], "files/2.file:"), "fail file should be in error manifest")
+}
+
+func TestZipEntryName(t *testing.T) {
+	testCases := []struct {
+		folder   string
+		fileName string
+		name     string
+	}{
+		{folder: "", fileName: "1.file", name: "1.file"},
+		{folder: "/files/sub/", fileName: "1.file", name: "files/sub/1.file"},
+		{folder: "/files", fileName: "../../etc/passwd", name: "files/.._.._etc_passwd"},
+		{folder: "/files", fileName: "..", name: "files/_"},
+		{folder: "../files/./a", fileName: "a\\b", name: "_/files/_/a/a_b"},
+		{folder: "/files", fileName: "", name: "files/_"},
+	}
+	for _, tc := range testCases {
+		utils.Equals(t, tc.name, zipEntryName(tc.folder, tc.fileName))
+	}
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/utils"
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+)
+
+// FindBlob return the blob with content hash
+func (store *FileStore) FindBlob(hash string) (*models.Blob, error) {
+	blob := &models.Blob{}
+	err := store.DB.Where("hash = ?", hash).First(blob).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, &utils.ErrResourceNotFound
+		}
+		log.Errorf("query blob fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	return blob, nil
+}
+
+// FindUserBlob return the blob with content hash which user already has in
+// files or versions, content only saved by other users is not found,
+// so hash can not be used to copy or probe the files of others
+func (store *FileStore) FindUserBlob(hash string) (*models.Blob, error) {
+	var counter int
+	userFiles := store.DB.Unscoped().Model(&models.StorageFile{}).Where("user_id = ?", store.userID)
+	err := userFiles.Where("hash = ?", hash).Count(&counter).Error
+	if err == nil && counter == 0 {
+		err = store.DB.Model(&models.FileVersion{}).Where(
+			"hash = ? and (user_id = ? or file_id in (?))",
+			hash, store.userID, userFiles.Select("id").QueryExpr(),
+		).Count(&counter).Error
+	}
+	if err != nil {
+		log.Errorf("query blob reference of user fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	if counter == 0 {
+		return nil, &utils.ErrResourceNotFound
+	}
+	return store.FindBlob(hash)
+}
+
+// addBlobReference add one reference to the blob with same hash
+// the blob will be created if the content not exist before,
+// after success the bucket and path of blob are the saved ones
+func (store *FileStore) addBlobReference(blob *models.Blob) error {
+	var err error
+	// retry once when other request create the same blob at same time
+	for i := 0; i < 2; i++ {
+		result := store.DB.Model(&models.Blob{}).Where("hash = ?", blob.Hash).UpdateColumn(
+			"ref_count", gorm.Expr("ref_count + 1"),
+		)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			return store.DB.Where("hash = ?", blob.Hash).First(blob).Error
+		}
+		blob.RefCount = 1
+		err = store.DB.Create(blob).Error
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// releaseBlobReference remove one reference of blob
+// return true when it is the last reference and the blob is deleted,
+// then the object of blob should be deleted from storage
+func (store *FileStore) releaseBlobReference(hash string) (bool, error) {
+	err := store.DB.Model(&models.Blob{}).Where("hash = ?", hash).UpdateColumn(
+		"ref_count", gorm.Expr("ref_count - 1"),
+	).Error
+	if err != nil {
+		return false, err
+	}
+	result := store.DB.Where("hash = ? and ref_count <= 0", hash).Delete(&models.Blob{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
@@ -0,0 +1,189 @@
+package store
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/utils"
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxFileRequestDays is the max days before file request expire
+const maxFileRequestDays = 90
+
+// CreateFileRequest create a file request link for upload files to folder of user
+// request is protected by password when password is not empty,
+// extensions without dot limit the file types can be uploaded
+func (store *FileStore) CreateFileRequest(request *models.FileRequest, days int, password string, extensions []string) error {
+	request.Title = strings.TrimSpace(request.Title)
+	if days <= 0 || len(request.Title) > 100 || request.MaxFileSize < 0 {
+		return &utils.ErrPostDataNotCorrect
+	}
+	if days > maxFileRequestDays {
+		return &utils.ErrValidationOverMaxShareDate
+	}
+	folder, err := store.getStorageFile(request.FolderID)
+	if err != nil {
+		return err
+	}
+	if folder.IsDir == false {
+		return &utils.ErrPostDataNotCorrect
+	}
+	unique := map[string]bool{}
+	list := []string{}
+	for _, extension := range extensions {
+		extension = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(extension), "."))
+		if extension == "" || strings.ContainsAny(extension, ",/") {
+			return &utils.ErrPostDataNotCorrect
+		}
+		if unique[extension] == false {
+			unique[extension] = true
+			list = append(list, extension)
+		}
+	}
+	if password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			log.Errorf("hash file request password fail : %s", err)
+			return &utils.ErrInternalServerError
+		}
+		request.PasswordHash = string(hash)
+	}
+	request.ID = utils.GenRandomID("request", 15)
+	request.UserID = store.userID
+	request.AllowedExtensions = strings.Join(list, ",")
+	request.ExpiresAt = time.Now().AddDate(0, 0, days)
+	request.GenerateToken()
+	if err := store.DB.Create(request).Error; err != nil {
+		log.Errorf("create file request fail : %s", err)
+		return &utils.ErrInternalServerError
+	}
+	return nil
+}
+
+// GetFileRequests return all file requests of user
+func (store *FileStore) GetFileRequests() ([]models.FileRequest, error) {
+	requests := []models.FileRequest{}
+	err := store.DB.Where("user_id = ?", store.userID).Order("created_at desc").Find(&requests).Error
+	if err != nil {
+		log.Errorf("query file requests fail : %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	return requests, nil
+}
+
+// DeleteFileRequest delete the file request of user with id
+// the uploaded files are kept in folder
+func (store *FileStore) DeleteFileRequest(id string) error {
+	result := store.DB.Where("id = ? and user_id = ?", id, store.userID).Delete(&models.FileRequest{})
+	if result.Error != nil {
+		log.Errorf("delete file request fail : %s", result.Error)
+		return &utils.ErrInternalServerError
+	}
+	if result.RowsAffected == 0 {
+		return &utils.ErrResourceNotFound
+	}
+	err := store.DB.Where("request_id = ?", id).Delete(&models.FileRequestUpload{}).Error
+	if err != nil {
+		log.Errorf("delete file request uploads fail : %s", err)
+	}
+	return nil
+}
+
+// UnlockFileRequest check the password of file request and return a short lived unlock token
+func (store *FileStore) UnlockFileRequest(request *models.FileRequest, password string) (string, error) {
+	return store.unlock(&models.FileRequest{}, request.ID, request.PasswordHash, password)
+}
+
+// VerifyFileRequestUnlockToken return true if token is issued for file request by UnlockFileRequest
+func (store *FileStore) VerifyFileRequestUnlockToken(request *models.FileRequest, token string) bool {
+	return verifyUnlockToken(request.ID, request.PasswordHash, token)
+}
+
+// GetFileRequestFolder return the folder which files are uploaded to
+// store must be created with the user id of file request owner
+func (store *FileStore) GetFileRequestFolder(request *models.FileRequest) (*models.StorageFile, error) {
+	if store.userID != request.UserID {
+		return nil, &utils.ErrResourceNotFound
+	}
+	folder, err := store.getStorageFile(request.FolderID)
+	if err != nil {
+		return nil, err
+	}
+	if folder.IsDir == false {
+		return nil, &utils.ErrResourceNotFound
+	}
+	return folder, nil
+}
+
+// UniqueFileName return a file name not exist in folder
+// "name (n).ext" is used when file with name already exist
+func (store *FileStore) UniqueFileName(folderID, fileName string) (string, error) {
+	if store.StorageFileExistUnderFolderID(folderID, fileName) == false {
+		return fileName, nil
+	}
+	extension := filepath.Ext(fileName)
+	base := strings.TrimSuffix(fileName, extension)
+	for i := 1; i <= 100; i++ {
+		name := fmt.Sprintf("%s (%d)%s", base, i, extension)
+		if store.StorageFileExistUnderFolderID(folderID, name) == false {
+			return name, nil
+		}
+	}
+	return "", &utils.ErrResourceAlreadyExist
+}
+
+// RecordFileRequestUpload save the file uploaded with file request
+func (store *FileStore) RecordFileRequestUpload(request *models.FileRequest, fileID, fileName string, fileSize int64, uploader, ip string) error {
+	tx := store.DB.Begin()
+	err := tx.Create(&models.FileRequestUpload{
+		ID:           utils.GenRandomID("upload", 15),
+		RequestID:    request.ID,
+		FileID:       fileID,
+		FileName:     fileName,
+		FileSize:     fileSize,
+		UploaderHash: models.FileRequestUploaderHash(uploader),
+		IP:           ip,
+	}).Error
+	if err == nil {
+		err = tx.Model(&models.FileRequest{}).Where("id = ?", request.ID).UpdateColumn(
+			"upload_count", gorm.Expr("upload_count + 1"),
+		).Error
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		log.Errorf("save file request upload fail : %s", err)
+		return &utils.ErrInternalServerError
+	}
+	return nil
+}
+
+// GetFileRequestUploads return the uploads which are still in folder, newest first
+// only the uploads of uploader are returned when uploads are not shown to others
+func (store *FileStore) GetFileRequestUploads(request *models.FileRequest, uploader string) ([]models.FileRequestUpload, error) {
+	uploads := []models.FileRequestUpload{}
+	if request.ShowUploads == false && uploader == "" {
+		return uploads, nil
+	}
+	query := store.DB.Select("file_request_uploads.*").Joins(
+		"join storage_files on storage_files.id = file_request_uploads.file_id and storage_files.deleted_at is null",
+	).Where("file_request_uploads.request_id = ?", request.ID)
+	if request.ShowUploads == false {
+		query = query.Where("file_request_uploads.uploader_hash = ?", models.FileRequestUploaderHash(uploader))
+	}
+	err := query.Order("file_request_uploads.created_at desc").Find(&uploads).Error
+	if err != nil {
+		log.Errorf("query file request uploads fail : %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	return uploads, nil
+}
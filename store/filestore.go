@@ -32,6 +32,11 @@ func NewFileStore(userID string) *FileStore {
 	}
 }
 
+// UserID return the user id of this store
+func (store *FileStore) UserID() string {
+	return store.userID
+}
+
 // GetOrCreateFolder implement StorageHandler interface
 // return the folder id of parent and path combination
 // if path not exist create it and return id
@@ -101,6 +106,17 @@ func (store *FileStore) createFoldersUnderParentID(parentID string, folders []st
 				Path:     "",
 			},
 		}).Error
+		if models.IsUniqueViolation(err) {
+			// folder is created by other request at the same time
+			s := &models.StorageFile{}
+			err = store.DB.Where(
+				"user_id = ? and folder_id = ? and file_name = ?", store.userID, parent, folder,
+			).First(s).Error
+			if err == nil && s.IsDir == false {
+				return "", &utils.ErrResourceAlreadyExist
+			}
+			currentFolderID = s.ID
+		}
 		if err != nil {
 			log.Errorf("create folder fail:%s", err)
 			return "", &utils.ErrInternalServerError
@@ -129,6 +145,36 @@ func (store *FileStore) StorageFileExistUnderFolderID(folderID, fileName string)
 	return false
 }
 
+// GetStorageFileUnderFolderID return the file with name under folder
+func (store *FileStore) GetStorageFileUnderFolderID(folderID, fileName string) (*models.StorageFile, error) {
+	file := &models.StorageFile{}
+	err := store.DB.Where(
+		"folder_id = ? and file_name = ? and user_id = ?",
+		folderID, fileName, store.userID,
+	).First(file).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, &utils.ErrResourceNotFound
+		}
+		return nil, &utils.ErrInternalServerError
+	}
+	return file, nil
+}
+
+// getStorageFile return the file or folder with id of user
+func (store *FileStore) getStorageFile(id string) (*models.StorageFile, error) {
+	file := &models.StorageFile{}
+	err := store.DB.Where("id = ? and user_id = ?", id, store.userID).First(file).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, &utils.ErrResourceNotFound
+		}
+		log.Errorf("query file fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	return file, nil
+}
+
 // StorageFileExistCheck  return true when file exist or false if not exist
 func (store *FileStore) StorageFileExistCheck(fileID string) bool {
 	existCheckStorage := &models.StorageFile{}
@@ -140,14 +186,93 @@ func (store *FileStore) StorageFileExistCheck(fileID string) bool {
 }
 
 // SaveStorage save the data and update profile usage size
+// file with content hash will reference the blob of same content,
+// and its bucket and path are changed to the blob's if blob already exist
 func (store *FileStore) SaveStorage(storage *models.StorageFile) error {
-	err := store.DB.Save(storage).Error
+	if storage.Hash != "" {
+		blob := &models.Blob{
+			Hash:     storage.Hash,
+			Bucket:   storage.Bucket,
+			Path:     storage.Path,
+			MIMEType: storage.MIMEType,
+			Size:     storage.FileSize,
+		}
+		if err := store.addBlobReference(blob); err != nil {
+			log.Errorf("add blob reference error: %s", err)
+			return err
+		}
+		storage.Bucket = blob.Bucket
+		storage.Path = blob.Path
+	}
+	return store.saveStorageInfo(storage)
+}
+
+// SaveStorageFromBlob save the file which content is an exist blob
+// return ErrResourceNotFound when the blob of file hash not exist
+func (store *FileStore) SaveStorageFromBlob(storage *models.StorageFile) error {
+	result := store.DB.Model(&models.Blob{}).Where("hash = ?", storage.Hash).UpdateColumn(
+		"ref_count", gorm.Expr("ref_count + 1"),
+	)
+	if result.Error != nil {
+		log.Errorf("add blob reference error: %s", result.Error)
+		return &utils.ErrInternalServerError
+	}
+	if result.RowsAffected == 0 {
+		return &utils.ErrResourceNotFound
+	}
+	blob := &models.Blob{}
+	err := store.DB.Where("hash = ?", storage.Hash).First(blob).Error
 	if err != nil {
+		log.Errorf("query blob error: %s", err)
+		store.releaseBlobReference(storage.Hash)
+		return &utils.ErrInternalServerError
+	}
+	storage.Bucket = blob.Bucket
+	storage.Path = blob.Path
+	err = store.saveStorageInfo(storage)
+	if err != nil {
+		if customErr, ok := err.(*utils.CustomError); ok {
+			return customErr
+		}
+		return &utils.ErrInternalServerError
+	}
+	return nil
+}
+
+// saveStorageInfo save the file meta data and add its size to user usage
+// in one transaction, it fail with ErrDiskQuotaExceeded when user has no space
+func (store *FileStore) saveStorageInfo(storage *models.StorageFile) error {
+	tx := store.DB.Begin()
+	err := tx.Save(storage).Error
+	if models.IsUniqueViolation(err) {
+		err = &utils.ErrResourceAlreadyExist
+	} else if err != nil {
 		log.Errorf("save file error: %s", err)
+	} else {
+		err = store.reserveDiskUsage(tx, storage.UserID, storage.FileSize)
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		if storage.Hash != "" {
+			store.releaseBlobReference(storage.Hash)
+		}
 		return err
 	}
-	profile := models.Profile{UserID: storage.UserID}
-	err = store.DB.Model(&profile).UpdateColumn("usage_disk_size", gorm.Expr("usage_disk_size + ?", storage.FileSize)).Error
+	return nil
+}
+
+// addDiskUsage change the disk usage of user by size
+// usage is never less than zero when size is negative
+func (store *FileStore) addDiskUsage(db *gorm.DB, userID string, size int64) error {
+	expr := gorm.Expr("usage_disk_size + ?", size)
+	if size < 0 {
+		expr = gorm.Expr("CASE WHEN usage_disk_size > ? THEN usage_disk_size - ? ELSE 0 END", -size, -size)
+	}
+	err := db.Model(&models.Profile{}).Where("user_id = ?", userID).UpdateColumn("usage_disk_size", expr).Error
 	if err != nil {
 		log.Errorf("update user profile disk usage fail:%s", err)
 		return err
@@ -155,36 +280,46 @@ func (store *FileStore) SaveStorage(storage *models.StorageFile) error {
 	return nil
 }
 
-// DeleteFolders delete folder and update the disk usage
-func (store *FileStore) DeleteFolders(parentID string) ([]models.StorageFile, error) {
-	pendingDeleteFiles := []models.StorageFile{}
-	deleteFiles := []models.StorageFile{}
-	err := store.DB.Where("id=?", parentID).Or("folder_id=?", parentID).Find(&pendingDeleteFiles).Error
+// reserveDiskUsage add size to the disk usage of user only when
+// the usage is still not over the disk limit of user after add
+func (store *FileStore) reserveDiskUsage(db *gorm.DB, userID string, size int64) error {
+	if size <= 0 {
+		return store.addDiskUsage(db, userID, size)
+	}
+	result := db.Model(&models.Profile{}).Where(
+		"user_id = ? and usage_disk_size + ? <= disk_limit",
+		userID,
+		size,
+	).UpdateColumn("usage_disk_size", gorm.Expr("usage_disk_size + ?", size))
+	if result.Error != nil {
+		log.Errorf("update user profile disk usage fail:%s", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &utils.ErrDiskQuotaExceeded
+	}
+	return nil
+}
+
+// CheckDiskQuota return error when user has no space for a new file with size
+// ErrFileTooLarge is returned when the file is larger than the whole disk limit
+func (store *FileStore) CheckDiskQuota(size int64) error {
+	profile := &models.Profile{}
+	err := store.DB.Where("user_id = ?", store.userID).First(profile).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return pendingDeleteFiles, nil
+			return &utils.ErrUserNotFound
 		}
-		return pendingDeleteFiles, err
+		log.Errorf("query user profile fail: %s", err)
+		return &utils.ErrInternalServerError
 	}
-	for _, f := range pendingDeleteFiles {
-		if f.UserID != store.userID {
-			continue
-		}
-		if f.IsDir == false {
-			deleteFiles = append(deleteFiles, f)
-		}
-		if f.ID != parentID {
-			// subfolder
-			files, err := store.DeleteFolders(f.ID)
-			if err != nil {
-				log.Errorf("delete files fail: %s", err)
-			} else {
-				deleteFiles = append(deleteFiles, files...)
-			}
-		}
-		store.DB.Unscoped().Delete(f)
+	if size < 0 || uint64(size) > profile.DiskLimit {
+		return &utils.ErrFileTooLarge
 	}
-	return deleteFiles, nil
+	if profile.UsageDiskSize+uint64(size) > profile.DiskLimit {
+		return &utils.ErrDiskQuotaExceeded
+	}
+	return nil
 }
 
 //SearchResults search result return
@@ -200,11 +335,14 @@ func (store *FileStore) SearchFiles(search string) ([]SearchResults, error) {
 
 	// var parentFiles []*models.StorageFile
 	// var storageFiles []*models.StorageFile
+	// use left join and lower() for all of mysql, postgres and sqlite
+	// sqlite not support right join and postgres like is case sensitive
 	queryString := `
 	SELECT P.id AS parent_id, P.file_name AS parent_filename,
-	C.id, C.file_name,C.mime_type,C.file_type,C.file_size,C.is_dir,C.created_at,C.updated_at,C.deleted_at FROM storage_files AS P RIGHT OUTER JOIN storage_files 
-	AS C ON C.folder_id=P.id where C.user_id = ? and C.file_name LIKE ?`
-	rows, err := store.DB.DB().Query(queryString, store.userID, fmt.Sprintf("%%%s%%", search))
+	C.id, C.file_name,C.mime_type,C.file_type,C.file_size,C.is_dir,C.created_at,C.updated_at,C.deleted_at FROM storage_files AS C LEFT OUTER JOIN storage_files
+	AS P ON C.folder_id=P.id where C.user_id = ? and C.deleted_at IS NULL and LOWER(C.file_name) LIKE LOWER(?)`
+	// gorm will replace the placeholder for different database
+	rows, err := store.DB.Raw(queryString, store.userID, fmt.Sprintf("%%%s%%", search)).Rows()
 	if err != nil {
 		log.Error(err)
 		return searchFiles, &utils.ErrInternalServerError
@@ -266,6 +404,9 @@ func (store *FileStore) RenameFileName(id string, name string) (*models.StorageF
 	}
 	file.FileName = name
 	err = store.DB.Save(file).Error
+	if models.IsUniqueViolation(err) {
+		return nil, &utils.ErrResourceAlreadyExist
+	}
 	if err != nil {
 		return nil, &utils.ErrInternalServerError
 	}
@@ -0,0 +1,237 @@
+package store
+
+import (
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/utils"
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+)
+
+// kinds of records which reference storage objects
+const (
+	ObjectRefFile    = "file"
+	ObjectRefVersion = "version"
+	ObjectRefBlob    = "blob"
+	ObjectRefUpload  = "upload"
+)
+
+// ObjectRef is a storage object referenced by a database record
+type ObjectRef struct {
+	Kind   string `json:"kind"`
+	ID     string `json:"id"`
+	Bucket string `json:"bucket"`
+	Object string `json:"object"`
+}
+
+// ListObjectRefs return all storage objects referenced by database
+// files in trash and chunks of unfinished uploads are included
+func ListObjectRefs() ([]ObjectRef, error) {
+	db := models.GetDB()
+	refs := []ObjectRef{}
+	files := []models.StorageFile{}
+	if err := db.Unscoped().Where("is_dir = ?", false).Find(&files).Error; err != nil {
+		log.Errorf("query files fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	for _, f := range files {
+		refs = append(refs, ObjectRef{Kind: ObjectRefFile, ID: f.ID, Bucket: f.Bucket, Object: f.ObjectName()})
+	}
+	versions := []models.FileVersion{}
+	if err := db.Find(&versions).Error; err != nil {
+		log.Errorf("query file versions fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	for _, v := range versions {
+		refs = append(refs, ObjectRef{Kind: ObjectRefVersion, ID: v.ID, Bucket: v.Bucket, Object: v.Path})
+	}
+	blobs := []models.Blob{}
+	if err := db.Find(&blobs).Error; err != nil {
+		log.Errorf("query blobs fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	for _, b := range blobs {
+		refs = append(refs, ObjectRef{Kind: ObjectRefBlob, ID: b.Hash, Bucket: b.Bucket, Object: b.Path})
+	}
+	uploads := []models.Upload{}
+	if err := db.Where("file_id = ''").Find(&uploads).Error; err != nil {
+		log.Errorf("query uploads fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	store := &FileStore{DB: db}
+	for _, u := range uploads {
+		chunks, err := store.GetUploadChunks(&u)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range chunks {
+			refs = append(refs, ObjectRef{Kind: ObjectRefUpload, ID: u.ID, Bucket: u.Bucket, Object: c.Object})
+		}
+	}
+	return refs, nil
+}
+
+// DeleteObjectRefs delete the records whose object is missing in storage
+// versions of deleted files and other chunks of deleted uploads are also
+// deleted, return their objects which should be deleted from storage
+func DeleteObjectRefs(refs []ObjectRef) ([]models.StorageFile, error) {
+	store := &FileStore{DB: models.GetDB()}
+	objects := []models.StorageFile{}
+	for _, ref := range refs {
+		var err error
+		switch ref.Kind {
+		case ObjectRefFile:
+			file := &models.StorageFile{}
+			err = store.DB.Unscoped().Where("id = ?", ref.ID).First(file).Error
+			if err != nil {
+				break
+			}
+			if err = store.DB.Unscoped().Delete(file).Error; err != nil {
+				break
+			}
+			if file.Hash != "" {
+				store.releaseBlobReference(file.Hash)
+			}
+			versions := []models.FileVersion{}
+			err = store.DB.Where("file_id = ?", file.ID).Find(&versions).Error
+			if err == nil {
+				objects = append(objects, store.deleteFileVersions(file, versions)...)
+			}
+		case ObjectRefVersion:
+			version := &models.FileVersion{}
+			err = store.DB.Where("id = ?", ref.ID).First(version).Error
+			if err == gorm.ErrRecordNotFound {
+				// already deleted with its file
+				err = nil
+				break
+			}
+			if err == nil {
+				err = store.DB.Delete(version).Error
+			}
+			if err == nil && version.Hash != "" {
+				store.releaseBlobReference(version.Hash)
+			}
+		case ObjectRefBlob:
+			err = store.DB.Where("hash = ?", ref.ID).Delete(&models.Blob{}).Error
+		case ObjectRefUpload:
+			// upload can not be completed without any of its chunks
+			chunks := []models.UploadChunk{}
+			err = store.DB.Where("upload_id = ?", ref.ID).Find(&chunks).Error
+			if err == nil {
+				err = store.DB.Where("id = ?", ref.ID).Delete(&models.Upload{}).Error
+			}
+			if err == nil {
+				err = store.DB.Where("upload_id = ?", ref.ID).Delete(&models.UploadChunk{}).Error
+			}
+			if err == nil {
+				for _, c := range chunks {
+					if c.Object != ref.Object {
+						objects = append(objects, models.StorageFile{
+							RawStorageFileInfo: models.RawStorageFileInfo{Bucket: ref.Bucket, Path: c.Object},
+						})
+					}
+				}
+			}
+		}
+		if err != nil {
+			log.Errorf("delete %s %s fail: %s", ref.Kind, ref.ID, err)
+			return objects, &utils.ErrInternalServerError
+		}
+	}
+	return objects, nil
+}
+
+// FindOrphanFiles return the files and folders whose parent folder not exist
+// items in trash are not included because they are restored to top level
+func FindOrphanFiles() ([]models.StorageFile, error) {
+	files := []models.StorageFile{}
+	err := models.GetDB().Where(
+		"folder_id not in (?) and not exists ("+
+			"select 1 from storage_files p where p.id = storage_files.folder_id "+
+			"and p.user_id = storage_files.user_id and p.is_dir = ? and p.deleted_at is null)",
+		[]string{"root", ""},
+		true,
+	).Find(&files).Error
+	if err != nil {
+		log.Errorf("query orphan files fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	return files, nil
+}
+
+// TrashOrphanFiles move the files and folders without parent to trash
+// user can restore them to top level from trash
+func TrashOrphanFiles(files []models.StorageFile) error {
+	for _, f := range files {
+		if _, err := NewFileStore(f.UserID).TrashFiles(f.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UsageMismatch is the user whose recorded disk usage
+// is different from the size of all files and versions
+type UsageMismatch struct {
+	UserID   string `json:"user_id"`
+	Recorded uint64 `json:"recorded"`
+	Actual   uint64 `json:"actual"`
+}
+
+// FindUsageMismatches return the users whose disk usage is not correct
+// files in trash and old versions are counted in the usage of owner,
+// profiles of users already deleted are ignored
+func FindUsageMismatches() ([]UsageMismatch, error) {
+	db := models.GetDB()
+	actual := map[string]uint64{}
+	queries := []string{
+		"select user_id, sum(file_size) from storage_files where is_dir = ? group by user_id",
+		"select f.user_id, sum(v.file_size) from file_versions v join storage_files f on f.id = v.file_id where f.is_dir = ? group by f.user_id",
+	}
+	for _, query := range queries {
+		rows, err := db.Raw(query, false).Rows()
+		if err != nil {
+			log.Errorf("query disk usage fail: %s", err)
+			return nil, &utils.ErrInternalServerError
+		}
+		for rows.Next() {
+			var userID string
+			var size int64
+			if err := rows.Scan(&userID, &size); err != nil {
+				rows.Close()
+				log.Errorf("scan disk usage fail: %s", err)
+				return nil, &utils.ErrInternalServerError
+			}
+			actual[userID] += uint64(size)
+		}
+		rows.Close()
+	}
+	profiles := []models.Profile{}
+	err := db.Where("user_id in (?)", db.Unscoped().Model(&models.User{}).Select("id").QueryExpr()).Find(&profiles).Error
+	if err != nil {
+		log.Errorf("query profiles fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	mismatches := []UsageMismatch{}
+	for _, p := range profiles {
+		if p.UsageDiskSize != actual[p.UserID] {
+			mismatches = append(mismatches, UsageMismatch{
+				UserID:   p.UserID,
+				Recorded: p.UsageDiskSize,
+				Actual:   actual[p.UserID],
+			})
+		}
+	}
+	return mismatches, nil
+}
+
+// FixDiskUsage save the actual size as the disk usage of user
+func FixDiskUsage(mismatch UsageMismatch) error {
+	err := models.GetDB().Model(&models.Profile{}).Where("user_id = ?", mismatch.UserID).UpdateColumn(
+		"usage_disk_size", mismatch.Actual,
+	).Error
+	if err != nil {
+		log.Errorf("update disk usage of %s fail: %s", mismatch.UserID, err)
+		return &utils.ErrInternalServerError
+	}
+	return nil
+}
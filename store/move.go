@@ -0,0 +1,171 @@
+package store
+
+import (
+	"time"
+
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/utils"
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+)
+
+// getSubTree return the files and all their sub files level by level
+// parent folders are always before their sub files
+func (store *FileStore) getSubTree(files []models.StorageFile) ([]models.StorageFile, error) {
+	parents := []string{}
+	for _, f := range files {
+		if f.IsDir {
+			parents = append(parents, f.ID)
+		}
+	}
+	for len(parents) > 0 {
+		children := []models.StorageFile{}
+		err := store.DB.Where("user_id = ? and folder_id in (?)", store.userID, parents).Find(&children).Error
+		if err != nil {
+			log.Errorf("query sub files fail: %s", err)
+			return nil, &utils.ErrInternalServerError
+		}
+		parents = []string{}
+		for _, f := range children {
+			if f.IsDir {
+				parents = append(parents, f.ID)
+			}
+		}
+		files = append(files, children...)
+	}
+	return files, nil
+}
+
+// checkTargetFolder check the file can be put into the target folder
+// target folder must not be the file itself or its sub folder,
+// and no file with same name exist in the target folder
+func (store *FileStore) checkTargetFolder(file *models.StorageFile, targetID string) error {
+	// walk up from target folder to top level for find cycles
+	for folderID := targetID; folderID != "root" && folderID != ""; {
+		if folderID == file.ID {
+			return &utils.ErrPostDataNotCorrect
+		}
+		folder, err := store.getStorageFile(folderID)
+		if err != nil {
+			return err
+		}
+		if folder.IsDir == false {
+			return &utils.ErrPostDataNotCorrect
+		}
+		folderID = folder.FolderID
+	}
+	if store.StorageFileExistUnderFolderID(targetID, file.FileName) {
+		return &utils.ErrResourceAlreadyExist
+	}
+	return nil
+}
+
+// MoveFile move the file or folder with id into target folder
+// target folder is "root" for the top level
+func (store *FileStore) MoveFile(id, targetID string) (*models.StorageFile, error) {
+	file, err := store.getStorageFile(id)
+	if err != nil {
+		return nil, err
+	}
+	if file.FolderID == targetID {
+		return file, nil
+	}
+	if err := store.checkTargetFolder(file, targetID); err != nil {
+		return nil, err
+	}
+	err = store.DB.Model(file).UpdateColumns(map[string]interface{}{
+		"folder_id":  targetID,
+		"updated_at": time.Now(),
+	}).Error
+	if models.IsUniqueViolation(err) {
+		return nil, &utils.ErrResourceAlreadyExist
+	}
+	if err != nil {
+		log.Errorf("move file fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	return file, nil
+}
+
+// CopyFile deep copy the file or folder and all its sub files into target folder
+// contents with hash are shared by adding blob reference, contents of old files
+// without hash are copied in storage with copyObject, return the new file and
+// the copied objects which should be deleted from storage when copy fail
+func (store *FileStore) CopyFile(id, targetID string, copyObject func(src, dst *models.StorageFile) error) (*models.StorageFile, []models.StorageFile, error) {
+	file, err := store.getStorageFile(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := store.checkTargetFolder(file, targetID); err != nil {
+		return nil, nil, err
+	}
+	files, err := store.getSubTree([]models.StorageFile{*file})
+	if err != nil {
+		return nil, nil, err
+	}
+	var size int64
+	for _, f := range files {
+		size += f.FileSize
+	}
+	if err := store.CheckDiskQuota(size); err != nil {
+		return nil, nil, err
+	}
+	// new folder id of each copied folder
+	folderIDs := map[string]string{file.FolderID: targetID}
+	copies := []models.StorageFile{}
+	copied := []models.StorageFile{}
+	for i := range files {
+		src := &files[i]
+		dst := models.StorageFile{
+			RawStorageFileInfo: src.RawStorageFileInfo,
+			UserID:             src.UserID,
+		}
+		if src.IsDir {
+			dst.ID = utils.GenRandomID("folder", 15)
+			folderIDs[src.ID] = dst.ID
+		} else {
+			dst.ID = utils.GenRandomID("file", 15)
+		}
+		dst.FolderID = folderIDs[src.FolderID]
+		if src.IsDir == false && src.Hash == "" {
+			dst.Path = dst.ID
+			if err := copyObject(src, &dst); err != nil {
+				log.Errorf("copy object %s fail: %s", src.ObjectName(), err)
+				return nil, copied, &utils.ErrInternalServerError
+			}
+			copied = append(copied, dst)
+		}
+		copies = append(copies, dst)
+	}
+	tx := store.DB.Begin()
+	for i := range copies {
+		err = tx.Create(&copies[i]).Error
+		if err == nil && copies[i].Hash != "" {
+			err = tx.Model(&models.Blob{}).Where("hash = ?", copies[i].Hash).UpdateColumn(
+				"ref_count", gorm.Expr("ref_count + 1"),
+			).Error
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = store.reserveDiskUsage(tx, store.userID, size)
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if models.IsUniqueViolation(err) {
+		err = &utils.ErrResourceAlreadyExist
+	}
+	if err != nil {
+		if customErr, ok := err.(*utils.CustomError); ok {
+			return nil, copied, customErr
+		}
+		log.Errorf("copy files fail: %s", err)
+		return nil, copied, &utils.ErrInternalServerError
+	}
+	return &copies[0], nil, nil
+}
@@ -0,0 +1,238 @@
+package store
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/utils"
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+)
+
+// SharedFile is a file or folder shared with user by others
+type SharedFile struct {
+	Role       string              `json:"role"`
+	OwnerID    string              `json:"owner_id"`
+	OwnerEmail string              `json:"owner_email"`
+	SharedAt   time.Time           `json:"shared_at"`
+	File       *models.StorageFile `json:"file"`
+}
+
+// granteeQuery return the query of permissions granted to user directly or by groups
+func (store *FileStore) granteeQuery() *gorm.DB {
+	groups := store.DB.Table("group_members").Select("group_id").Where("user_id = ?", store.userID).QueryExpr()
+	return store.DB.Where(
+		"(grantee_type = ? and grantee_id = ?) or (grantee_type = ? and grantee_id in (?))",
+		models.GranteeUser, store.userID, models.GranteeGroup, groups,
+	)
+}
+
+// GetFileWithPermission return the file or folder with id when user has role on it
+// files of user are always returned, files of others need the role granted on
+// the file or one of its parent folders, use the store of file owner for change it
+func (store *FileStore) GetFileWithPermission(id, role string) (*models.StorageFile, error) {
+	file := &models.StorageFile{}
+	err := store.DB.Where("id = ?", id).First(file).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, &utils.ErrResourceNotFound
+		}
+		log.Errorf("query file fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	if file.UserID == store.userID {
+		return file, nil
+	}
+	granted, err := store.getGrantedRole(file)
+	if err != nil {
+		return nil, err
+	}
+	// files not shared with user are not visible
+	if granted == "" {
+		return nil, &utils.ErrResourceNotFound
+	}
+	if models.PermissionLevel(granted) < models.PermissionLevel(role) {
+		return nil, &utils.ErrForbidden
+	}
+	return file, nil
+}
+
+// getGrantedRole return the highest role granted to user on file and its
+// parent folders, empty if nothing is granted
+func (store *FileStore) getGrantedRole(file *models.StorageFile) (string, error) {
+	ids := []string{file.ID}
+	for folderID := file.FolderID; folderID != "root" && folderID != ""; {
+		folder := &models.StorageFile{}
+		err := store.DB.Where("id = ? and user_id = ?", folderID, file.UserID).First(folder).Error
+		if err == gorm.ErrRecordNotFound {
+			break
+		}
+		if err != nil {
+			log.Errorf("query parent folder fail: %s", err)
+			return "", &utils.ErrInternalServerError
+		}
+		ids = append(ids, folder.ID)
+		folderID = folder.FolderID
+	}
+	permissions := []models.FilePermission{}
+	err := store.granteeQuery().Where("file_id in (?) and owner_id = ?", ids, file.UserID).Find(&permissions).Error
+	if err != nil {
+		log.Errorf("query file permissions fail: %s", err)
+		return "", &utils.ErrInternalServerError
+	}
+	role := ""
+	for _, permission := range permissions {
+		if models.PermissionLevel(permission.Role) > models.PermissionLevel(role) {
+			role = permission.Role
+		}
+	}
+	return role, nil
+}
+
+// GetFilePermissions return the permissions granted on file directly
+func (store *FileStore) GetFilePermissions(file *models.StorageFile) ([]models.FilePermission, error) {
+	permissions := []models.FilePermission{}
+	err := store.DB.Where("file_id = ?", file.ID).Order("created_at").Find(&permissions).Error
+	if err != nil {
+		log.Errorf("query file permissions fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	for i := range permissions {
+		store.fillGranteeName(&permissions[i])
+	}
+	return permissions, nil
+}
+
+// fillGranteeName set the email of user or name of group granted
+func (store *FileStore) fillGranteeName(permission *models.FilePermission) {
+	var err error
+	if permission.GranteeType == models.GranteeGroup {
+		group := &models.Group{}
+		err = store.DB.Where("id = ?", permission.GranteeID).First(group).Error
+		permission.GranteeName = group.Name
+	} else {
+		account := &models.User{}
+		err = store.DB.Where("id = ?", permission.GranteeID).First(account).Error
+		permission.GranteeName = account.Email
+	}
+	if err != nil && err != gorm.ErrRecordNotFound {
+		log.Errorf("query grantee of permission fail: %s", err)
+	}
+}
+
+// GrantFilePermission grant role on file to the user with email or the group with id
+// role is changed when the user or group already has permission on file,
+// only groups which user is a member of can be granted
+func (store *FileStore) GrantFilePermission(file *models.StorageFile, email, groupID, role string) (*models.FilePermission, error) {
+	email = strings.TrimSpace(email)
+	if models.PermissionLevel(role) == 0 || (email == "") == (groupID == "") {
+		return nil, &utils.ErrPostDataNotCorrect
+	}
+	permission := &models.FilePermission{
+		FileID:      file.ID,
+		OwnerID:     file.UserID,
+		GranteeType: models.GranteeGroup,
+		GranteeID:   groupID,
+	}
+	if email != "" {
+		account, customErr := models.GetUserWithEmail(email)
+		if customErr != nil {
+			return nil, customErr
+		}
+		// owner has all rights and user can not change its own role
+		if account.ID == file.UserID || account.ID == store.userID {
+			return nil, &utils.ErrPostDataNotCorrect
+		}
+		permission.GranteeType = models.GranteeUser
+		permission.GranteeID = account.ID
+	} else if _, err := models.GetGroup(store.userID, groupID); err != nil {
+		return nil, err
+	}
+	err := store.DB.Where(
+		"file_id = ? and grantee_type = ? and grantee_id = ?",
+		file.ID, permission.GranteeType, permission.GranteeID,
+	).First(permission).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		log.Errorf("query file permission fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	if err == gorm.ErrRecordNotFound {
+		permission.ID = utils.GenRandomID("permission", 15)
+		permission.Role = role
+		permission.GrantedBy = store.userID
+		err = store.DB.Create(permission).Error
+	} else {
+		err = store.DB.Model(permission).Updates(map[string]interface{}{
+			"role":       role,
+			"granted_by": store.userID,
+		}).Error
+	}
+	if err != nil {
+		log.Errorf("save file permission fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	store.fillGranteeName(permission)
+	return permission, nil
+}
+
+// RevokeFilePermission delete the permission with id from file
+func (store *FileStore) RevokeFilePermission(file *models.StorageFile, id string) error {
+	result := store.DB.Where("id = ? and file_id = ?", id, file.ID).Delete(&models.FilePermission{})
+	if result.Error != nil {
+		log.Errorf("delete file permission fail: %s", result.Error)
+		return &utils.ErrInternalServerError
+	}
+	if result.RowsAffected == 0 {
+		return &utils.ErrResourceNotFound
+	}
+	return nil
+}
+
+// GetSharedWithMe return the files and folders shared with user by others, newest first
+// file shared both directly and by groups is returned once with the highest role
+func (store *FileStore) GetSharedWithMe() ([]SharedFile, error) {
+	permissions := []models.FilePermission{}
+	err := store.granteeQuery().Where("owner_id <> ?", store.userID).Order("created_at desc").Find(&permissions).Error
+	if err != nil {
+		log.Errorf("query file permissions fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	sharedFiles := []SharedFile{}
+	index := map[string]int{}
+	owners := map[string]string{}
+	for _, permission := range permissions {
+		if i, ok := index[permission.FileID]; ok {
+			if models.PermissionLevel(permission.Role) > models.PermissionLevel(sharedFiles[i].Role) {
+				sharedFiles[i].Role = permission.Role
+			}
+			continue
+		}
+		file := &models.StorageFile{}
+		err := store.DB.Where("id = ? and user_id = ?", permission.FileID, permission.OwnerID).First(file).Error
+		if err == gorm.ErrRecordNotFound {
+			// file is in trash of owner
+			continue
+		}
+		if err != nil {
+			log.Errorf("query shared file fail: %s", err)
+			return nil, &utils.ErrInternalServerError
+		}
+		if _, ok := owners[file.UserID]; !ok {
+			account := &models.User{}
+			if err := store.DB.Where("id = ?", file.UserID).First(account).Error; err != nil {
+				log.Errorf("query owner of shared file fail: %s", err)
+			}
+			owners[file.UserID] = account.Email
+		}
+		index[file.ID] = len(sharedFiles)
+		sharedFiles = append(sharedFiles, SharedFile{
+			Role:       permission.Role,
+			OwnerID:    file.UserID,
+			OwnerEmail: owners[file.UserID],
+			SharedAt:   permission.CreatedAt,
+			File:       file,
+		})
+	}
+	return sharedFiles, nil
+}
@@ -2,6 +2,7 @@ package store
 
 import (
 	"encoding/base64"
+	"net/http"
 	"time"
 
 	"github.com/jinzhu/gorm"
@@ -11,6 +12,7 @@ import (
 	"github.com/Dudobird/dudo-server/utils"
 	jwt "github.com/dgrijalva/jwt-go"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type fileToken struct {
@@ -21,10 +23,24 @@ type fileToken struct {
 }
 
 // CreateShareToken create a new share file token
-func (store *FileStore) CreateShareToken(fileID string, days int, description string) (string, error) {
-	exist := store.StorageFileExistCheck(fileID)
-	if exist != true {
-		return "", &utils.ErrResourceNotFound
+// share is protected by password when password is not empty
+// and can be downloaded maxDownloads times when it is not 0
+func (store *FileStore) CreateShareToken(fileID string, days int, description string, password string, maxDownloads int) (string, error) {
+	if maxDownloads < 0 {
+		return "", &utils.ErrPostDataNotCorrect
+	}
+	// only files of user can be shared
+	if _, err := store.getStorageFile(fileID); err != nil {
+		return "", err
+	}
+	passwordHash := ""
+	if password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			log.Errorf("hash share password fail : %s", err)
+			return "", &utils.ErrInternalServerError
+		}
+		passwordHash = string(hash)
 	}
 	tokenSecret := config.GetConfig().Application.Token
 	id := utils.GenRandomID("share", 10)
@@ -45,6 +61,9 @@ func (store *FileStore) CreateShareToken(fileID string, days int, description st
 		Expire:      time.Now().AddDate(0, 0, days),
 		Description: description,
 		UserID:      store.userID,
+
+		PasswordHash: passwordHash,
+		MaxDownloads: maxDownloads,
 	}
 	err := store.DB.Save(shareFile).Error
 	if err != nil {
@@ -69,14 +88,14 @@ func (store *FileStore) ShareFileExistCheck(shareID string) bool {
 	return false
 }
 
-// VerifyShareToken check token and return file id if success
-func (store *FileStore) VerifyShareToken(token string) (string, string, error) {
+// VerifyShareToken check token and return the share if success
+func (store *FileStore) VerifyShareToken(token string) (*models.ShareFiles, error) {
 	if token == "" {
-		return "", "", &utils.ErrTokenIsNotValid
+		return nil, &utils.ErrTokenIsNotValid
 	}
 	pathDecodeBase64, err := base64.StdEncoding.DecodeString(token)
 	if err != nil {
-		return "", "", &utils.ErrPostDataNotCorrect
+		return nil, &utils.ErrPostDataNotCorrect
 	}
 
 	tokenSecret := config.GetConfig().Application.Token
@@ -86,15 +105,97 @@ func (store *FileStore) VerifyShareToken(token string) (string, string, error) {
 		return []byte(tokenSecret), nil
 	})
 
-	if err != nil && !parseToken.Valid {
-		return "", "", &utils.ErrTokenIsNotValid
+	if err != nil || !parseToken.Valid {
+		return nil, &utils.ErrTokenIsNotValid
 	}
 	// check shareid exist or not
-	if exist := store.ShareFileExistCheck(fileTokenObject.ShareID); exist == true {
-		return fileTokenObject.FileID, fileTokenObject.UserID, nil
+	share := &models.ShareFiles{}
+	err = store.DB.Where("id = ?", fileTokenObject.ShareID).First(share).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, &utils.ErrResourceNotFound
+		}
+		log.Errorf("query share file fail : %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	return share, nil
+}
+
+// UnlockShare check the password of share and return a short lived unlock token
+// share is locked for a while after too many wrong attempts
+func (store *FileStore) UnlockShare(share *models.ShareFiles, password string) (string, error) {
+	return store.unlock(&models.ShareFiles{}, share.ID, share.PasswordHash, password)
+}
+
+// VerifyShareUnlockToken return true if token is issued for share by UnlockShare
+func (store *FileStore) VerifyShareUnlockToken(share *models.ShareFiles, token string) bool {
+	return verifyUnlockToken(share.ID, share.PasswordHash, token)
+}
+
+// AcquireShareDownload count a download of share
+// it fail when the download limit of share is reached
+func (store *FileStore) AcquireShareDownload(share *models.ShareFiles) error {
+	result := store.DB.Model(&models.ShareFiles{}).Where(
+		"id = ? and (max_downloads = 0 or download_count < max_downloads)", share.ID,
+	).UpdateColumn("download_count", gorm.Expr("download_count + 1"))
+	if result.Error != nil {
+		log.Errorf("update share download count fail : %s", result.Error)
+		return &utils.ErrInternalServerError
+	}
+	if result.RowsAffected == 0 {
+		return &utils.ErrShareDownloadLimit
+	}
+	return nil
+}
+
+// ReleaseShareDownload give back the download of share when download fail
+func (store *FileStore) ReleaseShareDownload(share *models.ShareFiles) {
+	err := store.DB.Model(&models.ShareFiles{}).Where(
+		"id = ? and download_count > 0", share.ID,
+	).UpdateColumn("download_count", gorm.Expr("download_count - 1")).Error
+	if err != nil {
+		log.Errorf("update share download count fail : %s", err)
 	}
-	return "", "", &utils.ErrResourceNotFound
+}
 
+// RecordShareAccess save the access log of share file
+func (store *FileStore) RecordShareAccess(share *models.ShareFiles, fileID, ip, userAgent string, status int, bytesServed int64) {
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	err := store.DB.Create(&models.ShareAccessLog{
+		ID:          utils.GenRandomID("access", 15),
+		ShareID:     share.ID,
+		FileID:      fileID,
+		IP:          ip,
+		UserAgent:   userAgent,
+		Status:      status,
+		BytesServed: bytesServed,
+		Success:     status < http.StatusBadRequest,
+	}).Error
+	if err != nil {
+		log.Errorf("save share access log fail : %s", err)
+	}
+}
+
+// GetShareAccessLogs return the access logs of share, newest first
+func (store *FileStore) GetShareAccessLogs(shareID string) ([]models.ShareAccessLog, error) {
+	share := &models.ShareFiles{}
+	err := store.DB.Where("id = ? and user_id = ?", shareID, store.userID).First(share).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, &utils.ErrResourceNotFound
+		}
+		log.Errorf("query share file fail : %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	logs := []models.ShareAccessLog{}
+	err = store.DB.Where("share_id = ?", shareID).Order("created_at desc").Find(&logs).Error
+	if err != nil {
+		log.Errorf("query share access logs fail : %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	return logs, nil
 }
 
 // GetAllSharedFiles get all shared files
@@ -109,12 +210,18 @@ func (store *FileStore) GetAllSharedFiles() ([]models.ShareFiles, error) {
 
 // DeleteShareFilesRef delete share file with id
 func (store *FileStore) DeleteShareFilesRef(id string) error {
-	err := store.DB.Unscoped().Where("id = ? and user_id = ?", id, store.userID).Delete(&models.ShareFiles{}).Error
-	if err != nil {
-		if err == gorm.ErrRecordNotFound {
+	result := store.DB.Unscoped().Where("id = ? and user_id = ?", id, store.userID).Delete(&models.ShareFiles{})
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
 			return &utils.ErrResourceNotFound
 		}
 		return &utils.ErrInternalServerError
 	}
+	if result.RowsAffected > 0 {
+		err := store.DB.Where("share_id = ?", id).Delete(&models.ShareAccessLog{}).Error
+		if err != nil {
+			log.Errorf("delete share access logs fail : %s", err)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,81 @@
+package store
+
+import (
+	"strings"
+
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetSharedFile return the file of share with id or path and its path relative to shared root
+// file with id must be the shared root or under it, path is the names of
+// folders and file from shared root split by "/", the shared root is returned if both are empty
+// store must be created with the user id of share owner
+func (store *FileStore) GetSharedFile(share *models.ShareFiles, id, path string) (*models.StorageFile, string, error) {
+	if store.userID != share.UserID {
+		return nil, "", &utils.ErrResourceNotFound
+	}
+	root, err := store.getStorageFile(share.FileID)
+	if err != nil {
+		return nil, "", err
+	}
+	if id != "" {
+		return store.getSharedFileWithID(root, id)
+	}
+	file := root
+	names := []string{}
+	for _, name := range strings.Split(path, "/") {
+		if name == "" {
+			continue
+		}
+		if name == "." || name == ".." || file.IsDir == false {
+			return nil, "", &utils.ErrResourceNotFound
+		}
+		file, err = store.GetStorageFileUnderFolderID(file.ID, name)
+		if err != nil {
+			return nil, "", err
+		}
+		names = append(names, name)
+	}
+	return file, "/" + strings.Join(names, "/"), nil
+}
+
+// getSharedFileWithID walk up from the file to the shared root,
+// file not under shared root is reported as not found
+func (store *FileStore) getSharedFileWithID(root *models.StorageFile, id string) (*models.StorageFile, string, error) {
+	if id == root.ID {
+		return root, "/", nil
+	}
+	file, err := store.getStorageFile(id)
+	if err != nil {
+		return nil, "", err
+	}
+	names := []string{file.FileName}
+	for folderID := file.FolderID; folderID != root.ID; {
+		if folderID == "root" || folderID == "" {
+			return nil, "", &utils.ErrResourceNotFound
+		}
+		folder, err := store.getStorageFile(folderID)
+		if err != nil {
+			return nil, "", err
+		}
+		names = append([]string{folder.FileName}, names...)
+		folderID = folder.FolderID
+	}
+	return file, "/" + strings.Join(names, "/"), nil
+}
+
+// ListSharedFolder return the files under folder of share
+func (store *FileStore) ListSharedFolder(folder *models.StorageFile) ([]models.StorageFile, error) {
+	if folder.IsDir == false {
+		return nil, &utils.ErrPostDataNotCorrect
+	}
+	files := []models.StorageFile{}
+	err := store.DB.Where("user_id = ? and folder_id = ?", store.userID, folder.ID).Order("is_dir desc, file_name").Find(&files).Error
+	if err != nil {
+		log.Errorf("query shared folder files fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	return files, nil
+}
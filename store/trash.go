@@ -0,0 +1,189 @@
+package store
+
+import (
+	"time"
+
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/utils"
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+)
+
+// TrashFiles move the file or folder and all its sub files to trash
+// return the files moved to trash
+func (store *FileStore) TrashFiles(id string) ([]models.StorageFile, error) {
+	files := []models.StorageFile{}
+	err := store.DB.Where("id = ? and user_id = ?", id, store.userID).Find(&files).Error
+	if err != nil {
+		log.Errorf("query file fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	if len(files) == 0 {
+		return files, nil
+	}
+	files, err = store.getSubTree(files)
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, f := range files {
+		ids = append(ids, f.ID)
+	}
+	err = store.DB.Model(&models.StorageFile{}).Where("id in (?)", ids).UpdateColumns(map[string]interface{}{
+		"deleted_at": time.Now(),
+		"trash_id":   id,
+	}).Error
+	if err != nil {
+		log.Errorf("move files to trash fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	return files, nil
+}
+
+// ListTrash return the items deleted by user
+// sub files of deleted folder are not included
+func (store *FileStore) ListTrash() ([]models.StorageFile, error) {
+	files := []models.StorageFile{}
+	err := store.DB.Unscoped().Where(
+		"user_id = ? and deleted_at is not null and id = trash_id",
+		store.userID,
+	).Order("deleted_at desc").Find(&files).Error
+	if err != nil {
+		log.Errorf("query trash fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	return files, nil
+}
+
+// RestoreTrash restore the item and its sub files from trash
+// it will be restored to root folder when the original folder not exist
+func (store *FileStore) RestoreTrash(id string) (*models.StorageFile, error) {
+	file := &models.StorageFile{}
+	err := store.DB.Unscoped().Where(
+		"id = ? and user_id = ? and trash_id = ? and deleted_at is not null",
+		id, store.userID, id,
+	).First(file).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, &utils.ErrResourceNotFound
+		}
+		log.Errorf("query trash fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	if file.FolderID != "root" && store.StorageFileExistCheck(file.FolderID) == false {
+		file.FolderID = "root"
+	}
+	if store.StorageFileExistUnderFolderID(file.FolderID, file.FileName) {
+		return nil, &utils.ErrResourceAlreadyExist
+	}
+	tx := store.DB.Begin()
+	err = tx.Model(&models.StorageFile{}).Unscoped().Where("user_id = ? and trash_id = ?", store.userID, id).UpdateColumns(map[string]interface{}{
+		"deleted_at": gorm.Expr("NULL"),
+		"trash_id":   "",
+	}).Error
+	if err == nil {
+		err = tx.Model(&models.StorageFile{}).Where("id = ?", id).UpdateColumn("folder_id", file.FolderID).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		if models.IsUniqueViolation(err) {
+			return nil, &utils.ErrResourceAlreadyExist
+		}
+		log.Errorf("restore trash fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	if err := tx.Commit().Error; err != nil {
+		log.Errorf("restore trash fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	file.DeletedAt = nil
+	file.TrashID = ""
+	return file, nil
+}
+
+// EmptyTrash delete all items in trash of user permanently
+// return the files which object should be deleted from storage
+func (store *FileStore) EmptyTrash() ([]models.StorageFile, error) {
+	return store.purgeTrash(store.DB.Unscoped().Where("user_id = ? and trash_id <> ''", store.userID))
+}
+
+// PurgeTrash delete the items moved to trash before time for all users
+// return the files which object should be deleted from storage
+func PurgeTrash(before time.Time) ([]models.StorageFile, error) {
+	store := &FileStore{DB: models.GetDB()}
+	return store.purgeTrash(store.DB.Unscoped().Where("trash_id <> '' and deleted_at < ?", before))
+}
+
+// purgeTrash delete the files from database and release its content
+// file content still referenced by other files is not returned
+func (store *FileStore) purgeTrash(query *gorm.DB) ([]models.StorageFile, error) {
+	files := []models.StorageFile{}
+	err := query.Find(&files).Error
+	if err != nil {
+		log.Errorf("query trash fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	deleteFiles := []models.StorageFile{}
+	for _, f := range files {
+		deleted, err := store.deleteWithUsage(&f, f.UserID, f.FileSize)
+		if err != nil {
+			log.Errorf("delete file %s fail: %s", f.ID, err)
+			continue
+		}
+		if deleted {
+			if err := store.DB.Where("file_id = ?", f.ID).Delete(&models.FilePermission{}).Error; err != nil {
+				log.Errorf("delete permissions of file %s fail: %s", f.ID, err)
+			}
+		}
+		if f.IsDir == true || deleted == false {
+			continue
+		}
+		if store.isLastReference(f.Hash) {
+			deleteFiles = append(deleteFiles, f)
+		}
+		versions := []models.FileVersion{}
+		err = store.DB.Where("file_id = ?", f.ID).Find(&versions).Error
+		if err != nil {
+			log.Errorf("query file versions fail: %s", err)
+			continue
+		}
+		deleteFiles = append(deleteFiles, store.deleteFileVersions(&f, versions)...)
+	}
+	return deleteFiles, nil
+}
+
+// deleteWithUsage delete the record permanently and release its size
+// from the disk usage of user in one transaction
+// return false if the record is already deleted by others
+func (store *FileStore) deleteWithUsage(value interface{}, userID string, size int64) (bool, error) {
+	tx := store.DB.Begin()
+	result := tx.Unscoped().Delete(value)
+	err := result.Error
+	if err == nil && result.RowsAffected > 0 {
+		err = store.addDiskUsage(tx, userID, -size)
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// isLastReference release the blob of deleted content
+// and return true if no other file use the same object
+// content without hash is not shared and always return true
+func (store *FileStore) isLastReference(hash string) bool {
+	if hash == "" {
+		return true
+	}
+	last, err := store.releaseBlobReference(hash)
+	if err != nil {
+		log.Errorf("release blob %s fail: %s", hash, err)
+		return false
+	}
+	return last
+}
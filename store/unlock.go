@@ -0,0 +1,106 @@
+package store
+
+import (
+	"time"
+
+	"github.com/Dudobird/dudo-server/config"
+	"github.com/Dudobird/dudo-server/utils"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// unlockAttempts is wrong password attempts allowed before the link is locked
+	unlockAttempts = 5
+	lockDuration   = 15 * time.Minute
+	// UnlockLifetime is how long the link can be used after unlock
+	UnlockLifetime = 10 * time.Minute
+)
+
+type unlockToken struct {
+	ID string
+	jwt.StandardClaims
+}
+
+// unlock check the password of a password protected link and return a short lived unlock token
+// model is the type of link which has failed_attempts and locked_until columns,
+// link is locked for a while after too many wrong attempts
+func (store *FileStore) unlock(model interface{}, id, passwordHash, password string) (string, error) {
+	now := time.Now()
+	// each attempt is counted before the password is checked,
+	// so parallel attempts can not pass the lock together
+	result := store.DB.Model(model).Where(
+		"id = ? and failed_attempts < ? and (locked_until is null or locked_until < ?)", id, unlockAttempts, now,
+	).UpdateColumn("failed_attempts", gorm.Expr("failed_attempts + 1"))
+	if result.Error != nil {
+		log.Errorf("update failed attempts fail : %s", result.Error)
+		return "", &utils.ErrInternalServerError
+	}
+	if result.RowsAffected == 0 {
+		return "", &utils.ErrShareTooManyAttempts
+	}
+	if bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)) != nil {
+		return "", store.unlockFail(model, id)
+	}
+	err := store.DB.Model(model).Where("id = ?", id).UpdateColumn("failed_attempts", 0).Error
+	if err != nil {
+		log.Errorf("reset failed attempts fail : %s", err)
+	}
+	token := jwt.NewWithClaims(
+		jwt.GetSigningMethod("HS256"),
+		&unlockToken{
+			ID: id,
+			StandardClaims: jwt.StandardClaims{
+				ExpiresAt: now.Add(UnlockLifetime).Unix(),
+			},
+		},
+	)
+	t, err := token.SignedString(unlockSecret(passwordHash))
+	if err != nil {
+		log.Errorf("create unlock token fail : %s", err)
+		return "", &utils.ErrInternalServerError
+	}
+	return t, nil
+}
+
+// unlockFail lock the link when the wrong password attempt counted by unlock is the last allowed
+func (store *FileStore) unlockFail(model interface{}, id string) error {
+	attempts := 0
+	err := store.DB.Model(model).Where("id = ?", id).Select("failed_attempts").Row().Scan(&attempts)
+	if err != nil {
+		log.Errorf("update failed attempts fail : %s", err)
+		return &utils.ErrInternalServerError
+	}
+	if attempts < unlockAttempts {
+		return &utils.ErrSharePasswordNotCorrect
+	}
+	lockedUntil := time.Now().Add(lockDuration)
+	err = store.DB.Model(model).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+		"failed_attempts": 0,
+		"locked_until":    &lockedUntil,
+	}).Error
+	if err != nil {
+		log.Errorf("lock %s fail : %s", id, err)
+	}
+	log.Warnf("%s is locked for too many wrong password attempts", id)
+	return &utils.ErrShareTooManyAttempts
+}
+
+// verifyUnlockToken return true if token is issued for the link by unlock
+func verifyUnlockToken(id, passwordHash, token string) bool {
+	claims := &unlockToken{}
+	parseToken, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, &utils.ErrTokenIsNotValid
+		}
+		return unlockSecret(passwordHash), nil
+	})
+	return err == nil && parseToken.Valid && claims.ID == id
+}
+
+// unlockSecret bind unlock token to the password of link
+func unlockSecret(passwordHash string) []byte {
+	return []byte(config.GetConfig().Application.Token + passwordHash)
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/utils"
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+)
+
+// CreateUpload save a new resumable upload state
+// ownerID is the user who will own the file, it is the owner of shared folder
+func (store *FileStore) CreateUpload(ownerID, folderID, fileName, bucket string, length int64) (*models.Upload, error) {
+	upload := &models.Upload{
+		ID:           utils.GenRandomID("upload", 15),
+		UserID:       store.userID,
+		OwnerID:      ownerID,
+		FolderID:     folderID,
+		FileName:     fileName,
+		Bucket:       bucket,
+		UploadLength: length,
+	}
+	err := store.DB.Create(upload).Error
+	if err != nil {
+		log.Errorf("create upload fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	return upload, nil
+}
+
+// GetUpload return the upload state with id
+func (store *FileStore) GetUpload(id string) (*models.Upload, error) {
+	upload := &models.Upload{}
+	err := store.DB.Where("id = ? and user_id = ?", id, store.userID).First(upload).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, &utils.ErrResourceNotFound
+		}
+		return nil, &utils.ErrInternalServerError
+	}
+	return upload, nil
+}
+
+// AddUploadChunk move the upload offset after a new chunk saved as object
+// it will fail when offset already changed by other request
+func (store *FileStore) AddUploadChunk(upload *models.Upload, object string, size int64) error {
+	tx := store.DB.Begin()
+	result := tx.Model(&models.Upload{}).Where(
+		"id = ? and upload_offset = ?",
+		upload.ID,
+		upload.UploadOffset,
+	).Updates(map[string]interface{}{
+		"upload_offset": upload.UploadOffset + size,
+		"chunks":        upload.Chunks + 1,
+	})
+	err := result.Error
+	if err == nil && result.RowsAffected == 0 {
+		tx.Rollback()
+		return &utils.ErrUploadOffsetConflict
+	}
+	if err == nil {
+		err = tx.Create(&models.UploadChunk{
+			ID:         utils.GenRandomID("chunk", 15),
+			UploadID:   upload.ID,
+			ChunkIndex: upload.Chunks,
+			Object:     object,
+		}).Error
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		log.Errorf("update upload offset fail: %s", err)
+		return &utils.ErrInternalServerError
+	}
+	upload.UploadOffset += size
+	upload.Chunks++
+	return nil
+}
+
+// GetUploadChunks return the received chunks of upload in order
+func (store *FileStore) GetUploadChunks(upload *models.Upload) ([]models.UploadChunk, error) {
+	chunks := []models.UploadChunk{}
+	err := store.DB.Where("upload_id = ?", upload.ID).Order("chunk_index").Find(&chunks).Error
+	if err != nil {
+		log.Errorf("query upload chunks fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	return chunks, nil
+}
+
+// CompleteUpload save the storage file id of the upload
+// chunks are already merged to the file
+func (store *FileStore) CompleteUpload(upload *models.Upload, fileID string) error {
+	err := store.DB.Model(upload).Update("file_id", fileID).Error
+	if err == nil {
+		err = store.DB.Where("upload_id = ?", upload.ID).Delete(&models.UploadChunk{}).Error
+	}
+	if err != nil {
+		log.Errorf("complete upload fail: %s", err)
+		return &utils.ErrInternalServerError
+	}
+	return nil
+}
+
+// DeleteUpload delete the upload state with id
+func (store *FileStore) DeleteUpload(id string) error {
+	result := store.DB.Where("id = ? and user_id = ?", id, store.userID).Delete(&models.Upload{})
+	err := result.Error
+	if err == nil && result.RowsAffected > 0 {
+		err = store.DB.Where("upload_id = ?", id).Delete(&models.UploadChunk{}).Error
+	}
+	if err != nil {
+		log.Errorf("delete upload fail: %s", err)
+		return &utils.ErrInternalServerError
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package store
+
+import (
+	"time"
+
+	"github.com/Dudobird/dudo-server/models"
+	"github.com/Dudobird/dudo-server/utils"
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+)
+
+// getFile return the file with id of user, folder is not allowed
+func (store *FileStore) getFile(id string) (*models.StorageFile, error) {
+	file, err := store.getStorageFile(id)
+	if err != nil {
+		return nil, err
+	}
+	if file.IsDir {
+		return nil, &utils.ErrPostDataNotCorrect
+	}
+	return file, nil
+}
+
+// newFileVersion create a version from the current content of file
+func newFileVersion(file *models.StorageFile) *models.FileVersion {
+	return &models.FileVersion{
+		ID:        utils.GenRandomID("version", 15),
+		CreatedAt: file.UpdatedAt,
+		FileID:    file.ID,
+		UserID:    file.Uploader(),
+		Bucket:    file.Bucket,
+		Path:      file.ObjectName(),
+		Hash:      file.Hash,
+		MIMEType:  file.MIMEType,
+		FileSize:  file.FileSize,
+	}
+}
+
+// updateFileContent change the current content of file uploaded by user
+func updateFileContent(db *gorm.DB, fileID, uploadedBy, bucket, path, hash, mimeType string, size int64) error {
+	return db.Model(&models.StorageFile{}).Where("id = ?", fileID).UpdateColumns(map[string]interface{}{
+		"uploaded_by": uploadedBy,
+		"bucket":      bucket,
+		"path":        path,
+		"hash":        hash,
+		"mime_type":   mimeType,
+		"file_size":   size,
+		"updated_at":  time.Now(),
+	}).Error
+}
+
+// SaveFileVersion save the new content of file as current version
+// UploadedBy of file is the user who upload the new content
+// the old content is kept as a history version and the oldest versions
+// over user limit are deleted, return the objects to delete from storage
+func (store *FileStore) SaveFileVersion(file *models.StorageFile) ([]models.StorageFile, error) {
+	current, err := store.getFile(file.ID)
+	if err != nil {
+		return nil, err
+	}
+	if file.Hash != "" {
+		blob := &models.Blob{
+			Hash:     file.Hash,
+			Bucket:   file.Bucket,
+			Path:     file.Path,
+			MIMEType: file.MIMEType,
+			Size:     file.FileSize,
+		}
+		if err := store.addBlobReference(blob); err != nil {
+			log.Errorf("add blob reference error: %s", err)
+			return nil, &utils.ErrInternalServerError
+		}
+		file.Bucket = blob.Bucket
+		file.Path = blob.Path
+	}
+	tx := store.DB.Begin()
+	err = tx.Create(newFileVersion(current)).Error
+	if err == nil {
+		err = updateFileContent(tx, file.ID, file.Uploader(), file.Bucket, file.Path, file.Hash, file.MIMEType, file.FileSize)
+	}
+	if err == nil {
+		err = store.reserveDiskUsage(tx, current.UserID, file.FileSize)
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		if file.Hash != "" {
+			store.releaseBlobReference(file.Hash)
+		}
+		if customErr, ok := err.(*utils.CustomError); ok {
+			return nil, customErr
+		}
+		log.Errorf("save file version fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	return store.pruneFileVersions(current)
+}
+
+// pruneFileVersions delete the oldest versions over user limit
+func (store *FileStore) pruneFileVersions(file *models.StorageFile) ([]models.StorageFile, error) {
+	profile := &models.Profile{}
+	err := store.DB.Where("user_id = ?", file.UserID).First(profile).Error
+	if err != nil {
+		log.Errorf("query user profile fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	versions := []models.FileVersion{}
+	err = store.DB.Where("file_id = ?", file.ID).Order("created_at desc").Find(&versions).Error
+	if err != nil {
+		log.Errorf("query file versions fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	if profile.MaxFileVersions < 0 || len(versions) <= profile.MaxFileVersions {
+		return []models.StorageFile{}, nil
+	}
+	return store.deleteFileVersions(file, versions[profile.MaxFileVersions:]), nil
+}
+
+// deleteFileVersions delete versions and release the disk usage
+// return the objects to delete from storage
+func (store *FileStore) deleteFileVersions(file *models.StorageFile, versions []models.FileVersion) []models.StorageFile {
+	objects := []models.StorageFile{}
+	for _, v := range versions {
+		deleted, err := store.deleteWithUsage(&v, file.UserID, v.FileSize)
+		if err != nil {
+			log.Errorf("delete file version %s fail: %s", v.ID, err)
+			continue
+		}
+		if deleted == false {
+			continue
+		}
+		if store.isLastReference(v.Hash) {
+			objects = append(objects, models.StorageFile{
+				RawStorageFileInfo: models.RawStorageFileInfo{
+					ID:       v.ID,
+					FileName: file.FileName,
+					Bucket:   v.Bucket,
+					Path:     v.Path,
+				},
+			})
+		}
+	}
+	return objects
+}
+
+// ListFileVersions return the old versions of file, the newest first
+func (store *FileStore) ListFileVersions(fileID string) ([]models.FileVersion, error) {
+	if _, err := store.getFile(fileID); err != nil {
+		return nil, err
+	}
+	versions := []models.FileVersion{}
+	err := store.DB.Where("file_id = ?", fileID).Order("created_at desc").Find(&versions).Error
+	if err != nil {
+		log.Errorf("query file versions fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	return versions, nil
+}
+
+// GetFileVersion return the file and its version with id
+func (store *FileStore) GetFileVersion(fileID, versionID string) (*models.StorageFile, *models.FileVersion, error) {
+	file, err := store.getFile(fileID)
+	if err != nil {
+		return nil, nil, err
+	}
+	version := &models.FileVersion{}
+	err = store.DB.Where("id = ? and file_id = ?", versionID, fileID).First(version).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil, &utils.ErrResourceNotFound
+		}
+		log.Errorf("query file version fail: %s", err)
+		return nil, nil, &utils.ErrInternalServerError
+	}
+	return file, version, nil
+}
+
+// RestoreFileVersion make the old version as current content
+// and the current content is kept as a version
+func (store *FileStore) RestoreFileVersion(fileID, versionID string) (*models.StorageFile, error) {
+	file, version, err := store.GetFileVersion(fileID, versionID)
+	if err != nil {
+		return nil, err
+	}
+	tx := store.DB.Begin()
+	err = tx.Create(newFileVersion(file)).Error
+	if err == nil {
+		err = updateFileContent(tx, file.ID, version.UserID, version.Bucket, version.Path, version.Hash, version.MIMEType, version.FileSize)
+	}
+	if err == nil {
+		err = tx.Delete(version).Error
+	}
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		log.Errorf("restore file version fail: %s", err)
+		return nil, &utils.ErrInternalServerError
+	}
+	return store.getFile(fileID)
+}
+
+// DeleteFileVersion delete an old version of file
+// return the objects to delete from storage
+func (store *FileStore) DeleteFileVersion(fileID, versionID string) ([]models.StorageFile, error) {
+	file, version, err := store.GetFileVersion(fileID, versionID)
+	if err != nil {
+		return nil, err
+	}
+	return store.deleteFileVersions(file, []models.FileVersion{*version}), nil
+}
@@ -8,3 +8,6 @@ const TokenContextKey = ContextToken("MyAppToken")
 
 // AdminContextKey save the status of user role
 const AdminContextKey = ContextToken("IsAdmin")
+
+// SessionContextKey save the login session of token
+const SessionContextKey = ContextToken("SessionID")
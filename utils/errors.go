@@ -28,10 +28,43 @@ var (
 	ErrUseCredentialsNotCorrect = CustomError{error: errors.New("email or password not correct"), status: 401}
 	ErrEmailAlreadyInUse        = CustomError{error: errors.New("email address is already in use"), status: 403}
 	ErrUserNotFound             = CustomError{error: errors.New("user not found"), status: 404}
+	ErrPasswordNotCorrect       = CustomError{error: errors.New("password not correct"), status: 403}
+
+	// two factor authentication
+	ErrTwoFactorCodeNotCorrect  = CustomError{error: errors.New("two factor code not correct"), status: 403}
+	ErrTwoFactorRequired        = CustomError{error: errors.New("two factor authentication is required for user role"), status: 403}
+	ErrTwoFactorAlreadyEnabled  = CustomError{error: errors.New("two factor authentication is already enabled"), status: 400}
+	ErrTwoFactorNotEnabled      = CustomError{error: errors.New("two factor authentication is not enabled"), status: 400}
+	ErrTwoFactorTooManyAttempts = CustomError{error: errors.New("too many wrong two factor codes, try again later"), status: 429}
+
+	// single sign on
+	ErrSSONotEnabled       = CustomError{error: errors.New("single sign on is not enabled"), status: 404}
+	ErrSSOStateNotValid    = CustomError{error: errors.New("login state is not valid or expired"), status: 400}
+	ErrSSOLoginFail        = CustomError{error: errors.New("login with identity provider fail"), status: 401}
+	ErrSSOEmailNotVerified = CustomError{error: errors.New("email of identity is not verified"), status: 403}
+
+	// share
+	ErrSharePasswordRequired   = CustomError{error: errors.New("share is protected by password"), status: 401}
+	ErrSharePasswordNotCorrect = CustomError{error: errors.New("share password not correct"), status: 403}
+	ErrShareTooManyAttempts    = CustomError{error: errors.New("too many wrong password attempts, try again later"), status: 429}
+	ErrShareDownloadLimit      = CustomError{error: errors.New("share download limit reached"), status: 410}
+
+	// file request
+	ErrFileRequestExpired        = CustomError{error: errors.New("file request is expired"), status: 410}
+	ErrFileRequestFileTooLarge   = CustomError{error: errors.New("file size exceed the limit of file request"), status: 413}
+	ErrFileRequestTypeNotAllowed = CustomError{error: errors.New("file type is not allowed by file request"), status: 415}
 
 	// resources
-	ErrResourceNotFound = CustomError{error: errors.New("resource not found"), status: 404}
-	ErrEmptyFolder      = CustomError{error: errors.New("download empty folder is not allowed"), status: 400}
+	ErrResourceNotFound  = CustomError{error: errors.New("resource not found"), status: 404}
+	ErrEmptyFolder       = CustomError{error: errors.New("download empty folder is not allowed"), status: 400}
+	ErrDiskQuotaExceeded = CustomError{error: errors.New("disk quota exceeded"), status: 507}
+	ErrFileTooLarge      = CustomError{error: errors.New("file size exceed disk limit"), status: 413}
+
+	// resumable upload
+	ErrTusVersionNotSupported = CustomError{error: errors.New("tus version not supported"), status: 412}
+	ErrUploadOffsetConflict   = CustomError{error: errors.New("upload offset not match"), status: 409}
+	ErrUploadLengthExceeded   = CustomError{error: errors.New("upload data exceed upload length"), status: 413}
+	ErrUnsupportedMediaType   = CustomError{error: errors.New("content type not supported"), status: 415}
 
 	// sevice
 	ErrInternalServerError = CustomError{error: errors.New("internal server error"), status: 500}
@@ -1,7 +1,10 @@
 package utils
 
 import (
+	"io/ioutil"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestGetFileSizeFromReadable(t *testing.T) {
@@ -172,3 +175,48 @@ func TestGetFileExtention(t *testing.T) {
 		Equals(t, tc.expect, GetFileExtention(tc.fileName))
 	}
 }
+
+func TestCountingReader(t *testing.T) {
+	reader := &CountingReader{Reader: strings.NewReader("this is 1.file")}
+	data, err := ioutil.ReadAll(reader)
+	OK(t, err)
+	Equals(t, "this is 1.file", string(data))
+	Equals(t, int64(14), reader.Count)
+}
+
+func TestTOTP(t *testing.T) {
+	// test vectors of RFC 6238 with secret "12345678901234567890"
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	testCases := []struct {
+		time int64
+		code string
+	}{
+		{time: 59, code: "287082"},
+		{time: 1111111109, code: "081804"},
+		{time: 1111111111, code: "050471"},
+		{time: 1234567890, code: "005924"},
+		{time: 2000000000, code: "279037"},
+	}
+	for _, tc := range testCases {
+		code, err := TOTPCode(secret, TOTPStep(time.Unix(tc.time, 0)))
+		OK(t, err)
+		Equals(t, tc.code, code)
+	}
+	now := time.Unix(1234567890, 0)
+	step, ok := ValidateTOTP(secret, "005924", now.Add(TOTPPeriod*time.Second))
+	Assert(t, ok, "code of previous period should be accepted")
+	Equals(t, TOTPStep(now), step)
+	_, ok = ValidateTOTP(secret, "005924", now.Add(3*TOTPPeriod*time.Second))
+	Assert(t, ok == false, "expired code should not be accepted")
+	_, ok = ValidateTOTP(secret, "12345", now)
+	Assert(t, ok == false, "code with wrong length should not be accepted")
+
+	generated := GenTOTPSecret()
+	code, err := TOTPCode(generated, TOTPStep(now))
+	OK(t, err)
+	_, ok = ValidateTOTP(generated, code, now)
+	Assert(t, ok, "code of generated secret should be accepted")
+	uri := TOTPProvisioningURI(generated, "dudo", "test@example.com")
+	Assert(t, strings.HasPrefix(uri, "otpauth://totp/dudo:test@example.com?"), "uri label not correct")
+	Assert(t, strings.Contains(uri, "secret="+generated), "uri secret not found")
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"encoding/json"
+	"net"
 	"net/http"
 )
 
@@ -54,3 +55,12 @@ func JSONResonseWithMessage(w http.ResponseWriter, message *Message) {
 	w.WriteHeader(message.Status)
 	w.Write(data)
 }
+
+// GetRequestIP return the ip address of client
+func GetRequestIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}